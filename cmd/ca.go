@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/larntz/status/internal/pki"
+)
+
+func caCommand() *command {
+	return &command{
+		name:    "ca",
+		summary: "Issue certificates for mutual TLS between workers and the controller",
+		commands: []*command{
+			{name: "init", summary: "Create the CA certificate and key", setup: caInitCommand,
+				description: "Create ca.crt and ca.key in --dir. Keep ca.key offline, set ca.crt as\n" +
+					"controller.client_ca and worker.tls_ca."},
+			{name: "worker", summary: "Issue a worker client certificate for a region", setup: caWorkerCommand,
+				description: "Issue a client certificate with the region embedded. The controller only serves\n" +
+					"a worker with it the checks of that region, no api token is needed.\n\n" +
+					"Example:\n  status ca worker --region us-east-1 --name worker-us-east-1"},
+			{name: "server", summary: "Issue the controller's server certificate", setup: caServerCommand,
+				description: "Issue a server certificate for the hosts workers use to reach the controller.\n\n" +
+					"Example:\n  status ca server --host status.example.com,10.0.0.5"},
+		},
+	}
+}
+
+func caInitCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	dir := fs.String("dir", "ca", "directory to write ca.crt and ca.key to")
+	name := fs.String("name", "status CA", "CA common name")
+	validity := fs.Duration("validity", 10*365*24*time.Hour, "how long the CA is valid")
+	return func(ctx context.Context, r *runner) error {
+		if *validity <= 0 {
+			return usageErrorf("--validity must be positive")
+		}
+		certFile, keyFile := filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key")
+		if err := notExists(certFile, keyFile); err != nil {
+			return err
+		}
+		ca, err := pki.NewCA(*name, time.Now(), *validity)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(*dir, 0o700); err != nil {
+			return err
+		}
+		return writeCert(r, ca.Cert, ca.Key, certFile, keyFile)
+	}
+}
+
+func caWorkerCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	dir := fs.String("dir", "ca", "directory with ca.crt and ca.key")
+	region := fs.String("region", "", "region the worker runs checks for (required)")
+	name := fs.String("name", "", "certificate common name and file name (default worker-<region>)")
+	out := fs.String("out", ".", "directory to write <name>.crt and <name>.key to")
+	validity := fs.Duration("validity", 365*24*time.Hour, "how long the certificate is valid")
+	return func(ctx context.Context, r *runner) error {
+		if *region == "" {
+			return usageErrorf("--region is required")
+		}
+		if *name == "" {
+			*name = "worker-" + *region
+		}
+		return issueCert(r, *dir, *out, *name, func(ca *pki.CA) (*x509.Certificate, crypto.Signer, error) {
+			return ca.IssueWorker(*name, *region, time.Now(), *validity)
+		}, *validity)
+	}
+}
+
+func caServerCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	var hosts listFlag
+	dir := fs.String("dir", "ca", "directory with ca.crt and ca.key")
+	fs.Var(&hosts, "host", "dns name or ip address of the controller, repeat or separate with commas (required)")
+	name := fs.String("name", "controller", "file name of the certificate")
+	out := fs.String("out", ".", "directory to write <name>.crt and <name>.key to")
+	validity := fs.Duration("validity", 365*24*time.Hour, "how long the certificate is valid")
+	return func(ctx context.Context, r *runner) error {
+		if len(hosts.values(",")) == 0 {
+			return usageErrorf("at least one --host is required")
+		}
+		return issueCert(r, *dir, *out, *name, func(ca *pki.CA) (*x509.Certificate, crypto.Signer, error) {
+			return ca.IssueServer(hosts.values(","), time.Now(), *validity)
+		}, *validity)
+	}
+}
+
+// issueCert signs a certificate with the CA in dir and writes it to out
+func issueCert(r *runner, dir string, out string, name string,
+	issue func(ca *pki.CA) (*x509.Certificate, crypto.Signer, error), validity time.Duration) error {
+	if validity <= 0 {
+		return usageErrorf("--validity must be positive")
+	}
+	ca, err := pki.LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		return fmt.Errorf("load CA, create one with status ca init: %w", err)
+	}
+	certFile, keyFile := filepath.Join(out, name+".crt"), filepath.Join(out, name+".key")
+	if err := notExists(certFile, keyFile); err != nil {
+		return err
+	}
+	cert, key, err := issue(ca)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	return writeCert(r, cert, key, certFile, keyFile)
+}
+
+func writeCert(r *runner, cert *x509.Certificate, key crypto.Signer, certFile string, keyFile string) error {
+	if err := pki.WriteFiles(cert, key, certFile, keyFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.stdout, "+ create %s and %s (%s, expires %s)\n", certFile, keyFile,
+		cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// notExists returns an error if any of files exists, certificates and
+// keys are never overwritten
+func notExists(files ...string) error {
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("%s already exists", f)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
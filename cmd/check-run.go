@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/larntz/status/cmd/worker"
+	"github.com/larntz/status/internal/checkconfig"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/secrets"
+)
+
+func checkRunCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	var c checkconfig.Check
+	var headers, assertions listFlag
+	file := fs.String("file", "", "run the checks in this yaml or json check file, or only the ids given as arguments")
+	region := fs.String("region", "local", "region recorded in the results, the probe always runs from this machine")
+	format := fs.String("format", "table", "table or json")
+	fs.StringVar(&c.URL, "url", "", "http or https url to check")
+	fs.Var(&c.Timeout, "timeout", "http timeout, seconds or e.g. 5s (default 10s)")
+	fs.Var(&headers, "header", "request header as 'Name: value', repeat for more than one")
+	fs.Var(&assertions, "assert", "assertion as 'type [header] [operator] value', e.g. 'status_code eq 200',\n"+
+		"'response_time lt 500', 'body_contains ok' or 'header Content-Type contains json', repeat for more than one")
+	return func(ctx context.Context, r *runner) error {
+		if *format != "table" && *format != "json" {
+			return usageErrorf("unknown format %q, use table or json", *format)
+		}
+		var statusChecks []checks.StatusCheck
+		switch {
+		case *file != "" && c.URL != "":
+			return usageErrorf("use either --url or --file")
+		case *file != "":
+			if len(headers) > 0 || len(assertions) > 0 || c.Timeout != 0 {
+				return usageErrorf("--header, --assert and --timeout only apply to --url, set them in the check file")
+			}
+			var err error
+			if statusChecks, err = fileChecks(*file, r.args); err != nil {
+				return err
+			}
+		case c.URL != "":
+			if len(r.args) != 0 {
+				return usageErrorf("unexpected arguments %q, ids only apply to --file", r.args)
+			}
+			check, err := urlCheck(c, *region, headers, assertions)
+			if err != nil {
+				return usageError(err.Error())
+			}
+			statusChecks = []checks.StatusCheck{check}
+		default:
+			return usageErrorf("check run needs --url or --file")
+		}
+
+		// secrets resolve as they do on a worker, the database is only
+		// opened for them when a secret key is configured
+		resolver := &secrets.Resolver{Dir: r.cfg.Worker.SecretsDir}
+		if r.cfg.Worker.SecretKeyFile != "" && hasSecrets(statusChecks) {
+			key, err := secrets.LoadKey(r.cfg.Worker.SecretKeyFile)
+			if err != nil {
+				return fmt.Errorf("worker secret key: %w", err)
+			}
+			db, err := r.database(ctx)
+			if err != nil {
+				return err
+			}
+			defer db.Disconnect(context.Background())
+			resolver.DB, resolver.Key = db, key
+		}
+
+		var reports []probeReport
+		failed := 0
+		for i := range statusChecks {
+			resolved, err := resolver.Resolve(ctx, statusChecks[i])
+			if err != nil {
+				return err
+			}
+			// a new transport for each check so every probe opens a new
+			// connection and reports dns, connect and tls timings
+			probe, err := worker.RunProbe(ctx, &http.Transport{}, &resolved, *region)
+			if err != nil {
+				return fmt.Errorf("check %s: %w", statusChecks[i].ID, err)
+			}
+			report := newProbeReport(&statusChecks[i], probe)
+			if !report.Up {
+				failed++
+			}
+			reports = append(reports, report)
+		}
+
+		if *format == "json" {
+			encoder := json.NewEncoder(r.stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(reports); err != nil {
+				return err
+			}
+		} else {
+			for i, report := range reports {
+				if i > 0 {
+					fmt.Fprintln(r.stdout)
+				}
+				report.write(r.stdout)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(reports))
+		}
+		return nil
+	}
+}
+
+// fileChecks returns the checks in the check file at path, or the ones
+// named by ids
+func fileChecks(path string, ids []string) ([]checks.StatusCheck, error) {
+	file, err := checkconfig.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid check file %s:\n%w", path, err)
+	}
+	statusChecks := file.StatusChecks()
+	if len(ids) == 0 {
+		return statusChecks, nil
+	}
+	byID := make(map[string]checks.StatusCheck, len(statusChecks))
+	for _, check := range statusChecks {
+		byID[check.ID] = check
+	}
+	selected := make([]checks.StatusCheck, 0, len(ids))
+	for _, id := range ids {
+		check, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("check %s not found in %s", id, path)
+		}
+		selected = append(selected, check)
+	}
+	return selected, nil
+}
+
+// hasSecrets reports whether any of statusChecks references a secret
+func hasSecrets(statusChecks []checks.StatusCheck) bool {
+	for _, c := range statusChecks {
+		if c.HasSecrets() {
+			return true
+		}
+	}
+	return false
+}
+
+// urlCheck builds the check for check run --url
+func urlCheck(c checkconfig.Check, region string, headers listFlag, assertions listFlag) (checks.StatusCheck, error) {
+	if u, err := url.Parse(c.URL); err == nil && u.Host != "" {
+		c.ID = u.Host
+	} else {
+		c.ID = c.URL
+	}
+	c.Regions = []string{region}
+	var err error
+	if c.Headers, err = headers.headers(); err != nil {
+		return checks.StatusCheck{}, err
+	}
+	for _, s := range assertions {
+		a, err := parseAssertion(s)
+		if err != nil {
+			return checks.StatusCheck{}, err
+		}
+		c.Assertions = append(c.Assertions, a)
+	}
+	if err := c.Validate(); err != nil {
+		return checks.StatusCheck{}, fmt.Errorf("%s", strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	return c.StatusCheck(), nil
+}
+
+// assertionOperators are the operators parseAssertion recognizes
+var assertionOperators = []string{checks.OpEqual, checks.OpNotEqual, checks.OpLess, checks.OpLessOrEqual,
+	checks.OpGreater, checks.OpGreaterOrEq, checks.OpContains}
+
+// parseAssertion parses 'type [header] [operator] value', the operator
+// defaults as it does in check files
+func parseAssertion(s string) (checks.Assertion, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return checks.Assertion{}, fmt.Errorf("invalid assertion %q, use 'type [header] [operator] value'", s)
+	}
+	a := checks.Assertion{Type: checks.AssertionType(fields[0])}
+	fields = fields[1:]
+	if a.Type == checks.AssertHeader {
+		a.Target, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 1 {
+		for _, op := range assertionOperators {
+			if fields[0] == op {
+				a.Operator, fields = op, fields[1:]
+				break
+			}
+		}
+	}
+	a.Value = strings.Join(fields, " ")
+	if err := a.Validate(); err != nil {
+		return checks.Assertion{}, fmt.Errorf("invalid assertion %q: %w", s, err)
+	}
+	return a, nil
+}
+
+// probeReport is what check run prints for each check
+type probeReport struct {
+	ID           string            `json:"id"`
+	URL          string            `json:"url"`
+	Region       string            `json:"region"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Up           bool              `json:"up"`
+	ResponseCode int               `json:"response_code"`
+	ResponseInfo string            `json:"response_info"`
+	Error        string            `json:"error,omitempty"`
+	RemoteAddr   string            `json:"remote_addr,omitempty"`
+	Timings      probeTimings      `json:"timings_ms"`
+	TLS          *probeTLS         `json:"tls,omitempty"`
+	Assertions   []assertionReport `json:"assertions,omitempty"`
+}
+
+type probeTimings struct {
+	DNS     int64 `json:"dns"`
+	Connect int64 `json:"connect"`
+	TLS     int64 `json:"tls"`
+	TTFB    int64 `json:"ttfb"`
+}
+
+type probeTLS struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	ServerName  string    `json:"server_name"`
+	Subject     string    `json:"subject,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	NotAfter    time.Time `json:"not_after,omitempty"`
+}
+
+type assertionReport struct {
+	checks.Assertion
+	Passed  bool   `json:"passed"`
+	Failure string `json:"failure,omitempty"`
+}
+
+func newProbeReport(check *checks.StatusCheck, probe worker.Probe) probeReport {
+	result := probe.Result
+	report := probeReport{
+		ID:           check.ID,
+		URL:          check.URL,
+		Region:       result.Metadata.Region,
+		Timestamp:    result.Timestamp,
+		Up:           result.Up(),
+		ResponseCode: result.ResponseCode,
+		ResponseInfo: result.ResponseInfo,
+		Timings: probeTimings{
+			DNS:     result.DNSTiming,
+			Connect: result.ConnectTiming,
+			TLS:     result.TLSTiming,
+			TTFB:    result.TTFB,
+		},
+	}
+	if probe.Err != nil {
+		report.Error = probe.Err.Error()
+	}
+	if probe.Trace.ConnInfo.Conn != nil {
+		report.RemoteAddr = probe.Trace.ConnInfo.Conn.RemoteAddr().String()
+	}
+	if probe.TLS != nil {
+		report.TLS = newProbeTLS(probe.TLS)
+	}
+	for _, a := range probe.Assertions {
+		report.Assertions = append(report.Assertions, assertionReport{a.Assertion, a.Failure == "", a.Failure})
+	}
+	return report
+}
+
+func newProbeTLS(state *tls.ConnectionState) *probeTLS {
+	info := &probeTLS{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.Subject = cert.Subject.String()
+		info.Issuer = cert.Issuer.String()
+		info.DNSNames = cert.DNSNames
+		info.NotAfter = cert.NotAfter
+	}
+	return info
+}
+
+// write prints the report as a table
+func (p probeReport) write(w io.Writer) {
+	up := "UP"
+	if !p.Up {
+		up = "DOWN"
+	}
+	fmt.Fprintf(w, "%s  %s  %s\n", up, p.ID, p.URL)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  region\t%s\n", p.Region)
+	fmt.Fprintf(tw, "  response\t%s\n", p.ResponseInfo)
+	if p.RemoteAddr != "" {
+		fmt.Fprintf(tw, "  remote\t%s\n", p.RemoteAddr)
+	}
+	fmt.Fprintf(tw, "  dns\t%dms\n", p.Timings.DNS)
+	fmt.Fprintf(tw, "  connect\t%dms\n", p.Timings.Connect)
+	fmt.Fprintf(tw, "  tls\t%dms\n", p.Timings.TLS)
+	fmt.Fprintf(tw, "  ttfb\t%dms\n", p.Timings.TTFB)
+	if p.TLS != nil {
+		fmt.Fprintf(tw, "  tls version\t%s %s\n", p.TLS.Version, p.TLS.CipherSuite)
+		if p.TLS.Subject != "" {
+			fmt.Fprintf(tw, "  certificate\t%s, issued by %s\n", p.TLS.Subject, p.TLS.Issuer)
+			fmt.Fprintf(tw, "  expires\t%s (%d days)\n", p.TLS.NotAfter.UTC().Format(time.RFC3339),
+				int(time.Until(p.TLS.NotAfter).Hours()/24))
+		}
+	}
+	tw.Flush()
+	for _, a := range p.Assertions {
+		if a.Passed {
+			fmt.Fprintf(w, "  pass  %s\n", a.Assertion)
+		} else {
+			fmt.Fprintf(w, "  FAIL  %s\n", a.Failure)
+		}
+	}
+}
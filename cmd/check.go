@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/larntz/status/internal/checkconfig"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+func checkCommand() *command {
+	return &command{
+		name:    "check",
+		summary: "List, show, add and remove checks",
+		commands: []*command{
+			{name: "list", summary: "List checks", setup: checkListCommand},
+			{name: "get", args: "<id>", summary: "Show a check", setup: checkGetCommand},
+			{name: "add", summary: "Add a check", setup: checkAddCommand,
+				description: "Add a check. Use sync or import to change existing checks.\n\n" +
+					"Example:\n  status check add --id api --url https://api.example.com/health --region us-east-1,eu-west-1 --interval 30s"},
+			{name: "run", args: "[<id>...]", summary: "Run checks once from this machine and show the timings", setup: checkRunCommand,
+				description: "Run a check once from this machine and print the phase timings, TLS details and\n" +
+					"assertion results. Exits 1 when a check is down, so it can validate a check before\n" +
+					"it is added or run smoke tests in CI. No database is needed.\n\n" +
+					"Examples:\n  status check run --url https://api.example.com/health --assert 'status_code eq 200'\n" +
+					"  status check run --file checks.yaml api web"},
+			{name: "rm", args: "<id>...", summary: "Remove checks, their results are kept", setup: checkRmCommand},
+		},
+	}
+}
+
+func checkListCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	format := fs.String("format", "table", "table, yaml or json, yaml and json can be used with sync")
+	region := fs.String("region", "", "only list checks assigned to this region")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if *format != "table" && *format != "yaml" && *format != "json" {
+			return usageErrorf("unknown format %q, use table, yaml or json", *format)
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+
+		var statusChecks []checks.StatusCheck
+		if *region != "" {
+			regionChecks, err := db.GetRegionChecks(ctx, *region)
+			statusChecks = regionChecks.StatusChecks
+			if err != nil {
+				return err
+			}
+		} else if statusChecks, err = db.ListStatusChecks(ctx); err != nil {
+			return err
+		}
+		if *format != "table" {
+			return checkconfig.FromStatusChecks(statusChecks).Write(r.stdout, *format == "json")
+		}
+		writeCheckTable(r.stdout, statusChecks)
+		return nil
+	}
+}
+
+// writeCheckTable prints one line per check
+func writeCheckTable(w io.Writer, statusChecks []checks.StatusCheck) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tURL\tINTERVAL\tREGIONS\tACTIVE\tSERIAL")
+	for _, c := range statusChecks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\t%d\n", c.ID, c.Name, c.URL,
+			time.Duration(c.Interval)*time.Second, strings.Join(c.Regions, ","), c.Active, c.Serial)
+	}
+	tw.Flush()
+}
+
+func checkGetCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	format := fs.String("format", "yaml", "yaml or json")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) != 1 {
+			return usageErrorf("check get needs one check id")
+		}
+		if *format != "yaml" && *format != "json" {
+			return usageErrorf("unknown format %q, use yaml or json", *format)
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		check, err := db.GetStatusCheck(ctx, r.args[0])
+		if errors.Is(err, data.ErrNotFound) {
+			return fmt.Errorf("check %s not found", r.args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		// the file format plus the fields sync and import manage
+		shown := struct {
+			checkconfig.Check `yaml:",inline"`
+			Tenant            string    `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+			Modified          time.Time `json:"modified" yaml:"modified"`
+			Serial            uint64    `json:"serial" yaml:"serial"`
+		}{checkconfig.FromStatusCheck(check), check.Tenant, check.Modified, check.Serial}
+		if *format == "json" {
+			b, err := json.MarshalIndent(shown, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(r.stdout, "%s\n", b)
+			return err
+		}
+		encoder := yaml.NewEncoder(r.stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(shown); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+}
+
+func checkAddCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	var c checkconfig.Check
+	var regions, tags, headers listFlag
+	inactive := fs.Bool("inactive", false, "add the check paused")
+	fs.StringVar(&c.ID, "id", "", "check id (required)")
+	fs.StringVar(&c.URL, "url", "", "http or https url to check (required)")
+	fs.StringVar(&c.Name, "name", "", "name shown on the status page instead of the id")
+	fs.StringVar(&c.Group, "group", "", "status page group")
+	fs.Var(&c.Interval, "interval", "how often the check runs, seconds or e.g. 30s, 5m (default 1m)")
+	fs.Var(&c.Timeout, "timeout", "http timeout, seconds or e.g. 5s (default 10s)")
+	fs.Var(&regions, "region", "region to run the check from, repeat or separate with commas (required)")
+	fs.Var(&tags, "tag", "tag, repeat or separate with commas")
+	fs.Var(&headers, "header", "request header as 'Name: value', repeat for more than one")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) != 0 {
+			return usageErrorf("unexpected arguments %q, check add only takes flags", r.args)
+		}
+		c.Regions, c.Tags = regions.values(","), tags.values(",")
+		var err error
+		if c.Headers, err = headers.headers(); err != nil {
+			return usageError(err.Error())
+		}
+		if *inactive {
+			active := false
+			c.Active = &active
+		}
+		if err := c.Validate(); err != nil {
+			return usageError(strings.ReplaceAll(err.Error(), "\n", "; "))
+		}
+
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		check := c.StatusCheck()
+		check.Modified = time.Now().UTC()
+		check.Serial = 1
+		if err := data.CheckQuota(ctx, db, check); err != nil {
+			return err
+		}
+		err = db.CreateStatusCheck(ctx, check)
+		if errors.Is(err, data.ErrExists) {
+			return fmt.Errorf("check %s already exists, use sync or import to change it", check.ID)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.stdout, "+ create %s (%s)\n", check.ID, check.URL)
+		return nil
+	}
+}
+
+func checkRmCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) == 0 {
+			return usageErrorf("check rm needs at least one check id")
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		var errs []error
+		for _, id := range r.args {
+			err := db.DeleteStatusCheck(ctx, id)
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				errs = append(errs, fmt.Errorf("check %s not found", id))
+			case err != nil:
+				errs = append(errs, fmt.Errorf("delete %s failed: %w", id, err))
+			default:
+				fmt.Fprintf(r.stdout, "- delete %s\n", id)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// listFlag collects a flag that can be repeated
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// values splits every value on sep and drops empty ones
+func (l listFlag) values(sep string) []string {
+	var values []string
+	for _, v := range l {
+		for _, part := range strings.Split(v, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// headers parses 'Name: value' values, it returns nil when there are none
+func (l listFlag) headers() (map[string]string, error) {
+	var headers map[string]string
+	for _, h := range l {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, use 'Name: value'", h)
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/cmd/controller"
+	"github.com/larntz/status/cmd/worker"
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checkconfig"
+	"github.com/larntz/status/internal/config"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/export"
+	"github.com/larntz/status/internal/leader"
+	"github.com/larntz/status/internal/pki"
+	"github.com/larntz/status/internal/rollup"
+	"github.com/larntz/status/internal/secrets"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+func rootCommand() *command {
+	return &command{
+		name: programName,
+		description: "status runs http checks from workers in several regions and reports uptime.\n\n" +
+			"Exit codes: 0 success, 1 the command failed, 2 bad arguments, flags or config.",
+		commands: []*command{
+			workerCommand(),
+			controllerCommand(),
+			checkCommand(),
+			resultsCommand(),
+			tokenCommand(),
+			tenantCommand(),
+			secretCommand(),
+			caCommand(),
+			{name: "import", args: "<checks.csv>", summary: "Create and update checks from a CSV file",
+				description: "Create and update checks from a CSV file. The first row is a header naming the\n" +
+					"columns, e.g. id,url,interval,regions. Rows are upserted by id and checks that\n" +
+					"are not in the file are kept unless --replace is set. Only the default tenant's\n" +
+					"checks are changed unless --tenant is set.",
+				setup: importCommand},
+			{name: "sync", args: "<checks.yaml|checks.json>", summary: "Make the checks in the database match a check file",
+				description: "Create, update and, unless --prune=false, delete checks so the database matches\n" +
+					"the check file. Only the default tenant's checks are changed unless --tenant is set.",
+				setup: syncCommand},
+			{name: "export", summary: "Export checks or results to a file", commands: []*command{
+				{name: "checks", summary: "Export checks as YAML, JSON or CSV", setup: exportChecksCommand},
+				{name: "results", summary: "Export results for a time range as CSV, JSON lines or Parquet", setup: exportResultsCommand},
+			}},
+			{name: "migrate", summary: "Create or update the database schema and retention", setup: migrateCommand},
+			{name: "init-db", summary: "Alias for migrate", setup: migrateCommand},
+			{name: "rollup", summary: "Recompute hourly and daily rollups", setup: rollupCommand},
+			{name: "config", summary: "Show the effective config", commands: []*command{
+				{name: "print", summary: "Print the config after applying the file, environment variables and flags",
+					description: "Print the effective config. Values come from the defaults, then the file named\n" +
+						"by --config or STATUS_CONFIG, then environment variables and then flags.\n" +
+						"The database password and worker token are hidden.",
+					setup: configPrintCommand, invalidConfig: true},
+			}},
+			{name: "version", summary: "Print the version", setup: versionCommand},
+		},
+	}
+}
+
+func workerCommand() *command {
+	return &command{
+		name:    "worker",
+		summary: "Run the checks assigned to a region",
+		setup: func(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+			return func(ctx context.Context, r *runner) error {
+				if r.cfg.Worker.Region == "" {
+					return usageErrorf("no worker region, set WORKER_REGION or --worker.region")
+				}
+				r.log.Info("Starting", zap.String("command", "worker"), zap.String("version", version))
+				state := worker.NewState(r.cfg.Worker)
+				state.Version = version
+				state.Log = r.log
+				state.HTTPTransport = &http.Transport{}
+				state.FlushTimeout = time.Duration(r.cfg.Database.WriteTimeout)
+				if client, err := controllerClient(r.cfg.Worker); err != nil {
+					return err
+				} else if client != nil {
+					state.ControllerClient = client
+				}
+				if r.cfg.Worker.TLSCert != "" {
+					// the controller only serves the region in the
+					// certificate, the worker has no database credentials
+					r.log.Info("Using the controller instead of the database", zap.String("controller", r.cfg.Worker.Controller))
+					state.DBClient = state.ControllerStore()
+				} else {
+					db, err := r.database(ctx)
+					if err != nil {
+						return err
+					}
+					defer db.Disconnect(context.Background())
+					state.DBClient = db
+				}
+				if r.cfg.Worker.SecretKeyFile != "" {
+					var err error
+					if state.Secrets.Key, err = secrets.LoadKey(r.cfg.Worker.SecretKeyFile); err != nil {
+						return fmt.Errorf("worker secret key: %w", err)
+					}
+					state.Secrets.DB = state.DBClient
+				}
+				state.RunWorker(ctx)
+				return nil
+			}
+		},
+	}
+}
+
+// controllerClient returns the worker's client for the controller when
+// cfg has TLS settings, nil otherwise. A client certificate must be for
+// the worker's region.
+func controllerClient(cfg config.Worker) (*http.Client, error) {
+	if cfg.TLSCert == "" && cfg.TLSCA == "" {
+		return nil, nil
+	}
+	tlsConfig, err := pki.ClientConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA)
+	if err != nil {
+		return nil, fmt.Errorf("worker tls: %w", err)
+	}
+	if len(tlsConfig.Certificates) > 0 {
+		cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("worker tls: %w", err)
+		}
+		if region, ok := pki.WorkerRegion(cert); !ok || region != cfg.Region {
+			return nil, usageErrorf("worker.tls_cert is for region %q, not %q", region, cfg.Region)
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
+}
+
+func controllerCommand() *command {
+	return &command{
+		name:    "controller",
+		summary: "Serve the api and status page and compute rollups",
+		setup: func(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+			return func(ctx context.Context, r *runner) error {
+				r.log.Info("Starting", zap.String("command", "controller"), zap.String("version", version))
+				db, err := r.database(ctx)
+				if err != nil {
+					return err
+				}
+				defer db.Disconnect(context.Background())
+				app := application.State{Ctx: ctx, Log: r.log, DbClient: db, Config: r.cfg.Controller}
+				if !app.Config.Auth {
+					r.log.Warn("API authentication is off, anyone on this host can use the api. "+
+						"Checks are served redacted, workers load them from the database.",
+						zap.String("addr", r.cfg.Controller.Addr))
+				}
+				// every replica serves the api, only the leader keeps
+				// rollups current for the uptime api
+				hostname, _ := os.Hostname()
+				elector := &leader.Elector{
+					Store: db,
+					Name:  "controller",
+					ID:    fmt.Sprintf("%s-%08x", hostname, rand.Uint32()),
+					TTL:   time.Duration(r.cfg.Controller.LeaderLease),
+					Log:   r.log,
+				}
+				electorCtx, stopElector := context.WithCancel(ctx)
+				elected := make(chan struct{})
+				go func() {
+					defer close(elected)
+					elector.Run(electorCtx, func(ctx context.Context) {
+						rollup.Schedule(ctx, db, time.Duration(r.cfg.Controller.RollupInterval),
+							time.Duration(r.cfg.Controller.RollupLookback), r.log)
+					})
+				}()
+				err = controller.StartController(&app)
+				// release the lease before the database is disconnected
+				stopElector()
+				<-elected
+				return err
+			}
+		},
+	}
+}
+
+func importCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := fileTenantFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	replace := fs.Bool("replace", false, "delete checks that are not in the file")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) != 1 {
+			return usageErrorf("import needs one csv file")
+		}
+		rows, err := checkconfig.LoadCSV(r.args[0])
+		if err != nil {
+			return fmt.Errorf("invalid csv file %s:\n%w", r.args[0], err)
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		existing, err := db.ListStatusChecks(ctx)
+		if err != nil {
+			return err
+		}
+		plan := checkconfig.Diff(checkconfig.MergeCSV(rows, existing), existing, *replace)
+		return applyPlan(ctx, r, db, plan, *dryRun)
+	}
+}
+
+func syncCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := fileTenantFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	prune := fs.Bool("prune", true, "delete checks that are not in the file")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) != 1 {
+			return usageErrorf("sync needs one check file")
+		}
+		file, err := checkconfig.Load(r.args[0])
+		if err != nil {
+			return fmt.Errorf("invalid check file %s:\n%w", r.args[0], err)
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		existing, err := db.ListStatusChecks(ctx)
+		if err != nil {
+			return err
+		}
+		return applyPlan(ctx, r, db, checkconfig.Diff(file.StatusChecks(), existing, *prune), *dryRun)
+	}
+}
+
+// applyPlan prints plan and applies it unless dryRun is set
+func applyPlan(ctx context.Context, r *runner, db data.Database, plan checkconfig.Plan, dryRun bool) error {
+	plan.Write(r.stdout)
+	if dryRun {
+		return nil
+	}
+	if err := plan.Apply(ctx, db, time.Now()); err != nil {
+		return err
+	}
+	r.log.Info("Checks updated", zap.Int("changes", len(plan.Changes)))
+	return nil
+}
+
+func exportChecksCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	format := fs.String("format", "", "yaml, json or csv (default from the --out extension, else yaml)")
+	out := fs.String("out", "", "write to this file instead of stdout")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		return withOutput(ctx, r, *out, func(db data.Database, w io.Writer) error {
+			return exportChecks(ctx, db, *format, *out, w, r.log)
+		})
+	}
+}
+
+func exportResultsCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	format := fs.String("format", "", "csv, jsonl or parquet (default from the --out extension, else csv)")
+	out := fs.String("out", "", "write to this file instead of stdout")
+	checkID := fs.String("check", "", "only export results for this check")
+	region := fs.String("region", "", "only export results from this region")
+	from := time.Now().Add(-24 * time.Hour)
+	to := time.Now()
+	fs.Func("from", "start of the results, RFC3339 or YYYY-MM-DD (default 24h ago)", func(s string) (err error) {
+		from, err = export.ParseTime(s)
+		return err
+	})
+	fs.Func("to", "end of the results, exclusive (default now)", func(s string) (err error) {
+		to, err = export.ParseTime(s)
+		return err
+	})
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		query := data.ResultQuery{CheckID: *checkID, Region: *region, From: from, To: to}
+		if !from.Before(to) {
+			return usageErrorf("--from %s must be before --to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		}
+		return withOutput(ctx, r, *out, func(db data.Database, w io.Writer) error {
+			return exportResults(ctx, db, query, *format, *out, w, r.log)
+		})
+	}
+}
+
+// withOutput connects to the database and calls write with r.stdout or
+// the file at path
+func withOutput(ctx context.Context, r *runner, path string, write func(db data.Database, w io.Writer) error) error {
+	db, err := r.database(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Disconnect(context.Background())
+	if path == "" {
+		return write(db, r.stdout)
+	}
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(db, w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func migrateCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	retention := fs.Duration("retention", 0, "shorthand for --database.result-retention")
+	granularity := fs.String("granularity", "", "shorthand for --database.result-granularity")
+	return func(ctx context.Context, r *runner) error {
+		if *retention != 0 {
+			r.cfg.Database.ResultRetention = config.Duration(*retention)
+		}
+		if *granularity != "" {
+			r.cfg.Database.ResultGranularity = *granularity
+		}
+		if err := r.cfg.Database.Options().Validate(); err != nil {
+			return usageError(err.Error())
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		if err := db.Migrate(ctx); err != nil {
+			return err
+		}
+		r.log.Info("Migrate complete")
+		return nil
+	}
+}
+
+func rollupCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	lookback := fs.Duration("lookback", 2*time.Hour, "recompute rollups for results newer than this, use a larger value to backfill")
+	every := fs.Duration("every", 0, "keep running and recompute rollups at this interval, e.g. 10m")
+	return func(ctx context.Context, r *runner) error {
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		if *every > 0 {
+			rollup.Schedule(ctx, db, *every, *lookback, r.log)
+			return nil
+		}
+		return rollup.Run(ctx, db, time.Now(), *lookback, r.log)
+	}
+}
+
+func configPrintCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	format := fs.String("format", "yaml", "yaml or json")
+	return func(ctx context.Context, r *runner) error {
+		if *format != "yaml" && *format != "json" {
+			return usageErrorf("unknown format %q, use yaml or json", *format)
+		}
+		if err := r.cfg.Redacted().Write(r.stdout, *format == "json"); err != nil {
+			return err
+		}
+		if r.configErr != nil {
+			return fmt.Errorf("invalid config:\n%w", r.configErr)
+		}
+		return nil
+	}
+}
+
+func versionCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	return func(ctx context.Context, r *runner) error {
+		revision := ""
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+					revision = " " + s.Value[:12]
+				}
+			}
+		}
+		fmt.Fprintf(r.stdout, "%s %s%s %s %s/%s\n", programName, version, revision, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return nil
+	}
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/rollup"
+)
+
+const (
+	defaultResultLimit = 1000
+	maxResultLimit     = 10000
+)
+
+// aggregations maps the results aggregation parameter to a bucket length,
+// raw results are not aggregated
+var aggregations = map[string]time.Duration{
+	"raw":    0,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+}
+
+// resultsResponse is the body of GET /api/v1/checks/{id}/results. Results
+// holds raw results or summaries depending on Aggregation.
+type resultsResponse struct {
+	CheckID     string      `json:"check_id"`
+	Region      string      `json:"region,omitempty"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Aggregation string      `json:"aggregation"`
+	Results     interface{} `json:"results"`
+	// NextOffset is set when there may be more results
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// uptimeResponse is the body of GET /api/v1/checks/{id}/uptime
+type uptimeResponse struct {
+	Window string `json:"window"`
+	checks.Uptime
+}
+
+// resultsHandler serves the results of a check.
+//
+// Query parameters:
+//   - from, to: RFC 3339 time range, defaults to the last hour
+//   - region: only results from this region
+//   - aggregation: raw (default), minute or hour
+//   - limit, offset: pagination, limit defaults to 1000 and is at most 10000
+func resultsHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query, err := resultQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		aggregation := params.Get("aggregation")
+		if aggregation == "" {
+			aggregation = "raw"
+		}
+		bucket, ok := aggregations[aggregation]
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown aggregation %q, must be raw, minute or hour", aggregation))
+			return
+		}
+		if query.Limit, err = intParam(params.Get("limit"), defaultResultLimit, 1, maxResultLimit); err != nil {
+			writeError(w, http.StatusBadRequest, "limit "+err.Error())
+			return
+		}
+		if query.Offset, err = intParam(params.Get("offset"), 0, 0, -1); err != nil {
+			writeError(w, http.StatusBadRequest, "offset "+err.Error())
+			return
+		}
+		if !checkExists(w, r, app, query.CheckID) {
+			return
+		}
+
+		response := resultsResponse{
+			CheckID:     query.CheckID,
+			Region:      query.Region,
+			From:        query.From,
+			To:          query.To,
+			Aggregation: aggregation,
+		}
+		count := 0
+		if bucket == 0 {
+			results, err := app.DbClient.GetStatusResults(r.Context(), query)
+			if err != nil {
+				serverError(w, app, "GetStatusResults failed.", err)
+				return
+			}
+			response.Results, count = nonNil(results), len(results)
+		} else {
+			summaries, err := app.DbClient.SummarizeStatusResults(r.Context(), query, bucket)
+			if err != nil {
+				serverError(w, app, "SummarizeStatusResults failed.", err)
+				return
+			}
+			response.Results, count = nonNil(summaries), len(summaries)
+		}
+		if count == query.Limit {
+			next := query.Offset + count
+			response.NextOffset = &next
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// uptimeHandler serves the uptime of a check over a window ending now.
+//
+// Query parameters:
+//   - window: e.g. 24h, 7d or 30d, defaults to 30d
+//   - region: only results from this region
+func uptimeHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		window := params.Get("window")
+		if window == "" {
+			window = "30d"
+		}
+		length, err := parseWindow(window)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		id := r.PathValue("id")
+		if !checkExists(w, r, app, id) {
+			return
+		}
+
+		to := time.Now().UTC()
+		uptime, err := rollup.Uptime(r.Context(), app.DbClient, data.ResultQuery{
+			CheckID: id,
+			Region:  params.Get("region"),
+			From:    to.Add(-length),
+			To:      to,
+		})
+		if err != nil {
+			serverError(w, app, "Uptime failed.", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, uptimeResponse{Window: window, Uptime: uptime})
+	}
+}
+
+// resultQuery parses the check id, region and time range of r
+func resultQuery(r *http.Request) (data.ResultQuery, error) {
+	params := r.URL.Query()
+	query := data.ResultQuery{CheckID: r.PathValue("id"), Region: params.Get("region")}
+
+	query.To = time.Now().UTC()
+	if to := params.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return query, fmt.Errorf("to must be an RFC 3339 time: %w", err)
+		}
+		query.To = t.UTC()
+	}
+	query.From = query.To.Add(-time.Hour)
+	if from := params.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return query, fmt.Errorf("from must be an RFC 3339 time: %w", err)
+		}
+		query.From = t.UTC()
+	}
+	if !query.From.Before(query.To) {
+		return query, errors.New("from must be before to")
+	}
+	return query, nil
+}
+
+// parseWindow parses a duration that may also be given in days, e.g. 30d
+func parseWindow(window string) (time.Duration, error) {
+	var length time.Duration
+	if days, ok := strings.CutSuffix(window, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", window)
+		}
+		length = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if length, err = time.ParseDuration(window); err != nil {
+			return 0, fmt.Errorf("invalid window %q", window)
+		}
+	}
+	if length <= 0 {
+		return 0, fmt.Errorf("window must be positive, got %q", window)
+	}
+	return length, nil
+}
+
+// intParam parses an integer parameter, returning def when it is empty.
+// A negative max means there is no upper bound.
+func intParam(value string, def int, min int, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer: %q", value)
+	}
+	if max < 0 && n < min {
+		return 0, fmt.Errorf("must be at least %d", min)
+	}
+	if max >= 0 && (n < min || n > max) {
+		return 0, fmt.Errorf("must be between %d and %d", min, max)
+	}
+	return n, nil
+}
+
+// checkExists writes a 404 and returns false if there is no check with id
+func checkExists(w http.ResponseWriter, r *http.Request, app *application.State, id string) bool {
+	_, err := app.DbClient.GetStatusCheck(r.Context(), id)
+	if errors.Is(err, data.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("check %q not found", id))
+		return false
+	}
+	if err != nil {
+		serverError(w, app, "GetStatusCheck failed.", err)
+		return false
+	}
+	return true
+}
+
+// nonNil returns an empty slice for nil so it encodes as [] instead of null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func serverError(w http.ResponseWriter, app *application.State, message string, err error) {
+	app.Log.Error(message, zap.String("error", err.Error()))
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
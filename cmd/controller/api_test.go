@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/test"
+)
+
+// setupApp returns a State backed by a MockDB holding test-check-1 and
+// results every 20 seconds over the last 10 minutes in two regions
+func setupApp(t *testing.T) (*application.State, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	db := &test.MockDB{}
+	db.AddCheck(checks.StatusCheck{ID: "test-check-1", Regions: []string{"us-test-1", "us-test-2"}})
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	var results []checks.StatusCheckResult
+	for i := 1; i <= 30; i++ {
+		ts := now.Add(-time.Duration(i) * 20 * time.Second)
+		for _, region := range []string{"us-test-1", "us-test-2"} {
+			code := 200
+			if region == "us-test-2" && i%3 == 0 {
+				code = 503
+			}
+			results = append(results, checks.StatusCheckResult{
+				Metadata:     checks.StatusCheckMetadata{Region: region, CheckID: "test-check-1"},
+				Timestamp:    ts,
+				ResponseID:   checks.NewResponseID(region, "test-check-1", ts),
+				ResponseCode: code,
+				TTFB:         10,
+			})
+		}
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+	return &application.State{Ctx: ctx, DbClient: db, Log: zap.NewNop()}, now
+}
+
+func get(t *testing.T, app *application.State, target string, body interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewHandler(app).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if body != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+			t.Fatalf("GET %s: decoding response: %v", target, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestResultsHandler(t *testing.T) {
+	app, now := setupApp(t)
+	from := url.QueryEscape(now.Add(-10 * time.Minute).Format(time.RFC3339))
+	to := url.QueryEscape(now.Format(time.RFC3339))
+
+	var raw struct {
+		Results    []checks.StatusCheckResult `json:"results"`
+		NextOffset *int                       `json:"next_offset"`
+	}
+	code := get(t, app, "/api/v1/checks/test-check-1/results?region=us-test-2&limit=20&from="+from+"&to="+to, &raw)
+	if code != http.StatusOK || len(raw.Results) != 20 || raw.NextOffset == nil || *raw.NextOffset != 20 {
+		t.Fatalf("first page. Want: 200, 20 results, next_offset 20 Got: %d, %d, %v", code, len(raw.Results), raw.NextOffset)
+	}
+	raw.Results, raw.NextOffset = nil, nil
+	get(t, app, "/api/v1/checks/test-check-1/results?region=us-test-2&limit=20&offset=20&from="+from+"&to="+to, &raw)
+	if len(raw.Results) != 10 || raw.NextOffset != nil {
+		t.Fatalf("last page. Want: 10 results, no next_offset Got: %d, %v", len(raw.Results), raw.NextOffset)
+	}
+	for _, r := range raw.Results {
+		if r.Metadata.Region != "us-test-2" {
+			t.Fatalf("region filter. Want: us-test-2 Got: %s", r.Metadata.Region)
+		}
+	}
+
+	var minutes struct {
+		Results []checks.StatusCheckSummary `json:"results"`
+	}
+	get(t, app, "/api/v1/checks/test-check-1/results?aggregation=minute&region=us-test-2&from="+from+"&to="+to, &minutes)
+	if len(minutes.Results) != 10 {
+		t.Fatalf("minute aggregation. Want: 10 buckets Got: %d", len(minutes.Results))
+	}
+	for _, s := range minutes.Results {
+		if s.Count != 3 || s.Failures != 1 {
+			t.Fatalf("minute bucket. Want: 3 results, 1 failure Got: %+v", s)
+		}
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/v1/checks/missing/results", http.StatusNotFound},
+		{"/api/v1/checks/test-check-1/results?aggregation=week", http.StatusBadRequest},
+		{"/api/v1/checks/test-check-1/results?from=yesterday", http.StatusBadRequest},
+		{"/api/v1/checks/test-check-1/results?from=" + to + "&to=" + from, http.StatusBadRequest},
+		{"/api/v1/checks/test-check-1/results?limit=100000", http.StatusBadRequest},
+		{"/api/v1/checks/test-check-1/results?offset=-1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code := get(t, app, tt.target, nil); code != tt.want {
+			t.Fatalf("GET %s. Want: %d Got: %d", tt.target, tt.want, code)
+		}
+	}
+}
+
+func TestUptimeHandler(t *testing.T) {
+	app, _ := setupApp(t)
+
+	var uptime uptimeResponse
+	if code := get(t, app, "/api/v1/checks/test-check-1/uptime", &uptime); code != http.StatusOK {
+		t.Fatalf("uptime. Want: 200 Got: %d", code)
+	}
+	if uptime.Window != "30d" || uptime.Count != 60 || uptime.Failures != 10 {
+		t.Fatalf("uptime. Want: 30d, 60 results, 10 failures Got: %+v", uptime)
+	}
+
+	uptime = uptimeResponse{}
+	get(t, app, "/api/v1/checks/test-check-1/uptime?window=24h&region=us-test-1", &uptime)
+	if uptime.Count != 30 || uptime.UptimePercent != 100 {
+		t.Fatalf("region uptime. Want: 30 results, 100%% Got: %+v", uptime)
+	}
+
+	for _, target := range []string{
+		"/api/v1/checks/test-check-1/uptime?window=soon",
+		"/api/v1/checks/test-check-1/uptime?window=-1d",
+	} {
+		if code := get(t, app, target, nil); code != http.StatusBadRequest {
+			t.Fatalf("GET %s. Want: 400 Got: %d", target, code)
+		}
+	}
+	if code := get(t, app, "/api/v1/checks/missing/uptime", nil); code != http.StatusNotFound {
+		t.Fatalf("missing check. Want: 404 Got: %d", code)
+	}
+}
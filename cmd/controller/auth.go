@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/pki"
+	"go.uber.org/zap"
+)
+
+// requireScope wraps next so it only runs for requests with a valid api
+// token that has one of scopes. Requests without a token get 401, tokens
+// without the scope get 403. A worker client certificate counts as the
+// worker scope. Every request is allowed when Config.Auth is off, but only
+// a verified certificate or token is granted the worker scope, see
+// fromWorker. The request context of a tenant's token is restricted to the
+// tenant.
+func requireScope(app *application.State, next http.HandlerFunc, scopes ...auth.Scope) http.HandlerFunc {
+	worker := slices.Contains(scopes, auth.ScopeWorker)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := certRegion(r); ok && worker {
+			next(w, r.WithContext(context.WithValue(r.Context(), workerKey{}, true)))
+			return
+		}
+		if !app.Config.Auth {
+			next(w, r)
+			return
+		}
+		token, err := authenticate(r, app.DbClient, time.Now())
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpired):
+			app.Log.Info("Rejected api request", zap.String("path", r.URL.Path), zap.String("reason", err.Error()))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="status"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		case err != nil:
+			serverError(w, app, "GetToken failed.", err)
+			return
+		}
+		for _, scope := range scopes {
+			if token.Allows(scope) {
+				if token.Tenant != "" {
+					r = r.WithContext(data.WithTenant(r.Context(), token.Tenant))
+				}
+				if worker && token.Allows(auth.ScopeWorker) {
+					r = r.WithContext(context.WithValue(r.Context(), workerKey{}, true))
+				}
+				next(w, r)
+				return
+			}
+		}
+		app.Log.Info("Rejected api request", zap.String("path", r.URL.Path), zap.String("token_id", token.ID),
+			zap.String("reason", "missing scope"))
+		writeError(w, http.StatusForbidden, "token needs scope "+string(scopes[0]))
+	}
+}
+
+type workerKey struct{}
+
+// fromWorker reports whether requireScope granted r the worker scope. Only
+// workers get checks with their credentials, everyone else sees them
+// Redacted. Redacted checks are never pushed to workers, see
+// regionChecksStreamHandler.
+func fromWorker(r *http.Request) bool {
+	worker, _ := r.Context().Value(workerKey{}).(bool)
+	return worker
+}
+
+// certRegion returns the region of the request's verified worker client
+// certificate
+func certRegion(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	return pki.WorkerRegion(r.TLS.VerifiedChains[0][0])
+}
+
+// allowedRegion writes 403 and returns false when the request has a worker
+// client certificate for another region than region
+func allowedRegion(w http.ResponseWriter, r *http.Request, region string) bool {
+	if certRegion, ok := certRegion(r); ok && certRegion != region {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("certificate is for region %q", certRegion))
+		return false
+	}
+	return true
+}
+
+// sharedOnly writes 403 and returns false when the request is restricted
+// to a tenant, workers are shared by all tenants so only operators can
+// change them
+func sharedOnly(w http.ResponseWriter, r *http.Request) bool {
+	if tenant, ok := data.TenantFrom(r.Context()); ok {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("tenant %q can not change workers", tenant))
+		return false
+	}
+	return true
+}
+
+// workerOnly writes 403 and returns false when requireScope did not grant
+// the request the worker scope, see fromWorker
+func workerOnly(w http.ResponseWriter, r *http.Request) bool {
+	if !fromWorker(r) {
+		writeError(w, http.StatusForbidden, "only workers can use this api")
+		return false
+	}
+	return true
+}
+
+// public wraps next, a page anyone can see without a token, so it only
+// shows the default tenant's checks
+func public(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(data.WithTenant(r.Context(), "")))
+	}
+}
+
+// authenticate returns the token of r's Authorization: Bearer header
+func authenticate(r *http.Request, db data.Database, now time.Time) (auth.Token, error) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+	id, secret, err := auth.ParseToken(strings.TrimSpace(bearer))
+	if err != nil {
+		return auth.Token{}, err
+	}
+	token, err := db.GetToken(r.Context(), id)
+	if errors.Is(err, data.ErrNotFound) {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return auth.Token{}, err
+	}
+	return token, token.Verify(secret, now)
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/pki"
+)
+
+func TestRequireScope(t *testing.T) {
+	app, _ := setupApp(t)
+	app.Config.Auth = true
+	now := time.Now()
+	newToken := func(expires time.Time, scopes ...auth.Scope) string {
+		t.Helper()
+		token, secret, err := auth.NewToken("test", scopes, now, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.DbClient.CreateToken(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+	worker := newToken(time.Time{}, auth.ScopeWorker)
+	reader := newToken(time.Time{}, auth.ScopeResultsRead, auth.ScopeChecksRead)
+	expired := newToken(now.Add(-time.Minute), auth.ScopeResultsRead)
+
+	tests := []struct {
+		method, target, token string
+		code                  int
+	}{
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", "st_nope_secret", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", worker + "0", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", worker, http.StatusOK},
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", reader, http.StatusOK},
+		{http.MethodPut, "/api/v1/workers/w1", worker, http.StatusOK},
+		{http.MethodPut, "/api/v1/workers/w1", reader, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/checks/test-check-1/uptime", worker, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/checks/test-check-1/uptime", reader, http.StatusOK},
+		{http.MethodGet, "/api/v1/checks/test-check-1/uptime", expired, http.StatusUnauthorized},
+		{http.MethodDelete, "/api/v1/workers/w1", reader, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/regions/us-test-1/workers", reader, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/regions/us-test-1/workers", worker, http.StatusOK},
+		// the status page and badges stay public
+		{http.MethodGet, "/", "", http.StatusOK},
+		{http.MethodGet, "/badge/test-check-1.svg", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"region": "us-test-1"}`))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		NewHandler(app).ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s %s. Want: %d Got: %d %s", tt.method, tt.target, tt.code, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	app, _ := setupApp(t)
+	app.Config.Auth = true
+	now := time.Now()
+	ca, err := pki.NewCA("test CA", now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(NewHandler(app))
+	srv.TLS = &tls.Config{ClientCAs: x509.NewCertPool(), ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.TLS.ClientCAs.AddCert(ca.Cert)
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert, key, err := ca.IssueWorker("worker-1", "us-test-1", now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{
+		{Certificate: [][]byte{cert.Raw}, PrivateKey: key},
+	}
+
+	tests := []struct {
+		method, target, body string
+		code                 int
+	}{
+		// the certificate is a worker credential for its own region only
+		{http.MethodGet, "/api/v1/regions/us-test-1/checks", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/regions/us-test-2/checks", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/regions/us-test-2/checks/stream", "", http.StatusForbidden},
+		{http.MethodPut, "/api/v1/workers/w1", `{"region": "us-test-1"}`, http.StatusOK},
+		{http.MethodPut, "/api/v1/workers/w2", `{"region": "us-test-2"}`, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/regions/us-test-1/workers", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/regions/us-test-2/workers", "", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/regions/us-test-2/results", "[]", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/regions/us-test-2/secrets/api-key", "", http.StatusForbidden},
+		// and nothing else
+		{http.MethodGet, "/api/v1/checks/test-check-1/uptime", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.target, strings.NewReader(tt.body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s. Want: %d Got: %d", tt.method, tt.target, tt.code, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/badge"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/rollup"
+	"github.com/larntz/status/internal/statuspage"
+)
+
+// stateColors maps check states to badge colors
+var stateColors = map[statuspage.State]string{
+	statuspage.StateUp:       badge.Green,
+	statuspage.StateDegraded: badge.Yellow,
+	statuspage.StateDown:     badge.Red,
+	statuspage.StateUnknown:  badge.Grey,
+}
+
+// statusBadgeHandler serves GET /badge/{check_id}.svg, a badge with the
+// current state of the check. The label defaults to the check name and
+// can be set with ?label=.
+func statusBadgeHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(r.PathValue("file"), ".svg")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		check, ok := badgeCheck(w, r, app, id)
+		if !ok {
+			return
+		}
+		now := time.Now().UTC()
+		offline, err := statuspage.OfflineRegions(r.Context(), app.DbClient, now, time.Duration(app.Config.WorkerTimeout))
+		if err != nil {
+			badgeError(w, app, "OfflineRegions failed.", err)
+			return
+		}
+		state, err := statuspage.CurrentState(r.Context(), app.DbClient, check, now, offline)
+		if err != nil {
+			badgeError(w, app, "CurrentState failed.", err)
+			return
+		}
+		label := r.URL.Query().Get("label")
+		if label == "" {
+			label = check.Name
+		}
+		if label == "" {
+			label = check.ID
+		}
+		writeBadge(w, http.StatusOK, badge.Render(label, string(state.State), stateColors[state.State]))
+	}
+}
+
+// uptimeBadgeHandler serves GET /badge/{check_id}/uptime.svg, a badge with
+// the uptime of the check over ?window=, 7d by default
+func uptimeBadgeHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window := r.URL.Query().Get("window")
+		if window == "" {
+			window = "7d"
+		}
+		length, err := parseWindow(window)
+		if err != nil {
+			writeBadge(w, http.StatusBadRequest, badge.Render("uptime", "invalid window", badge.Grey))
+			return
+		}
+		check, ok := badgeCheck(w, r, app, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		to := time.Now().UTC()
+		uptime, err := rollup.Uptime(r.Context(), app.DbClient, data.ResultQuery{
+			CheckID: check.ID,
+			From:    to.Add(-length),
+			To:      to,
+		})
+		if err != nil {
+			badgeError(w, app, "Uptime failed.", err)
+			return
+		}
+		label := r.URL.Query().Get("label")
+		if label == "" {
+			label = "uptime " + window
+		}
+		if uptime.Count == 0 {
+			writeBadge(w, http.StatusOK, badge.Render(label, "no data", badge.Grey))
+			return
+		}
+		message := fmt.Sprintf("%.2f%%", uptime.UptimePercent)
+		writeBadge(w, http.StatusOK, badge.Render(label, message, badge.UptimeColor(uptime.UptimePercent)))
+	}
+}
+
+// badgeCheck returns the check with id, writing a not found badge and
+// returning false if it does not exist
+func badgeCheck(w http.ResponseWriter, r *http.Request, app *application.State, id string) (checks.StatusCheck, bool) {
+	check, err := app.DbClient.GetStatusCheck(r.Context(), id)
+	if errors.Is(err, data.ErrNotFound) {
+		writeBadge(w, http.StatusNotFound, badge.Render("status", "not found", badge.Grey))
+		return check, false
+	}
+	if err != nil {
+		badgeError(w, app, "GetStatusCheck failed.", err)
+		return check, false
+	}
+	return check, true
+}
+
+func badgeError(w http.ResponseWriter, app *application.State, message string, err error) {
+	app.Log.Error(message, zap.String("error", err.Error()))
+	writeBadge(w, http.StatusInternalServerError, badge.Render("status", "error", badge.Grey))
+}
+
+// writeBadge writes an svg badge. Badges are cached briefly so embedding
+// them in busy pages does not query the database on every view.
+func writeBadge(w http.ResponseWriter, status int, svg []byte) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.WriteHeader(status)
+	w.Write(svg)
+}
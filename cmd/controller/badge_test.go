@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+func TestBadgeHandlers(t *testing.T) {
+	app, _ := setupApp(t)
+
+	tests := []struct {
+		target string
+		status int
+		want   []string
+	}{
+		// us-test-2 fails every third result, its latest result is up
+		{"/badge/test-check-1.svg", http.StatusOK, []string{">test-check-1<", ">up<"}},
+		{"/badge/test-check-1.svg?label=api", http.StatusOK, []string{">api<"}},
+		{"/badge/test-check-1/uptime.svg", http.StatusOK, []string{">uptime 7d<", ">83.33%<"}},
+		{"/badge/test-check-1/uptime.svg?window=30d&label=30+days", http.StatusOK, []string{">30 days<"}},
+		{"/badge/test-check-1/uptime.svg?window=never", http.StatusBadRequest, []string{">invalid window<"}},
+		{"/badge/missing.svg", http.StatusNotFound, []string{">not found<"}},
+		{"/badge/missing/uptime.svg", http.StatusNotFound, []string{">not found<"}},
+		{"/badge/test-check-1.png", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		NewHandler(app).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Fatalf("GET %s. Want: %d Got: %d", tt.target, tt.status, rec.Code)
+		}
+		if tt.want == nil {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "image/svg+xml" {
+			t.Fatalf("GET %s content type. Want: image/svg+xml Got: %s", tt.target, ct)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Fatalf("GET %s missing %q:\n%s", tt.target, want, rec.Body.String())
+			}
+		}
+	}
+
+	// badges do not show other tenants' checks
+	private := checks.StatusCheck{ID: "private", URL: "https://private.example.com", Regions: []string{"us-test-1"},
+		Interval: 60, HTTPTimeout: 10, Serial: 1, Active: true}
+	if err := app.DbClient.CreateStatusCheck(data.WithTenant(context.Background(), "team-a"), private); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/badge/private.svg", "/badge/private/uptime.svg"} {
+		rec := httptest.NewRecorder()
+		NewHandler(app).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s of another tenant's check. Want: 404 Got: %d", target, rec.Code)
+		}
+	}
+
+	// the check shows unknown once every region's workers have stopped
+	for _, region := range []string{"us-test-1", "us-test-2"} {
+		app.DbClient.SaveWorker(context.Background(), checks.Worker{ID: region, Region: region, LastSeen: time.Now(), Stopped: true})
+	}
+	rec := httptest.NewRecorder()
+	NewHandler(app).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/badge/test-check-1.svg", nil))
+	if !strings.Contains(rec.Body.String(), ">unknown<") {
+		t.Fatalf("offline regions. Want: unknown Got:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checkconfig"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// maxCheckBody limits the size of a check in PUT /api/v1/checks/{id}
+const maxCheckBody = 64 << 10
+
+// checkResponse is a check in the check file format plus the fields the
+// controller manages
+type checkResponse struct {
+	checkconfig.Check
+	Tenant   string    `json:"tenant,omitempty"`
+	Modified time.Time `json:"modified"`
+	Serial   uint64    `json:"serial"`
+}
+
+// newCheckResponse returns c with its credentials Redacted, api clients
+// only see secret references
+func newCheckResponse(c checks.StatusCheck) checkResponse {
+	c = c.Redacted()
+	return checkResponse{Check: checkconfig.FromStatusCheck(c), Tenant: c.Tenant, Modified: c.Modified, Serial: c.Serial}
+}
+
+// listChecksHandler serves the checks the token's tenant can see
+func listChecksHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statusChecks, err := app.DbClient.ListStatusChecks(r.Context())
+		if err != nil {
+			serverError(w, app, "ListStatusChecks failed.", err)
+			return
+		}
+		response := make([]checkResponse, len(statusChecks))
+		for i, c := range statusChecks {
+			response[i] = newCheckResponse(c)
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// getCheckHandler serves one check
+func getCheckHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		check, err := app.DbClient.GetStatusCheck(r.Context(), id)
+		if errors.Is(err, data.ErrNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("check %q not found", id))
+			return
+		}
+		if err != nil {
+			serverError(w, app, "GetStatusCheck failed.", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newCheckResponse(check))
+	}
+}
+
+// putCheckHandler creates or replaces a check. The body is a check in the
+// check file format, a check that would exceed the tenant's quota gets 403.
+// Credentials Redacted by GET are kept as stored, a redacted credential
+// the stored check does not have gets 400.
+func putCheckHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var c checkconfig.Check
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxCheckBody)).Decode(&c); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid check: %s", err))
+			return
+		}
+		id := r.PathValue("id")
+		if c.ID != "" && c.ID != id {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("check id %q does not match the url", c.ID))
+			return
+		}
+		c.ID = id
+		if err := c.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, strings.ReplaceAll(err.Error(), "\n", "; "))
+			return
+		}
+
+		check := c.StatusCheck()
+		check.Modified = time.Now().UTC()
+		existing, err := app.DbClient.GetStatusCheck(r.Context(), id)
+		switch {
+		case errors.Is(err, data.ErrNotFound):
+		case err != nil:
+			serverError(w, app, "GetStatusCheck failed.", err)
+			return
+		default:
+			check.Serial, check.Tenant = existing.Serial, existing.Tenant
+		}
+		// a check edited from a GET has its credentials redacted, keep the
+		// stored ones rather than saving the placeholder
+		if check, err = check.Unredacted(existing); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		check.Serial++
+
+		var quota *checks.QuotaError
+		if err := data.CheckQuota(r.Context(), app.DbClient, check); errors.As(err, &quota) {
+			writeError(w, http.StatusForbidden, quota.Error())
+			return
+		} else if err != nil {
+			serverError(w, app, "CheckQuota failed.", err)
+			return
+		}
+
+		status := http.StatusOK
+		if check.Serial == 1 {
+			status = http.StatusCreated
+			err = app.DbClient.CreateStatusCheck(r.Context(), check)
+		} else {
+			err = app.DbClient.UpdateStatusCheck(r.Context(), check)
+		}
+		// the check was created or deleted since it was read
+		if errors.Is(err, data.ErrExists) || errors.Is(err, data.ErrNotFound) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("check %q changed, try again", id))
+			return
+		}
+		if err != nil {
+			serverError(w, app, "Saving check failed.", err)
+			return
+		}
+		if tenant, ok := data.TenantFrom(r.Context()); ok {
+			check.Tenant = tenant
+		}
+		app.Log.Info("Check saved", zap.String("check_id", id), zap.String("tenant", check.Tenant),
+			zap.Uint64("serial", check.Serial))
+		writeJSON(w, status, newCheckResponse(check))
+	}
+}
+
+// deleteCheckHandler removes a check, its results are kept
+func deleteCheckHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := app.DbClient.DeleteStatusCheck(r.Context(), id)
+		if errors.Is(err, data.ErrNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("check %q not found", id))
+			return
+		}
+		if err != nil {
+			serverError(w, app, "DeleteStatusCheck failed.", err)
+			return
+		}
+		app.Log.Info("Check removed", zap.String("check_id", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
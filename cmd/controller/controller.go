@@ -2,30 +2,111 @@
 package controller
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/larntz/status/internal/application"
-	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/pki"
+	"github.com/larntz/status/internal/statuspage"
 	"go.uber.org/zap"
 )
 
-// StartController runs the controller
-func StartController(app *application.State) {
+// StartController runs the controller until app.Ctx is cancelled. It
+// serves https when Config.TLSCert is set.
+func StartController(app *application.State) error {
+	server := &http.Server{
+		Addr:              app.Config.Addr,
+		Handler:           NewHandler(app),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if app.Config.TLSCert != "" {
+		tlsConfig, err := pki.ServerConfig(app.Config.TLSCert, app.Config.TLSKey, app.Config.ClientCA)
+		if err != nil {
+			return fmt.Errorf("controller tls: %w", err)
+		}
+		server.TLSConfig = tlsConfig
+	}
+	go func() {
+		<-app.Ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
 
-	// handle route using handler function
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		region := "us-east-1"
-		checks := data.GetChecks(app.DbClient, region, app.Log)
-		app.Log.Info("Loaded checks", zap.Int("check_count", len(checks.StatusChecks)), zap.String("region", region))
-		response, err := json.Marshal(checks)
+	app.Log.Info("controller listening", zap.String("addr", server.Addr), zap.Bool("tls", server.TLSConfig != nil),
+		zap.Bool("client_certs", app.Config.ClientCA != ""))
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NewHandler returns the controller's routes
+func NewHandler(app *application.State) http.Handler {
+	mux := http.NewServeMux()
+
+	// the status page and badges are public, see public
+	page := &statuspage.Handler{DB: app.DbClient, Log: app.Log, CacheTTL: 30 * time.Second,
+		WorkerTimeout: time.Duration(app.Config.WorkerTimeout)}
+	mux.HandleFunc("GET /{$}", public(page.ServeHTTP))
+	mux.Handle("GET /static/", statuspage.Static())
+
+	regionChecks := func(w http.ResponseWriter, r *http.Request) {
+		region := r.PathValue("region")
+		if !allowedRegion(w, r, region) {
+			return
+		}
+		checks, err := app.DbClient.GetRegionChecks(r.Context(), region)
 		if err != nil {
-			app.Log.Error("error marshalling check")
+			serverError(w, app, "GetRegionChecks failed.", err)
+			return
 		}
-		fmt.Fprintf(w, string(response))
-	})
+		app.Log.Info("Loaded checks", zap.Int("check_count", len(checks.StatusChecks)), zap.String("region", region))
+		if !fromWorker(r) {
+			checks = checks.Redacted()
+		}
+		writeJSON(w, http.StatusOK, checks)
+	}
+	watcher := newCheckWatcher(app.DbClient, time.Duration(app.Config.WatchInterval), app.Log)
+
+	// the api needs a token unless auth is off, workers get their own
+	// tokens with only the worker scope or a client certificate
+	mux.HandleFunc("GET /api/v1/regions/{region}/checks",
+		requireScope(app, regionChecks, auth.ScopeWorker, auth.ScopeChecksRead))
+	mux.HandleFunc("GET /api/v1/regions/{region}/checks/stream",
+		requireScope(app, regionChecksStreamHandler(app, watcher), auth.ScopeWorker, auth.ScopeChecksRead))
+	// workers without a database connection load checks above and use
+	// these instead of the database
+	mux.HandleFunc("GET /api/v1/regions/{region}/workers",
+		requireScope(app, regionWorkersHandler(app), auth.ScopeWorker))
+	mux.HandleFunc("POST /api/v1/regions/{region}/results",
+		requireScope(app, regionResultsHandler(app), auth.ScopeWorker))
+	mux.HandleFunc("GET /api/v1/regions/{region}/secrets/{name}",
+		requireScope(app, regionSecretHandler(app), auth.ScopeWorker))
+	mux.HandleFunc("GET /api/v1/checks", requireScope(app, listChecksHandler(app), auth.ScopeChecksRead))
+	mux.HandleFunc("GET /api/v1/checks/{id}", requireScope(app, getCheckHandler(app), auth.ScopeChecksRead))
+	mux.HandleFunc("PUT /api/v1/checks/{id}", requireScope(app, putCheckHandler(app), auth.ScopeChecksWrite))
+	mux.HandleFunc("DELETE /api/v1/checks/{id}", requireScope(app, deleteCheckHandler(app), auth.ScopeChecksWrite))
+	mux.HandleFunc("GET /api/v1/checks/{id}/results", requireScope(app, resultsHandler(app), auth.ScopeResultsRead))
+	mux.HandleFunc("GET /api/v1/checks/{id}/uptime", requireScope(app, uptimeHandler(app), auth.ScopeResultsRead))
+	mux.HandleFunc("GET /api/v1/results/stream",
+		requireScope(app, resultsStreamHandler(app, streamPoll), auth.ScopeResultsRead))
+	mux.HandleFunc("GET /api/v1/workers", requireScope(app, workersHandler(app), auth.ScopeChecksRead))
+	mux.HandleFunc("PUT /api/v1/workers/{id}", requireScope(app, registerWorkerHandler(app), auth.ScopeWorker))
+	mux.HandleFunc("DELETE /api/v1/workers/{id}", requireScope(app, deleteWorkerHandler(app), auth.ScopeChecksWrite))
 
-	// listen to port
-	http.ListenAndServe("127.0.0.1:4242", nil)
+	// patterns can not match part of a segment so {file} is {check_id}.svg
+	mux.HandleFunc("GET /badge/{file}", public(statusBadgeHandler(app)))
+	mux.HandleFunc("GET /badge/{id}/uptime.svg", public(uptimeBadgeHandler(app)))
+	return mux
 }
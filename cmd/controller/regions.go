@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// maxResultsBody limits the size of a batch of results, a worker sends
+// at most worker.result_buffer results at once
+const maxResultsBody = 64 << 20
+
+// sendResultsResponse is the body of POST
+// /api/v1/regions/{region}/results. Failed lists the indexes of the
+// results that were not written when the database only wrote some of them.
+type sendResultsResponse struct {
+	Inserted int    `json:"inserted"`
+	Failed   []int  `json:"failed,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// sealedSecret is a secret with its sealed value, only workers have the
+// key that opens it
+type sealedSecret struct {
+	checks.Secret
+	Value string `json:"value"`
+}
+
+// regionWorkersHandler serves the registered workers of a region, the
+// workers of a region share its checks
+func regionWorkersHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region := r.PathValue("region")
+		if !workerOnly(w, r) || !allowedRegion(w, r, region) {
+			return
+		}
+		workers, err := app.DbClient.ListWorkers(r.Context())
+		if err != nil {
+			serverError(w, app, "ListWorkers failed.", err)
+			return
+		}
+		regionWorkers := []checks.Worker{}
+		for _, worker := range workers {
+			if worker.Region == region {
+				regionWorkers = append(regionWorkers, worker)
+			}
+		}
+		writeJSON(w, http.StatusOK, regionWorkers)
+	}
+}
+
+// regionResultsHandler writes the results of a region's checks for
+// workers without a database connection. The body is a list of results,
+// every result must be for a check assigned to the region.
+func regionResultsHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region := r.PathValue("region")
+		if !workerOnly(w, r) || !allowedRegion(w, r, region) {
+			return
+		}
+		var results []checks.StatusCheckResult
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxResultsBody)).Decode(&results); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid results: %s", err))
+			return
+		}
+		regionChecks, err := app.DbClient.GetRegionChecks(r.Context(), region)
+		if err != nil {
+			serverError(w, app, "GetRegionChecks failed.", err)
+			return
+		}
+		assigned := make(map[checks.StatusCheckMetadata]bool, len(regionChecks.StatusChecks))
+		for _, c := range regionChecks.StatusChecks {
+			assigned[checks.StatusCheckMetadata{Region: region, CheckID: c.ID, Tenant: c.Tenant}] = true
+		}
+		for _, result := range results {
+			if !assigned[result.Metadata] {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("check %q is not assigned to region %q",
+					result.Metadata.CheckID, region))
+				return
+			}
+		}
+
+		inserted, err := app.DbClient.SendStatusResults(r.Context(), results)
+		var pwe *data.PartialWriteError
+		if errors.As(err, &pwe) {
+			app.Log.Error("SendStatusResults failed.", zap.String("error", err.Error()), zap.String("region", region))
+			writeJSON(w, http.StatusInternalServerError, sendResultsResponse{Inserted: inserted, Failed: pwe.Failed,
+				Error: "results not written"})
+			return
+		}
+		if err != nil {
+			serverError(w, app, "SendStatusResults failed.", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sendResultsResponse{Inserted: inserted})
+	}
+}
+
+// regionSecretHandler serves a sealed secret to the workers of a region
+// that has checks of the secret's tenant, the tenant query parameter
+func regionSecretHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region, name, tenant := r.PathValue("region"), r.PathValue("name"), r.URL.Query().Get("tenant")
+		if !workerOnly(w, r) || !allowedRegion(w, r, region) {
+			return
+		}
+		regionChecks, err := app.DbClient.GetRegionChecks(data.WithTenant(r.Context(), tenant), region)
+		if err != nil {
+			serverError(w, app, "GetRegionChecks failed.", err)
+			return
+		}
+		secret, err := app.DbClient.GetSecret(r.Context(), tenant, name)
+		if errors.Is(err, data.ErrNotFound) || (err == nil && len(regionChecks.StatusChecks) == 0) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("secret %q not found", name))
+			return
+		}
+		if err != nil {
+			serverError(w, app, "GetSecret failed.", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sealedSecret{Secret: secret, Value: secret.Value})
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/test"
+)
+
+func TestRegionWorkerAPI(t *testing.T) {
+	app, _ := setupApp(t)
+	app.Config.Auth = true
+	ctx := context.Background()
+	db := app.DbClient.(*test.MockDB)
+	db.AddCheck(checks.StatusCheck{ID: "a-1", Tenant: "team-a", Regions: []string{"us-test-2"}})
+	for _, s := range []checks.Secret{{Name: "api-key", Value: "sealed"}, {Name: "api-key", Tenant: "team-a", Value: "sealed-a"}} {
+		if err := db.SaveSecret(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, worker, err := auth.NewToken("", []auth.Scope{auth.ScopeWorker}, time.Now(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	result := func(region, tenant, id string) string {
+		ts := time.Now().UTC()
+		b, _ := json.Marshal(checks.StatusCheckResult{Metadata: checks.StatusCheckMetadata{Region: region, CheckID: id, Tenant: tenant},
+			Timestamp: ts, ResponseID: checks.NewResponseID(region, id, ts), ResponseCode: 200})
+		return "[" + string(b) + "]"
+	}
+
+	tests := []struct {
+		method, target, body string
+		code                 int
+		output               string
+	}{
+		{http.MethodPost, "/api/v1/regions/us-test-1/results", result("us-test-1", "", "test-check-1"), http.StatusOK, `"inserted":1`},
+		// only results of the region's checks are taken
+		{http.MethodPost, "/api/v1/regions/us-test-1/results", result("us-test-2", "", "test-check-1"), http.StatusBadRequest, "not assigned"},
+		{http.MethodPost, "/api/v1/regions/us-test-1/results", result("us-test-1", "team-a", "a-1"), http.StatusBadRequest, "not assigned"},
+		{http.MethodPost, "/api/v1/regions/us-test-1/results", "{", http.StatusBadRequest, "invalid results"},
+		// the sealed secrets of the tenants with checks in the region
+		{http.MethodGet, "/api/v1/regions/us-test-1/secrets/api-key", "", http.StatusOK, `"value":"sealed"`},
+		{http.MethodGet, "/api/v1/regions/us-test-2/secrets/api-key?tenant=team-a", "", http.StatusOK, `"value":"sealed-a"`},
+		{http.MethodGet, "/api/v1/regions/us-test-1/secrets/api-key?tenant=team-a", "", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/api/v1/regions/us-test-1/secrets/other", "", http.StatusNotFound, "not found"},
+		{http.MethodGet, "/api/v1/regions/us-test-1/workers", "", http.StatusOK, "[]"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+worker)
+		rec := httptest.NewRecorder()
+		NewHandler(app).ServeHTTP(rec, req)
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.output) {
+			t.Errorf("%s %s. Want: %d %q Got: %d %s", tt.method, tt.target, tt.code, tt.output, rec.Code, rec.Body)
+		}
+	}
+
+	// with auth off only a client certificate makes a request a worker's
+	app.Config.Auth = false
+	rec := httptest.NewRecorder()
+	NewHandler(app).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/regions/us-test-1/secrets/api-key", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("secret without auth. Want: 403 Got: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/sse"
+)
+
+const (
+	// streamPoll is how often a results stream looks for new results
+	streamPoll = 2 * time.Second
+	// streamKeepAlive is how often an idle stream sends a comment so
+	// proxies keep the connection open
+	streamKeepAlive = 15 * time.Second
+)
+
+// resultsStreamHandler streams results as server-sent events. Each result
+// is a "result" event with the result as JSON data and the newest result
+// timestamp sent so far as the event id. Results can arrive late, so a
+// client that reconnects with Last-Event-ID gets the results from
+// data.TailLag before it again and skips response ids it has seen.
+//
+// Query parameters:
+//   - check: only results for this check
+//   - region: only results from this region
+//   - since: also send results newer than this, e.g. 15m or 1d, by default
+//     only new results are sent
+//   - follow: false closes the stream after the results since then
+func resultsStreamHandler(app *application.State, poll time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query := data.ResultQuery{CheckID: params.Get("check"), Region: params.Get("region"), From: time.Now().UTC()}
+		if since := params.Get("since"); since != "" {
+			length, err := parseWindow(since)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "since "+err.Error())
+				return
+			}
+			query.From = query.From.Add(-length)
+		}
+		if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+			last, err := time.Parse(time.RFC3339Nano, lastID)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Last-Event-ID must be an RFC 3339 time")
+				return
+			}
+			query.From = last.UTC().Add(-data.TailLag)
+		}
+		follow := true
+		if value := params.Get("follow"); value != "" {
+			var err error
+			if follow, err = strconv.ParseBool(value); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("follow must be true or false, got %q", value))
+				return
+			}
+		}
+		if query.CheckID != "" && !checkExists(w, r, app, query.CheckID) {
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			app.Log.Error("Results stream can not flush.", zap.String("error", err.Error()))
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		results := make(chan checks.StatusCheckResult)
+		done := make(chan error, 1)
+		go func() {
+			done <- data.TailStatusResults(ctx, app.DbClient, query, follow, poll, func(result checks.StatusCheckResult) error {
+				select {
+				case results <- result:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		var latest time.Time
+		for {
+			var err error
+			select {
+			case result := <-results:
+				if result.Timestamp.After(latest) {
+					latest = result.Timestamp
+				}
+				err = writeEvent(w, latest, result)
+			case <-keepAlive.C:
+				err = sse.WriteComment(w, "keep-alive")
+			case <-app.Ctx.Done():
+				return
+			case err := <-done:
+				if err != nil && ctx.Err() == nil {
+					app.Log.Error("Results stream failed.", zap.String("error", err.Error()))
+					sse.Write(w, sse.Event{Type: "error", Data: `{"error":"internal error"}`})
+					rc.Flush()
+				}
+				return
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				// the client went away
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes result as a server-sent event with id latest
+func writeEvent(w http.ResponseWriter, latest time.Time, result checks.StatusCheckResult) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return sse.Write(w, sse.Event{Type: "result", ID: latest.UTC().Format(time.RFC3339Nano), Data: string(b)})
+}
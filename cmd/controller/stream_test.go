@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/sse"
+	"github.com/larntz/status/internal/test"
+)
+
+// readEvents returns the result events read from body until it ends or n
+// events were read
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) ([]checks.StatusCheckResult, []string) {
+	t.Helper()
+	var results []checks.StatusCheckResult
+	var ids []string
+	for (n < 0 || len(results) < n) && scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			ids = append(ids, value)
+		case "data":
+			var result checks.StatusCheckResult
+			if err := json.Unmarshal([]byte(value), &result); err != nil {
+				t.Fatalf("decoding event %q: %v", value, err)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, ids
+}
+
+func TestResultsStreamHandler(t *testing.T) {
+	app, now := setupApp(t)
+	srv := httptest.NewServer(resultsStreamHandler(app, time.Millisecond))
+	defer srv.Close()
+
+	// a reconnect resends the results from TailLag before Last-Event-ID
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?follow=false&region=us-test-1", nil)
+	req.Header.Set("Last-Event-ID", now.Add(-time.Minute).Format(time.RFC3339Nano))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response. Want: 200 text/event-stream Got: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	results, ids := readEvents(t, bufio.NewScanner(resp.Body), -1)
+	resp.Body.Close()
+	if len(results) != 9 || len(ids) != 9 {
+		t.Fatalf("results since Last-Event-ID. Want: 9 Got: %d results %d ids", len(results), len(ids))
+	}
+	for _, r := range results {
+		if r.Metadata.Region != "us-test-1" || r.Timestamp.Before(now.Add(-3*time.Minute)) {
+			t.Fatalf("result outside the query: %+v", r)
+		}
+	}
+	if want := now.Add(-20 * time.Second).Format(time.RFC3339Nano); ids[len(ids)-1] != want {
+		t.Fatalf("last event id. Want: %s Got: %s", want, ids[len(ids)-1])
+	}
+
+	// following sends results as they are written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?check=test-check-1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ts := time.Now().UTC()
+	app.DbClient.(*test.MockDB).SendStatusResults(ctx, []checks.StatusCheckResult{{
+		Metadata:   checks.StatusCheckMetadata{Region: "us-test-2", CheckID: "test-check-1"},
+		Timestamp:  ts,
+		ResponseID: checks.NewResponseID("us-test-2", "test-check-1", ts),
+	}})
+	done := make(chan []checks.StatusCheckResult)
+	go func() {
+		results, _ := readEvents(t, bufio.NewScanner(resp.Body), 1)
+		done <- results
+	}()
+	select {
+	case results := <-done:
+		if len(results) != 1 || !results[0].Timestamp.Equal(ts) {
+			t.Fatalf("followed result. Want: %v Got: %+v", ts, results)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result streamed")
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"?check=missing", http.StatusNotFound},
+		{"?since=yesterday", http.StatusBadRequest},
+		{"?follow=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s. Want: %d Got: %d", tt.target, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestRegionChecksStreamHandler(t *testing.T) {
+	app, _ := setupApp(t)
+	db := app.DbClient.(*test.MockDB)
+	db.AddCheck(checks.StatusCheck{ID: "test-check-2", Regions: []string{"us-test-3"}, Active: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.Ctx = ctx
+	watcher := newCheckWatcher(db, time.Millisecond, app.Log)
+	handler := regionChecksStreamHandler(app, watcher)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/regions/{region}/checks/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test-Worker") != "" {
+			r = r.WithContext(context.WithValue(r.Context(), workerKey{}, true))
+		}
+		handler(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close) // after cancel ends the streams
+	open := func(worker bool) <-chan sse.Event {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/regions/us-test-1/checks/stream", nil)
+		if worker {
+			req.Header.Set("X-Test-Worker", "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		events := make(chan sse.Event, 10)
+		go sse.Read(resp.Body, func(e sse.Event) error {
+			events <- e
+			return nil
+		})
+		return events
+	}
+
+	// the checks would be redacted for anyone but a worker, they only
+	// hear that the checks changed
+	db.UpdateStatusCheck(ctx, checks.StatusCheck{ID: "test-check-1", Regions: []string{"us-test-1"}, Active: true,
+		Headers: map[string]string{"Authorization": "Bearer hunter2"}})
+	select {
+	case e := <-open(false):
+		if e.Type != "reload" || strings.Contains(e.Data, "hunter2") || strings.Contains(e.Data, "xxxxx") {
+			t.Fatalf("event without the worker scope. Want: reload Got: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reload event")
+	}
+
+	worker := open(true)
+	events := make(chan checks.Checks)
+	go func() {
+		for e := range worker {
+			var checkList checks.Checks
+			if e.Type == "checks" && json.Unmarshal([]byte(e.Data), &checkList) == nil {
+				events <- checkList
+			}
+		}
+	}()
+	next := func() checks.Checks {
+		t.Helper()
+		select {
+		case checkList := <-events:
+			return checkList
+		case <-time.After(time.Second):
+			t.Fatal("no checks event")
+		}
+		return checks.Checks{}
+	}
+
+	// the checks are sent on connect
+	checkList := next()
+	if checkList.Region != "us-test-1" || len(checkList.StatusChecks) != 1 || checkList.StatusChecks[0].ID != "test-check-1" ||
+		checkList.StatusChecks[0].Headers["Authorization"] != "Bearer hunter2" {
+		t.Fatalf("first event. Got: %+v", checkList)
+	}
+
+	// a change to another region is not sent
+	db.UpdateStatusCheck(ctx, checks.StatusCheck{ID: "test-check-2", Regions: []string{"us-test-3"}, Active: false})
+	time.Sleep(10 * time.Millisecond)
+	db.UpdateStatusCheck(ctx, checks.StatusCheck{ID: "test-check-1", Regions: []string{"us-test-1"}, Active: false, Serial: 2})
+	checkList = next()
+	if len(checkList.StatusChecks) != 1 || checkList.StatusChecks[0].Active || checkList.StatusChecks[0].Serial != 2 {
+		t.Fatalf("update event. Got: %+v", checkList)
+	}
+
+	// moving the check to another region sends an empty list
+	db.UpdateStatusCheck(ctx, checks.StatusCheck{ID: "test-check-1", Regions: []string{"us-test-3"}, Serial: 3})
+	if checkList = next(); len(checkList.StatusChecks) != 0 {
+		t.Fatalf("removed event. Got: %+v", checkList)
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/sse"
+)
+
+// checkWatcher polls the checks and wakes the region check streams when
+// they change, so the database is read once per interval however many
+// workers are connected
+type checkWatcher struct {
+	db       data.Database
+	interval time.Duration
+	log      *zap.Logger
+	start    sync.Once
+
+	mu      sync.Mutex
+	checks  []checks.StatusCheck
+	loaded  bool
+	changed chan struct{} // closed when checks change
+}
+
+func newCheckWatcher(db data.Database, interval time.Duration, log *zap.Logger) *checkWatcher {
+	return &checkWatcher{db: db, interval: interval, log: log, changed: make(chan struct{})}
+}
+
+// current returns the checks, whether they were loaded yet and a channel
+// that is closed when they change. The first call starts polling until
+// ctx is cancelled.
+func (w *checkWatcher) current(ctx context.Context) ([]checks.StatusCheck, bool, <-chan struct{}) {
+	w.start.Do(func() { go w.run(ctx) })
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checks, w.loaded, w.changed
+}
+
+func (w *checkWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		list, err := w.db.ListStatusChecks(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.log.Error("ListStatusChecks failed.", zap.String("error", err.Error()))
+		} else if err == nil {
+			w.update(list)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *checkWatcher) update(list []checks.StatusCheck) {
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.loaded && reflect.DeepEqual(w.checks, list) {
+		return
+	}
+	w.checks, w.loaded = list, true
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// regionChecks returns the checks assigned to region that ctx can see
+// like GetRegionChecks
+func regionChecks(ctx context.Context, all []checks.StatusCheck, region string) checks.Checks {
+	tenant, scoped := data.TenantFrom(ctx)
+	regionChecks := checks.Checks{Region: region}
+	for _, c := range all {
+		if scoped && c.Tenant != tenant {
+			continue
+		}
+		for _, r := range c.Regions {
+			if r == region {
+				regionChecks.StatusChecks = append(regionChecks.StatusChecks, c)
+				break
+			}
+		}
+	}
+	return regionChecks
+}
+
+// regionChecksStreamHandler streams the checks of a region as server-sent
+// events. A "checks" event with the same body as GET
+// /api/v1/regions/{region}/checks is sent when the stream opens and
+// whenever a check of the region changes. The checks would be Redacted for
+// a request without the worker scope, so it is sent a "reload" event
+// instead and its workers load the checks from the database.
+func regionChecksStreamHandler(app *application.State, watcher *checkWatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		region := r.PathValue("region")
+		if !allowedRegion(w, r, region) {
+			return
+		}
+		worker := fromWorker(r)
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			app.Log.Error("Check stream can not flush.", zap.String("error", err.Error()))
+			return
+		}
+		app.Log.Info("Check stream opened", zap.String("region", region), zap.String("remote_addr", r.RemoteAddr))
+		defer app.Log.Info("Check stream closed", zap.String("region", region), zap.String("remote_addr", r.RemoteAddr))
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		var sent *checks.Checks
+		for {
+			all, loaded, changed := watcher.current(app.Ctx)
+			current := regionChecks(r.Context(), all, region)
+			if loaded && (sent == nil || !reflect.DeepEqual(*sent, current)) {
+				if writeChecksEvent(w, current, worker) != nil || rc.Flush() != nil {
+					return // the client went away
+				}
+				sent = &current
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-app.Ctx.Done():
+				return
+			case <-changed:
+			case <-keepAlive.C:
+				if sse.WriteComment(w, "keep-alive") != nil || rc.Flush() != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeChecksEvent(w http.ResponseWriter, regionChecks checks.Checks, worker bool) error {
+	if !worker {
+		return sse.Write(w, sse.Event{Type: "reload", Data: regionChecks.Region})
+	}
+	b, err := json.Marshal(regionChecks)
+	if err != nil {
+		return err
+	}
+	return sse.Write(w, sse.Event{Type: "checks", Data: string(b)})
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/application"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// maxWorkerBody limits the size of a worker registration
+const maxWorkerBody = 1 << 16
+
+// workerStatus is a registered worker and whether it is live
+type workerStatus struct {
+	checks.Worker
+	Live bool `json:"live"`
+}
+
+// regionStatus summarizes the workers of a region
+type regionStatus struct {
+	Region  string `json:"region"`
+	Workers int    `json:"workers"`
+	Live    int    `json:"live"`
+	// Checks is the number of active checks assigned to the region
+	Checks int `json:"checks"`
+	// Offline is set when the region has registered workers but none are
+	// live, its checks show unknown on the status page
+	Offline bool `json:"offline"`
+}
+
+// workersResponse is the body of GET /api/v1/workers
+type workersResponse struct {
+	WorkerTimeout string         `json:"worker_timeout"`
+	Workers       []workerStatus `json:"workers"`
+	Regions       []regionStatus `json:"regions"`
+}
+
+// workersHandler serves the registered workers with their last heartbeat,
+// and a summary of every region that has workers or active checks
+func workersHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workers, err := app.DbClient.ListWorkers(r.Context())
+		if err != nil {
+			serverError(w, app, "ListWorkers failed.", err)
+			return
+		}
+		statusChecks, err := app.DbClient.ListStatusChecks(r.Context())
+		if err != nil {
+			serverError(w, app, "ListStatusChecks failed.", err)
+			return
+		}
+
+		now, timeout := time.Now().UTC(), time.Duration(app.Config.WorkerTimeout)
+		offline := checks.OfflineRegions(workers, now, timeout)
+		regions := make(map[string]*regionStatus)
+		region := func(name string) *regionStatus {
+			if regions[name] == nil {
+				regions[name] = &regionStatus{Region: name, Offline: offline[name]}
+			}
+			return regions[name]
+		}
+		response := workersResponse{WorkerTimeout: timeout.String(), Workers: []workerStatus{}, Regions: []regionStatus{}}
+		for _, worker := range workers {
+			live := worker.Live(now, timeout)
+			response.Workers = append(response.Workers, workerStatus{Worker: worker, Live: live})
+			region(worker.Region).Workers++
+			if live {
+				region(worker.Region).Live++
+			}
+		}
+		for _, c := range statusChecks {
+			if !c.Active {
+				continue
+			}
+			for _, name := range c.Regions {
+				region(name).Checks++
+			}
+		}
+		for _, status := range regions {
+			response.Regions = append(response.Regions, *status)
+		}
+		sort.Slice(response.Regions, func(i, j int) bool { return response.Regions[i].Region < response.Regions[j].Region })
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// registerWorkerHandler registers a worker or records its heartbeat. The
+// body is the worker, the controller sets LastSeen.
+func registerWorkerHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sharedOnly(w, r) {
+			return
+		}
+		var worker checks.Worker
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxWorkerBody)).Decode(&worker); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid worker: %s", err))
+			return
+		}
+		id := r.PathValue("id")
+		switch {
+		case worker.ID != "" && worker.ID != id:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("worker id %q does not match the url", worker.ID))
+			return
+		case worker.Region == "":
+			writeError(w, http.StatusBadRequest, "region is required")
+			return
+		case worker.Capacity < 0:
+			writeError(w, http.StatusBadRequest, "capacity must not be negative")
+			return
+		case !allowedRegion(w, r, worker.Region):
+			return
+		}
+		worker.ID = id
+		worker.LastSeen = time.Now().UTC()
+		if worker.Started.IsZero() {
+			worker.Started = worker.LastSeen
+		}
+		if err := app.DbClient.SaveWorker(r.Context(), worker); err != nil {
+			serverError(w, app, "SaveWorker failed.", err)
+			return
+		}
+		if worker.Stopped {
+			app.Log.Info("Worker stopped", zap.String("worker_id", id), zap.String("region", worker.Region))
+		} else {
+			app.Log.Debug("Worker heartbeat", zap.String("worker_id", id), zap.String("region", worker.Region))
+		}
+		writeJSON(w, http.StatusOK, workerStatus{Worker: worker, Live: !worker.Stopped})
+	}
+}
+
+// deleteWorkerHandler removes a worker's registration, e.g. one that was
+// shut down for good without stopping cleanly
+func deleteWorkerHandler(app *application.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sharedOnly(w, r) {
+			return
+		}
+		id := r.PathValue("id")
+		err := app.DbClient.DeleteWorker(r.Context(), id)
+		if errors.Is(err, data.ErrNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("worker %q not found", id))
+			return
+		}
+		if err != nil {
+			serverError(w, app, "DeleteWorker failed.", err)
+			return
+		}
+		app.Log.Info("Worker removed", zap.String("worker_id", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/config"
+)
+
+func TestWorkerHandlers(t *testing.T) {
+	app, _ := setupApp(t)
+	app.Config.WorkerTimeout = config.Duration(time.Minute)
+	send := func(method string, target string, body string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		NewHandler(app).ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	steps := []struct {
+		method, target, body string
+		code                 int
+	}{
+		{http.MethodPut, "/api/v1/workers/w1", `{"region": "us-test-1", "version": "v1.0.0", "checks": 2}`, http.StatusOK},
+		{http.MethodPut, "/api/v1/workers/w2", `{"id": "w2", "region": "us-test-2", "stopped": true}`, http.StatusOK},
+		{http.MethodPut, "/api/v1/workers/w3", `{"id": "w2", "region": "us-test-2"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/workers/w3", `{"version": "v1.0.0"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/workers/w3", `not json`, http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		if code := send(step.method, step.target, step.body); code != step.code {
+			t.Fatalf("%s %s %s. Want: %d Got: %d", step.method, step.target, step.body, step.code, code)
+		}
+	}
+
+	var response workersResponse
+	if code := get(t, app, "/api/v1/workers", &response); code != http.StatusOK {
+		t.Fatalf("GET /api/v1/workers. Want: 200 Got: %d", code)
+	}
+	if len(response.Workers) != 2 || response.Workers[0].ID != "w1" || !response.Workers[0].Live ||
+		response.Workers[0].Checks != 2 || response.Workers[0].LastSeen.IsZero() || response.Workers[1].Live {
+		t.Fatalf("workers. Got: %+v", response.Workers)
+	}
+	want := []regionStatus{
+		{Region: "us-test-1", Workers: 1, Live: 1},
+		{Region: "us-test-2", Workers: 1, Offline: true},
+	}
+	if len(response.Regions) != len(want) || response.Regions[0] != want[0] || response.Regions[1] != want[1] {
+		t.Fatalf("regions. Want: %+v Got: %+v", want, response.Regions)
+	}
+
+	if code := send(http.MethodDelete, "/api/v1/workers/w2", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE w2. Want: 204 Got: %d", code)
+	}
+	if code := send(http.MethodDelete, "/api/v1/workers/w2", ""); code != http.StatusNotFound {
+		t.Fatalf("DELETE missing w2. Want: 404 Got: %d", code)
+	}
+}
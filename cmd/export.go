@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/checkconfig"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/export"
+)
+
+// exportChecks writes every check as YAML, JSON or CSV
+func exportChecks(ctx context.Context, db data.Database, format string, path string, w io.Writer, log *zap.Logger) error {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	statusChecks, err := db.ListStatusChecks(ctx)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "", "yaml", "yml":
+		err = checkconfig.FromStatusChecks(statusChecks).Write(w, false)
+	case "json":
+		err = checkconfig.FromStatusChecks(statusChecks).Write(w, true)
+	case "csv":
+		for _, c := range statusChecks {
+			if len(c.Headers) > 0 || len(c.Assertions) > 0 {
+				log.Warn("CSV has no headers or assertions columns, use yaml or json to keep them.", zap.String("check_id", c.ID))
+			}
+		}
+		err = checkconfig.WriteCSV(w, statusChecks)
+	default:
+		return fmt.Errorf("unknown check format %q, use yaml, json or csv", format)
+	}
+	if err == nil {
+		log.Info("Exported checks", zap.Int("count", len(statusChecks)))
+	}
+	return err
+}
+
+// exportResults writes results matching query as CSV, JSON lines or Parquet
+func exportResults(ctx context.Context, db data.Database, query data.ResultQuery, format string, path string, w io.Writer, log *zap.Logger) error {
+	f, err := export.ParseFormat(format, path)
+	if err != nil {
+		return err
+	}
+	if !query.From.Before(query.To) {
+		return fmt.Errorf("--from %s must be before --to %s", query.From, query.To)
+	}
+	count, err := export.Results(ctx, db, query, f, w)
+	if err == nil {
+		log.Info("Exported results", zap.Int("count", count), zap.Time("from", query.From), zap.Time("to", query.To))
+	}
+	return err
+}
@@ -2,64 +2,269 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"go.uber.org/zap"
 
-	"github.com/larntz/status/cmd/worker"
+	"github.com/larntz/status/internal/config"
 	"github.com/larntz/status/internal/data"
 )
 
+const programName = "status"
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitFailed = 1 // the command ran and failed
+	exitUsage  = 2 // bad arguments, flags or config
+)
+
 func main() {
-	env, set := os.LookupEnv("ENVIRONMENT")
-	var log *zap.Logger
-	var err error
-	if !set || env == "production" {
-		log, err = zap.NewProduction()
-	} else {
-		log, err = zap.NewDevelopment()
+	// cancelled on SIGINT or SIGTERM so workers can shut down cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// command is a subcommand. Commands either run or group subcommands.
+type command struct {
+	name    string
+	args    string // usage after the flags, e.g. <checks.csv>
+	summary string
+	// description is printed by --help below the usage line, summary is
+	// used when it is empty
+	description string
+	// setup registers the command's flags and returns the function that
+	// runs it
+	setup    func(fs *flag.FlagSet) func(ctx context.Context, r *runner) error
+	commands []*command
+	// invalidConfig runs the command with an invalid config, the problems
+	// are in runner.configErr
+	invalidConfig bool
+}
+
+// runner is what a command runs with
+type runner struct {
+	cfg  config.Config
+	log  *zap.Logger
+	args []string // arguments left after the flags
+	// configErr lists config problems for commands with invalidConfig set
+	configErr error
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+// database connects to the configured database, the caller disconnects
+func (r *runner) database(ctx context.Context) (data.Database, error) {
+	db, err := data.NewDatabase(r.cfg.Database.Options())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("connect to database failed: %w", err)
+	}
+	return db, nil
+}
+
+// usageError is returned by commands for bad arguments, run prints the
+// command's usage and exits with exitUsage
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return usageError(fmt.Sprintf(format, a...))
+}
+
+// run finds the command named by args, parses its flags, loads the config
+// and runs it. It returns the process exit code.
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	root := rootCommand()
+	cmd, path := root, []string{programName}
+	for len(args) > 0 && len(cmd.commands) > 0 {
+		if args[0] == "help" {
+			return help(root, append(path[1:], args[1:]...), stdout, stderr)
+		}
+		next := cmd.find(args[0])
+		if next == nil {
+			break
+		}
+		cmd, path, args = next, append(path, next.name), args[1:]
+	}
+
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { cmd.usage(fs, path, fs.Output()) }
+	if cmd.setup == nil {
+		switch {
+		case len(args) == 0:
+			cmd.usage(fs, path, stderr)
+			return exitUsage
+		case isHelp(args[0]):
+			cmd.usage(fs, path, stdout)
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", strings.Join(append(path, args[0]), " "))
+		cmd.usage(fs, path, stderr)
+		return exitUsage
+	}
+
+	configFlags := config.RegisterFlags(fs)
+	runCmd := cmd.setup(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			cmd.usage(fs, path, stdout)
+			return exitOK
+		}
+		return exitUsage
+	}
+	cfg, configErr := configFlags.Load()
+	if configErr != nil && !cmd.invalidConfig {
+		fmt.Fprintf(stderr, "Invalid config:\n%s\n", configErr)
+		return exitUsage
 	}
+	log, err := newLogger(cfg.Environment)
 	if err != nil {
-		fmt.Println("Unable to setup logger. Exiting...")
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Unable to setup logger: %s\n", err)
+		return exitFailed
 	}
 	defer log.Sync()
+	if cfg.Environment != config.Production && cfg.Environment != config.Development {
+		log.Warn("Unknown environment, using development", zap.String("environment", cfg.Environment))
+	}
+
+	err = runCmd(ctx, &runner{cfg: cfg, log: log, args: positional, configErr: configErr, stdout: stdout, stderr: stderr})
+	var usageErr usageError
+	switch {
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s\n\n", usageErr)
+		cmd.usage(fs, path, stderr)
+		return exitUsage
+	case err != nil:
+		fmt.Fprintf(stderr, "%s: %s\n", strings.Join(path, " "), err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// parseInterspersed parses flags before and after positional arguments,
+// e.g. check get api --format json, and returns the positional ones.
+// Everything after -- is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		parsed := len(args) - fs.NArg()
+		if parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, fs.Args()...), nil
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
 
-	log.Info("Starting")
-	if len(os.Args) < 2 {
-		log.Fatal("Must specify subcommand: 'controller' or 'worker'")
+// help prints the usage of the command named by args
+func help(root *command, args []string, stdout io.Writer, stderr io.Writer) int {
+	cmd, path := root, []string{programName}
+	for _, name := range args {
+		next := cmd.find(name)
+		if next == nil {
+			fmt.Fprintf(stderr, "Unknown command %q\n", strings.Join(append(path, name), " "))
+			return exitUsage
+		}
+		cmd, path = next, append(path, next.name)
+	}
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	if cmd.setup != nil {
+		config.RegisterFlags(fs)
+		cmd.setup(fs)
 	}
+	cmd.usage(fs, path, stdout)
+	return exitOK
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
 
-	switch os.Args[1] {
-	case "create-dev-checks":
-		if len(os.Args) < 3 {
-			log.Fatal("Not enough args, must specify a csv file for creating checks.")
+func (c *command) find(name string) *command {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
 		}
-		data.CreateDevChecks(os.Args[2], log)
-	case "controller":
-		log.Fatal("controller ain't ready")
-		// dbLogin(ctx, &app)
-		// defer app.DbClient.Disconnect(ctx)
-		// controller.StartController(&app)
-	case "worker":
-		var ok bool
-		state := worker.NewState()
-		state.Region, ok = os.LookupEnv("WORKER_REGION")
-		if !ok {
-			log.Fatal("WORKER_REGION env var not set. Exiting.")
+	}
+	return nil
+}
+
+// usage prints the command's usage, its subcommands and its own flags.
+// The config flags every command accepts are only listed by config print.
+func (c *command) usage(fs *flag.FlagSet, path []string, w io.Writer) {
+	name := strings.Join(path, " ")
+	if len(c.commands) > 0 {
+		fmt.Fprintf(w, "Usage: %s <command>\n", name)
+	} else {
+		fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("Usage: %s [flags] %s", name, c.args)))
+	}
+	if c.description != "" {
+		fmt.Fprintf(w, "\n%s\n", c.description)
+	} else if c.summary != "" {
+		fmt.Fprintf(w, "\n%s.\n", c.summary)
+	}
+	if len(c.commands) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		for _, sub := range c.commands {
+			fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.summary)
 		}
-		state.Log = log
-		state.HTTPTransport = &http.Transport{}
-		state.DBClient = &data.MongoDB{}
-		if err := state.DBClient.Connect(); err != nil {
-			log.Fatal("Connect() to database failed.", zap.String("error", err.Error()))
+		fmt.Fprintf(w, "\nRun '%s help <command>' for more about a command.\n", name)
+		return
+	}
+
+	showConfig := c.name == "print"
+	own := flag.NewFlagSet(name, flag.ContinueOnError)
+	own.SetOutput(w)
+	hasFlags, hasConfig := false, false
+	fs.VisitAll(func(f *flag.Flag) {
+		if config.IsFlag(f.Name) {
+			hasConfig = true
+			if !showConfig {
+				return
+			}
 		}
-		defer state.DBClient.Disconnect()
-		state.RunWorker()
+		hasFlags = true
+		own.Var(f.Value, f.Name, f.Usage)
+	})
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		own.PrintDefaults()
+	}
+	if hasConfig && !showConfig {
+		fmt.Fprintf(w, "\nConfig flags such as --config and --database.connection-string are also accepted,\n"+
+			"run '%s help config print' to list them.\n", programName)
+	}
+}
 
-	default:
-		log.Fatal("Must specify subcommand: 'controller' or 'worker'")
+// newLogger returns the logger for environment, development logs are
+// human readable
+func newLogger(environment string) (*zap.Logger, error) {
+	if environment == config.Production {
+		return zap.NewProduction()
 	}
+	return zap.NewDevelopment()
 }
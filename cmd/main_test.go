@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/config"
+)
+
+// runCLI runs the cli with args and returns the exit code and output
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestHelpAndExitCodes(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{nil, exitUsage, "Commands:"},
+		{[]string{"--help"}, exitOK, "check        List, show, add and remove checks"},
+		{[]string{"help", "check", "add"}, exitOK, "Usage: status check add [flags]"},
+		{[]string{"check", "help", "add"}, exitOK, "-region value"},
+		{[]string{"check", "add", "--help"}, exitOK, "-url string"},
+		{[]string{"help", "config", "print"}, exitOK, "-database.connection-string"},
+		{[]string{"check"}, exitUsage, "Usage: status check <command>"},
+		{[]string{"bogus"}, exitUsage, `Unknown command "status bogus"`},
+		{[]string{"check", "bogus"}, exitUsage, `Unknown command "status check bogus"`},
+		{[]string{"check", "get", "--nope"}, exitUsage, "flag provided but not defined: -nope"},
+		{[]string{"check", "get"}, exitUsage, "check get needs one check id"},
+		{[]string{"check", "list", "--worker.send-interval", "0s"}, exitUsage, "worker.send_interval must be positive"},
+		{[]string{"version"}, exitOK, "status dev"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, tt.args...)
+		if code != tt.code || !strings.Contains(stdout+stderr, tt.output) {
+			t.Errorf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", tt.args, tt.code, tt.output, code, stdout, stderr)
+		}
+	}
+
+	// config flags are only listed by config print
+	if _, stdout, _ := runCLI(t, "check", "add", "--help"); strings.Contains(stdout, "\n  -database.") || strings.Contains(stdout, "\n  -environment") {
+		t.Errorf("check add help lists config flags:\n%s", stdout)
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+
+	steps := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"check", "add", "--id", "api", "--url", "https://api.example.com", "--region", "us-east-1,eu-west-1",
+			"--interval", "30s", "--header", "Accept: application/json"}, exitOK, "+ create api (https://api.example.com)"},
+		{[]string{"check", "add", "--id", "api", "--url", "https://api.example.com", "--region", "us-east-1"}, exitFailed, "already exists"},
+		{[]string{"check", "add", "--id", "bad", "--url", "ftp://bad.example.com"}, exitUsage, "at least one region is required"},
+		{[]string{"check", "list"}, exitOK, "api        https://api.example.com  30s       us-east-1,eu-west-1  true    1"},
+		{[]string{"check", "list", "--region", "ap-south-1"}, exitOK, "ID  NAME  URL"},
+		{[]string{"check", "get", "api"}, exitOK, "  Accept: application/json"},
+		{[]string{"check", "get", "api", "--format", "json"}, exitOK, `"serial": 1`},
+		{[]string{"check", "get", "nope"}, exitFailed, "check nope not found"},
+		{[]string{"check", "rm", "api", "nope"}, exitFailed, "check nope not found"},
+		{[]string{"check", "rm", "--", "-x"}, exitFailed, "check -x not found"},
+		{[]string{"check", "get", "api"}, exitFailed, "check api not found"},
+	}
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(t, step.args...)
+		if code != step.code || !strings.Contains(stdout+stderr, step.output) {
+			t.Fatalf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", step.args, step.code, step.output, code, stdout, stderr)
+		}
+	}
+}
+
+func TestTokenCommands(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+
+	code, stdout, stderr := runCLI(t, "token", "create", "--name", "worker-us-east-1", "--scope", "worker", "--expires", "24h")
+	if code != exitOK || !strings.HasPrefix(stdout, "st_") || !strings.Contains(stderr, "it is not shown again") {
+		t.Fatalf("token create. Got: %d\nstdout: %s\nstderr: %s", code, stdout, stderr)
+	}
+	id, _, err := auth.ParseToken(strings.TrimSpace(stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"token", "create", "--scope", "worker"}, exitUsage, "--name is required"},
+		{[]string{"token", "create", "--name", "x", "--scope", "admin"}, exitUsage, `unknown scope "admin"`},
+		{[]string{"token", "create", "--name", "x"}, exitUsage, "at least one --scope is required"},
+		{[]string{"token", "list"}, exitOK, id + "  worker-us-east-1  worker"},
+		{[]string{"token", "rm", id, "nope"}, exitFailed, "token nope not found"},
+		{[]string{"token", "list"}, exitOK, "ID  NAME  SCOPES  CREATED  EXPIRES  TENANT\n"},
+	}
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(t, step.args...)
+		if code != step.code || !strings.Contains(stdout+stderr, step.output) {
+			t.Fatalf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", step.args, step.code, step.output, code, stdout, stderr)
+		}
+	}
+}
+
+func TestTenantCommands(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+	file := filepath.Join(t.TempDir(), "checks.yaml")
+	os.WriteFile(file, []byte("checks:\n"+
+		"  - {id: a-2, url: https://a2.example.com, regions: [us-east-1]}\n"+
+		"  - {id: a-3, url: https://a3.example.com, regions: [us-east-1]}\n"), 0o600)
+	other := filepath.Join(t.TempDir(), "other.yaml")
+	os.WriteFile(other, []byte("checks:\n  - {id: other, url: https://other.example.com, regions: [us-east-1]}\n"), 0o600)
+
+	steps := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"tenant", "set", "team-a", "--max-checks", "2", "--min-interval", "30s"}, exitOK,
+			"~ set tenant team-a (at most 2 checks, interval at least 30s)"},
+		{[]string{"tenant", "set"}, exitUsage, "tenant set needs one tenant name"},
+		{[]string{"check", "add", "--id", "shared", "--url", "https://example.com", "--region", "us-east-1"}, exitOK, "+ create shared"},
+		{[]string{"check", "add", "--tenant", "team-a", "--id", "a-1", "--url", "https://a1.example.com", "--region", "us-east-1",
+			"--interval", "10s"}, exitFailed, "interval 10s is shorter than the minimum 30s"},
+		{[]string{"check", "add", "--tenant", "team-a", "--id", "a-1", "--url", "https://a1.example.com", "--region", "us-east-1"},
+			exitOK, "+ create a-1"},
+		{[]string{"check", "list", "--tenant", "team-a"}, exitOK, "a-1"},
+		{[]string{"check", "get", "a-1"}, exitOK, "tenant: team-a"},
+		{[]string{"check", "get", "--tenant", "team-a", "shared"}, exitFailed, "check shared not found"},
+		// sync only sees and prunes the tenant's checks
+		{[]string{"sync", "--tenant", "team-a", "--prune=false", file}, exitFailed, "create a-3 failed: tenant team-a quota: at most 2 checks"},
+		{[]string{"check", "rm", "--tenant", "team-a", "shared"}, exitFailed, "check shared not found"},
+		{[]string{"tenant", "list"}, exitOK, "team-a  2       at most 2 checks"},
+		{[]string{"token", "create", "--tenant", "team-a", "--name", "x", "--scope", "worker"}, exitUsage, "can not have the worker scope"},
+		{[]string{"tenant", "rm", "team-a", "nope"}, exitFailed, "tenant nope not found"},
+		{[]string{"sync", "--tenant", "team-a", file}, exitOK, "1 to create, 0 to update, 1 to delete"},
+		{[]string{"check", "get", "shared"}, exitOK, "id: shared"},
+		// without --tenant sync only prunes the default tenant's checks
+		{[]string{"sync", other}, exitOK, "1 to create, 0 to update, 1 to delete"},
+		{[]string{"check", "get", "--tenant", "team-a", "a-2"}, exitOK, "id: a-2"},
+	}
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(t, step.args...)
+		if code != step.code || !strings.Contains(stdout+stderr, step.output) {
+			t.Fatalf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", step.args, step.code, step.output, code, stdout, stderr)
+		}
+	}
+}
+
+func TestSecretCommands(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	dir := t.TempDir()
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(dir, "status.db"))
+	t.Setenv("WORKER_SECRET_KEY_FILE", filepath.Join(dir, "secret.key"))
+	t.Setenv("STATUS_SECRET_FROM_ENV", "env-token")
+	value := filepath.Join(dir, "value")
+	os.WriteFile(value, []byte("db-token\n"), 0o600)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer db-token" && r.Header.Get("Authorization") != "Bearer env-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	steps := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"secret", "key", "--out", filepath.Join(dir, "secret.key")}, exitOK, "+ create"},
+		{[]string{"secret", "key", "--out", filepath.Join(dir, "secret.key")}, exitFailed, "file exists"},
+		{[]string{"secret", "set", "api-token"}, exitUsage, "secret set needs --from-file"},
+		{[]string{"secret", "set", "a/b", "--from-file", value}, exitUsage, "invalid secret name"},
+		{[]string{"secret", "set", "api-token", "--from-file", value}, exitOK, "~ set secret api-token"},
+		{[]string{"secret", "set", "--tenant", "team-a", "team-token", "--from-file", value}, exitOK, "~ set secret team-token"},
+		{[]string{"secret", "list"}, exitOK, "team-token  team-a"},
+		{[]string{"secret", "list", "--tenant", "team-a"}, exitOK, "team-token"},
+		{[]string{"check", "run", "--url", srv.URL, "--header", "Authorization: Bearer ${secret:api-token}"}, exitOK, "UP  "},
+		{[]string{"check", "run", "--url", srv.URL, "--header", "Authorization: Bearer ${secret:from-env}"}, exitOK, "UP  "},
+		{[]string{"check", "run", "--url", srv.URL, "--header", "Authorization: Bearer ${secret:team-token}"}, exitFailed,
+			"secret not found: team-token"},
+		{[]string{"secret", "rm", "api-token", "nope"}, exitFailed, "secret nope not found"},
+		{[]string{"secret", "rm", "--tenant", "team-a", "team-token"}, exitOK, "- delete secret team-token"},
+		{[]string{"check", "run", "--url", srv.URL, "--header", "Authorization: Bearer ${secret:api-token}"}, exitFailed,
+			"secret not found: api-token"},
+	}
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(t, step.args...)
+		if code != step.code || !strings.Contains(stdout+stderr, step.output) {
+			t.Fatalf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", step.args, step.code, step.output, code, stdout, stderr)
+		}
+	}
+}
+
+func TestCACommands(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca")
+
+	steps := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"ca", "worker", "--dir", ca, "--region", "us-east-1"}, exitFailed, "create one with status ca init"},
+		{[]string{"ca", "init", "--dir", ca}, exitOK, "+ create " + filepath.Join(ca, "ca.crt")},
+		{[]string{"ca", "init", "--dir", ca}, exitFailed, "ca.crt already exists"},
+		{[]string{"ca", "worker", "--dir", ca}, exitUsage, "--region is required"},
+		{[]string{"ca", "worker", "--dir", ca, "--region", "us-east-1", "--out", dir}, exitOK, "worker-us-east-1.key (worker-us-east-1"},
+		{[]string{"ca", "worker", "--dir", ca, "--region", "us-east-1", "--out", dir}, exitFailed, "already exists"},
+		{[]string{"ca", "server", "--dir", ca, "--out", dir}, exitUsage, "at least one --host is required"},
+		{[]string{"ca", "server", "--dir", ca, "--out", dir, "--host", "localhost,127.0.0.1"}, exitOK, "controller.crt"},
+	}
+	for _, step := range steps {
+		code, stdout, stderr := runCLI(t, step.args...)
+		if code != step.code || !strings.Contains(stdout+stderr, step.output) {
+			t.Fatalf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", step.args, step.code, step.output, code, stdout, stderr)
+		}
+	}
+
+	cfg := config.Default().Worker
+	cfg.Region = "eu-west-1"
+	cfg.TLSCert, cfg.TLSKey = filepath.Join(dir, "worker-us-east-1.crt"), filepath.Join(dir, "worker-us-east-1.key")
+	cfg.TLSCA = filepath.Join(ca, "ca.crt")
+	if _, err := controllerClient(cfg); err == nil || !strings.Contains(err.Error(), `is for region "us-east-1"`) {
+		t.Fatalf("certificate for another region. Got: %v", err)
+	}
+	cfg.Region = "us-east-1"
+	if client, err := controllerClient(cfg); err != nil || client == nil {
+		t.Fatalf("controllerClient. Got: %v %v", client, err)
+	}
+}
+
+func TestCheckRun(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status": "ok"}`)
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "checks.yaml")
+	os.WriteFile(file, []byte("checks:\n"+
+		"  - {id: api, url: "+srv.URL+", regions: [us-east-1]}\n"+
+		"  - {id: down, url: "+srv.URL+"/down, regions: [us-east-1]}\n"), 0o600)
+
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"check", "run", "--url", srv.URL, "--assert", "status_code eq 200", "--assert", "header Content-Type contains json"},
+			exitOK, "  pass  header Content-Type contains \"json\""},
+		{[]string{"check", "run", "--url", srv.URL, "--assert", "body_contains down"}, exitFailed, "  FAIL  body does not contain \"down\""},
+		{[]string{"check", "run", "--url", srv.URL + "/down", "--format", "json"}, exitFailed, `"response_code": 503`},
+		{[]string{"check", "run", "--url", srv.URL, "--region", "eu-west-1", "--format", "json"}, exitOK, `"region": "eu-west-1"`},
+		{[]string{"check", "run", "--file", file, "api"}, exitOK, "UP  api  " + srv.URL},
+		{[]string{"check", "run", "--file", file}, exitFailed, "1 of 2 checks failed"},
+		{[]string{"check", "run", "--file", file, "nope"}, exitFailed, "check nope not found"},
+		{[]string{"check", "run", "--url", "http://127.0.0.1:1"}, exitFailed, "DOWN  127.0.0.1:1"},
+		{[]string{"check", "run"}, exitUsage, "check run needs --url or --file"},
+		{[]string{"check", "run", "--url", srv.URL, "--assert", "status_code"}, exitUsage, "invalid assertion"},
+		{[]string{"check", "run", "--url", srv.URL, "--assert", "colour eq red"}, exitUsage, "invalid assertion"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, tt.args...)
+		if code != tt.code || !strings.Contains(stdout+stderr, tt.output) {
+			t.Errorf("%q. Want: %d %q Got: %d\nstdout: %s\nstderr: %s", tt.args, tt.code, tt.output, code, stdout, stderr)
+		}
+	}
+}
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want checks.Assertion
+	}{
+		{"status_code 200", checks.Assertion{Type: checks.AssertStatusCode, Value: "200"}},
+		{"response_time lte 500", checks.Assertion{Type: checks.AssertResponseTime, Operator: checks.OpLessOrEqual, Value: "500"}},
+		{"body_contains all systems go", checks.Assertion{Type: checks.AssertBodyContains, Value: "all systems go"}},
+		{"header X-Env ne staging", checks.Assertion{Type: checks.AssertHeader, Target: "X-Env", Operator: checks.OpNotEqual, Value: "staging"}},
+	}
+	for _, tt := range tests {
+		got, err := parseAssertion(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("%q. Want: %+v Got: %+v %v", tt.in, tt.want, got, err)
+		}
+	}
+}
+
+func TestStreamResults(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Second)
+	event := func(w io.Writer, latest time.Time, offset time.Duration) {
+		ts := start.Add(offset)
+		b, _ := json.Marshal(checks.StatusCheckResult{
+			Metadata:   checks.StatusCheckMetadata{Region: "us-east-1", CheckID: "api"},
+			Timestamp:  ts,
+			ResponseID: checks.NewResponseID("us-east-1", "api", ts),
+		})
+		fmt.Fprintf(w, "event: result\nid: %s\ndata: %s\n\n", latest.Format(time.RFC3339Nano), b)
+	}
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		if r.Header.Get("Authorization") != "Bearer st_test_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": "invalid token"}`)
+			return
+		}
+		if r.URL.Query().Get("check") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error": "check \"missing\" not found"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(lastIDs) == 1 {
+			// the first connection drops after two results
+			io.WriteString(w, "retry: 1\n: keep-alive\n\n")
+			event(w, start.Add(2*time.Second), 2*time.Second)
+			event(w, start.Add(2*time.Second), time.Second)
+			return
+		}
+		// the reconnect resends a result
+		event(w, start.Add(2*time.Second), time.Second)
+		event(w, start.Add(3*time.Second), 3*time.Second)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []time.Duration
+	err := streamResults(ctx, srv.Client(), srv.URL, "st_test_secret", true, func(r checks.StatusCheckResult) error {
+		if got = append(got, r.Timestamp.Sub(start)); len(got) == 3 {
+			cancel()
+		}
+		return nil
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{2 * time.Second, time.Second, 3 * time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("results. Want: %v Got: %v", want, got)
+	}
+	if len(lastIDs) != 2 || lastIDs[0] != "" || lastIDs[1] != start.Add(2*time.Second).Format(time.RFC3339Nano) {
+		t.Fatalf("Last-Event-ID. Got: %q", lastIDs)
+	}
+
+	stream, err := resultStreamURL(srv.URL, "missing", "", time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = streamResults(context.Background(), srv.Client(), stream, "st_test_secret", true, nil, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), `404 check "missing" not found`) {
+		t.Fatalf("missing check. Got: %v", err)
+	}
+}
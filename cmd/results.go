@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/sse"
+)
+
+// streamRetry is the longest wait before reconnecting to the results
+// stream
+const streamRetry = 30 * time.Second
+
+func resultsCommand() *command {
+	return &command{
+		name:    "results",
+		summary: "Show check results",
+		commands: []*command{
+			{name: "tail", summary: "Print recent results and follow new ones", setup: resultsTailCommand},
+		},
+	}
+}
+
+func resultsTailCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	checkID := fs.String("check", "", "only show results for this check")
+	region := fs.String("region", "", "only show results from this region")
+	since := fs.Duration("since", 15*time.Minute, "show results newer than this")
+	follow := fs.Bool("follow", true, "keep printing new results until interrupted")
+	poll := fs.Duration("poll", 5*time.Second, "how often to look for new results when following")
+	format := fs.String("format", "table", "table or jsonl")
+	controller := fs.String("controller", "", "stream results from the controller at this url, e.g. http://127.0.0.1:4242,\n"+
+		"instead of polling the database")
+	token := fs.String("token", os.Getenv("STATUS_TOKEN"), "api token with the results:read scope for --controller (env STATUS_TOKEN)")
+	return func(ctx context.Context, r *runner) error {
+		if *format != "table" && *format != "jsonl" {
+			return usageErrorf("unknown format %q, use table or jsonl", *format)
+		}
+		if *poll <= 0 {
+			return usageErrorf("--poll must be positive")
+		}
+		write := resultWriter(r.stdout, *format)
+		if *controller != "" {
+			stream, err := resultStreamURL(*controller, *checkID, *region, *since, *follow)
+			if err != nil {
+				return usageError(err.Error())
+			}
+			return streamResults(ctx, http.DefaultClient, stream, *token, *follow, write, r.log)
+		}
+
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		query := data.ResultQuery{CheckID: *checkID, Region: *region, From: time.Now().Add(-*since)}
+		return data.TailStatusResults(ctx, db, query, *follow, *poll, write)
+	}
+}
+
+// resultWriter prints one result per line as a table row or JSON
+func resultWriter(w io.Writer, format string) func(checks.StatusCheckResult) error {
+	if format == "jsonl" {
+		encoder := json.NewEncoder(w)
+		return func(r checks.StatusCheckResult) error {
+			return encoder.Encode(r)
+		}
+	}
+	fmt.Fprintf(w, "%-20s  %-12s  %-20s  %4s  %-4s  %7s  %s\n", "TIME", "REGION", "CHECK", "CODE", "UP", "TTFB", "INFO")
+	return func(r checks.StatusCheckResult) error {
+		up := "up"
+		if !r.Up() {
+			up = "DOWN"
+		}
+		_, err := fmt.Fprintf(w, "%-20s  %-12s  %-20s  %4d  %-4s  %5dms  %s\n", r.Timestamp.UTC().Format(time.RFC3339),
+			r.Metadata.Region, r.Metadata.CheckID, r.ResponseCode, up, r.TTFB, r.ResponseInfo)
+		return err
+	}
+}
+
+// resultStreamURL returns the url of the controller's results stream
+func resultStreamURL(controller string, checkID string, region string, since time.Duration, follow bool) (string, error) {
+	u, err := url.Parse(controller)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid --controller %q, use e.g. http://127.0.0.1:4242", controller)
+	}
+	u = u.JoinPath("/api/v1/results/stream")
+	params := url.Values{"follow": []string{strconv.FormatBool(follow)}}
+	if checkID != "" {
+		params.Set("check", checkID)
+	}
+	if region != "" {
+		params.Set("region", region)
+	}
+	if since > 0 {
+		params.Set("since", since.String())
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// streamResults writes the results from the results stream at url. When
+// follow is set it reconnects until ctx is cancelled, resuming after the
+// last result it received. Every result is written once. token is sent as
+// a bearer token unless it is empty.
+func streamResults(ctx context.Context, client *http.Client, streamURL string, token string, follow bool,
+	write func(checks.StatusCheckResult) error, log *zap.Logger) error {
+	lastID, latest := "", time.Time{}
+	seen := make(map[string]time.Time)
+	base, retry := time.Second, time.Second
+	var writeErr error
+	for {
+		received, err := readResultStream(ctx, client, streamURL, token, lastID, &base, func(id string, result checks.StatusCheckResult) error {
+			lastID = id
+			if _, ok := seen[result.ResponseID]; ok {
+				return nil
+			}
+			// a reconnect resends results from data.TailLag before the
+			// last id, forget older ones
+			if result.Timestamp.After(latest) {
+				latest = result.Timestamp
+				for responseID, timestamp := range seen {
+					if timestamp.Before(latest.Add(-data.TailLag)) {
+						delete(seen, responseID)
+					}
+				}
+			}
+			seen[result.ResponseID] = result.Timestamp
+			writeErr = write(result)
+			return writeErr
+		})
+		var statusErr streamStatusError
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case writeErr != nil:
+			return writeErr
+		case errors.As(err, &statusErr) && statusErr.code < 500:
+			return err
+		case !follow:
+			return err
+		}
+		if received {
+			retry = base
+		}
+		msg := "Results stream closed, reconnecting."
+		if err != nil {
+			msg = "Results stream failed, reconnecting."
+		}
+		log.Warn(msg, zap.Error(err), zap.Duration("retry", retry))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+		retry = min(2*retry, streamRetry)
+	}
+}
+
+// streamStatusError is returned when the results stream responds with an
+// error status
+type streamStatusError struct {
+	code    int
+	message string
+}
+
+func (e streamStatusError) Error() string {
+	return fmt.Sprintf("results stream: %d %s", e.code, e.message)
+}
+
+// readResultStream reads server-sent events from streamURL until the stream
+// ends, calling send for each result. It reports whether any result was
+// received and sets retry when the server sends a reconnection time.
+func readResultStream(ctx context.Context, client *http.Client, streamURL string, token string, lastID string, retry *time.Duration,
+	send func(id string, result checks.StatusCheckResult) error) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+		return false, streamStatusError{resp.StatusCode, body.Error}
+	}
+
+	received := false
+	err = sse.Read(resp.Body, func(e sse.Event) error {
+		if e.Retry > 0 {
+			*retry = e.Retry
+		}
+		switch e.Type {
+		case "result":
+			var result checks.StatusCheckResult
+			if err := json.Unmarshal([]byte(e.Data), &result); err != nil {
+				return fmt.Errorf("invalid result event: %w", err)
+			}
+			received = true
+			return send(e.ID, result)
+		case "error":
+			return fmt.Errorf("results stream: %s", e.Data)
+		}
+		return nil
+	})
+	return received, err
+}
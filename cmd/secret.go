@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/secrets"
+)
+
+// maxSecret limits the size of a secret value
+const maxSecret = 64 << 10
+
+func secretCommand() *command {
+	return &command{
+		name:    "secret",
+		summary: "Store the secrets checks reference as ${secret:name}",
+		commands: []*command{
+			{name: "key", summary: "Create the key that seals stored secrets", setup: secretKeyCommand,
+				description: "Create a key file for secret set. Set it as worker.secret_key_file on every\n" +
+					"worker, the controller does not need it. Workers also resolve secrets from\n" +
+					"STATUS_SECRET_<NAME> environment variables and files in worker.secrets_dir,\n" +
+					"those are only available to the default tenant's checks."},
+			{name: "set", args: "<name>", summary: "Seal a secret and store it in the database", setup: secretSetCommand,
+				description: "Seal the value read from --from-file with the secret key and store it. Checks\n" +
+					"reference it in their url or header values as ${secret:<name>}.\n\n" +
+					"Example:\n  printf %s \"$API_TOKEN\" | status secret set api-token --from-file -"},
+			{name: "list", summary: "List stored secrets, values are not shown", setup: secretListCommand},
+			{name: "rm", args: "<name>...", summary: "Remove stored secrets", setup: secretRmCommand},
+		},
+	}
+}
+
+func secretKeyCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	out := fs.String("out", "secret.key", "file to write the key to, it must not exist")
+	return func(ctx context.Context, r *runner) error {
+		key, err := secrets.NewKey()
+		if err != nil {
+			return err
+		}
+		if err := secrets.WriteKey(*out, key); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.stdout, "+ create %s\n", *out)
+		return nil
+	}
+}
+
+func secretSetCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	fromFile := fs.String("from-file", "", "read the value from this file, - for stdin (required)")
+	keyFile := fs.String("key-file", "", "secret key (default worker.secret_key_file)")
+	withTenant := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = withTenant(ctx)
+		if len(r.args) != 1 {
+			return usageErrorf("secret set needs one secret name")
+		}
+		if err := checks.ValidSecretName(r.args[0]); err != nil {
+			return usageError(err.Error())
+		}
+		if *fromFile == "" {
+			return usageErrorf("secret set needs --from-file")
+		}
+		if *keyFile == "" {
+			*keyFile = r.cfg.Worker.SecretKeyFile
+		}
+		if *keyFile == "" {
+			return usageErrorf("no secret key, set --key-file or worker.secret_key_file")
+		}
+		key, err := secrets.LoadKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		value, err := readSecret(*fromFile)
+		if err != nil {
+			return err
+		}
+
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		tenant, _ := data.TenantFrom(ctx)
+		secret, err := secrets.Seal(key, checks.Secret{Name: r.args[0], Tenant: tenant, Modified: time.Now().UTC()}, value)
+		if err != nil {
+			return err
+		}
+		if err := db.SaveSecret(ctx, secret); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.stdout, "~ set secret %s\n", secret.Name)
+		return nil
+	}
+}
+
+// readSecret returns the contents of path without the trailing newline,
+// path - is stdin
+func readSecret(path string) (string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return "", err
+		}
+		defer f.Close()
+	}
+	b, err := io.ReadAll(io.LimitReader(f, maxSecret+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxSecret {
+		return "", fmt.Errorf("secret is larger than %d bytes", maxSecret)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func secretListCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	withTenant := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = withTenant(ctx)
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		list, err := db.ListSecrets(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(r.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTENANT\tMODIFIED")
+		for _, s := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.Tenant, s.Modified.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+}
+
+func secretRmCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	withTenant := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = withTenant(ctx)
+		if len(r.args) == 0 {
+			return usageErrorf("secret rm needs at least one secret name")
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		tenant, _ := data.TenantFrom(ctx)
+		var errs []error
+		for _, name := range r.args {
+			err := db.DeleteSecret(ctx, tenant, name)
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				errs = append(errs, fmt.Errorf("secret %s not found", name))
+			case err != nil:
+				errs = append(errs, fmt.Errorf("delete %s failed: %w", name, err))
+			default:
+				fmt.Fprintf(r.stdout, "- delete secret %s\n", name)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+func tenantCommand() *command {
+	return &command{
+		name:    "tenant",
+		summary: "Set, list and remove tenant quotas",
+		commands: []*command{
+			{name: "set", args: "<name>", summary: "Create a tenant or change its quotas", setup: tenantSetCommand,
+				description: "Create a tenant or change its quotas. A tenant's checks, results and api tokens\n" +
+					"are only visible to it. Give a team a token with token create --tenant and use\n" +
+					"--tenant with check, sync, import and export to act as the tenant.\n\n" +
+					"Example:\n  status tenant set team-api --max-checks 50 --min-interval 30s"},
+			{name: "list", summary: "List tenants", setup: tenantListCommand},
+			{name: "rm", args: "<name>...", summary: "Remove tenant quotas, their checks are kept", setup: tenantRmCommand},
+		},
+	}
+}
+
+func tenantSetCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	maxChecks := fs.Int("max-checks", 0, "how many checks the tenant can have, 0 is no limit")
+	minInterval := fs.Duration("min-interval", 0, "shortest check interval, e.g. 30s, 0 is no limit")
+	return func(ctx context.Context, r *runner) error {
+		if len(r.args) != 1 || r.args[0] == "" {
+			return usageErrorf("tenant set needs one tenant name")
+		}
+		if *maxChecks < 0 || *minInterval < 0 || *minInterval%time.Second != 0 {
+			return usageErrorf("--max-checks and --min-interval must be positive, --min-interval in whole seconds")
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		tenant := checks.Tenant{Name: r.args[0], MaxChecks: *maxChecks, MinInterval: int(minInterval.Seconds())}
+		if err := db.SaveTenant(ctx, tenant); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.stdout, "~ set tenant %s (%s)\n", tenant.Name, quotas(tenant))
+		return nil
+	}
+}
+
+func tenantListCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	return func(ctx context.Context, r *runner) error {
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		tenants, err := db.ListTenants(ctx)
+		if err != nil {
+			return err
+		}
+		statusChecks, err := db.ListStatusChecks(ctx)
+		if err != nil {
+			return err
+		}
+		counts := make(map[string]int)
+		for _, c := range statusChecks {
+			counts[c.Tenant]++
+		}
+		tw := tabwriter.NewWriter(r.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCHECKS\tQUOTAS")
+		for _, t := range tenants {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", t.Name, counts[t.Name], quotas(t))
+		}
+		return tw.Flush()
+	}
+}
+
+func tenantRmCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	return func(ctx context.Context, r *runner) error {
+		if len(r.args) == 0 {
+			return usageErrorf("tenant rm needs at least one tenant name")
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		var errs []error
+		for _, name := range r.args {
+			err := db.DeleteTenant(ctx, name)
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				errs = append(errs, fmt.Errorf("tenant %s not found", name))
+			case err != nil:
+				errs = append(errs, fmt.Errorf("delete %s failed: %w", name, err))
+			default:
+				fmt.Fprintf(r.stdout, "- delete tenant %s\n", name)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// quotas describes the quotas of t
+func quotas(t checks.Tenant) string {
+	maxChecks, minInterval := "unlimited checks", "any interval"
+	if t.MaxChecks > 0 {
+		maxChecks = fmt.Sprintf("at most %d checks", t.MaxChecks)
+	}
+	if t.MinInterval > 0 {
+		minInterval = fmt.Sprintf("interval at least %s", time.Duration(t.MinInterval)*time.Second)
+	}
+	return maxChecks + ", " + minInterval
+}
+
+// tenantFlag adds --tenant to fs. The returned func restricts ctx to the
+// tenant when the flag is set, "" is the default tenant.
+func tenantFlag(fs *flag.FlagSet) func(ctx context.Context) context.Context {
+	var tenant *string
+	fs.Func("tenant", "act as this tenant, only its checks, results, tokens and secrets are used", func(s string) error {
+		tenant = &s
+		return nil
+	})
+	return func(ctx context.Context) context.Context {
+		if tenant == nil {
+			return ctx
+		}
+		return data.WithTenant(ctx, *tenant)
+	}
+}
+
+// fileTenantFlag is tenantFlag for commands that make the checks match a
+// file. Without --tenant they act on the default tenant so checks of other
+// tenants are never deleted for being missing from the file.
+func fileTenantFlag(fs *flag.FlagSet) func(ctx context.Context) context.Context {
+	scope := tenantFlag(fs)
+	return func(ctx context.Context) context.Context {
+		ctx = scope(ctx)
+		if _, ok := data.TenantFrom(ctx); !ok {
+			ctx = data.WithTenant(ctx, "")
+		}
+		return ctx
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/data"
+)
+
+func tokenCommand() *command {
+	scopes := make([]string, len(auth.Scopes))
+	for i, s := range auth.Scopes {
+		scopes[i] = string(s)
+	}
+	return &command{
+		name:    "token",
+		summary: "Create, list and remove api tokens",
+		commands: []*command{
+			{name: "create", summary: "Create an api token and print it once", setup: tokenCreateCommand,
+				description: "Create an api token. The token is printed once, only a hash of it is stored.\n" +
+					"Scopes: " + strings.Join(scopes, ", ") + ". Give workers their own token with\n" +
+					"only the worker scope and set it as worker.token (WORKER_TOKEN). A token created\n" +
+					"with --tenant only sees that tenant's checks, results and tokens.\n\n" +
+					"Example:\n  status token create --name worker-us-east-1 --scope worker --expires 2160h"},
+			{name: "list", summary: "List api tokens", setup: tokenListCommand},
+			{name: "rm", args: "<id>...", summary: "Remove api tokens, requests using them are rejected", setup: tokenRmCommand},
+		},
+	}
+}
+
+func tokenCreateCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	var scopeFlags listFlag
+	name := fs.String("name", "", "what the token is for (required)")
+	fs.Var(&scopeFlags, "scope", "scope to grant, repeat or separate with commas (required)")
+	expires := fs.Duration("expires", 0, "how long the token is valid, e.g. 2160h, 0 never expires")
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) != 0 {
+			return usageErrorf("unexpected arguments %q, token create only takes flags", r.args)
+		}
+		if *name == "" {
+			return usageErrorf("--name is required")
+		}
+		if *expires < 0 {
+			return usageErrorf("--expires must not be negative")
+		}
+		var scopes []auth.Scope
+		for _, s := range scopeFlags.values(",") {
+			scope, err := auth.ParseScope(s)
+			if err != nil {
+				return usageError(err.Error())
+			}
+			scopes = append(scopes, scope)
+		}
+		if len(scopes) == 0 {
+			return usageErrorf("at least one --scope is required")
+		}
+		// workers run every tenant's checks
+		if _, ok := data.TenantFrom(ctx); ok && slices.Contains(scopes, auth.ScopeWorker) {
+			return usageErrorf("a tenant's token can not have the worker scope")
+		}
+
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		now := time.Now()
+		var expiry time.Time
+		if *expires > 0 {
+			expiry = now.Add(*expires)
+		}
+		token, secret, err := auth.NewToken(*name, scopes, now, expiry)
+		if err != nil {
+			return err
+		}
+		if err := db.CreateToken(ctx, token); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.stderr, "+ create token %s (%s), it is not shown again\n", token.ID, token.Name)
+		fmt.Fprintln(r.stdout, secret)
+		return nil
+	}
+}
+
+func tokenListCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		tokens, err := db.ListTokens(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		tw := tabwriter.NewWriter(r.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES\tTENANT")
+		for _, t := range tokens {
+			scopes := make([]string, len(t.Scopes))
+			for i, s := range t.Scopes {
+				scopes[i] = string(s)
+			}
+			expires := "never"
+			switch {
+			case !t.Expires.IsZero() && !now.Before(t.Expires):
+				expires = "expired"
+			case !t.Expires.IsZero():
+				expires = t.Expires.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(scopes, ","),
+				t.Created.Format(time.RFC3339), expires, t.Tenant)
+		}
+		return tw.Flush()
+	}
+}
+
+func tokenRmCommand(fs *flag.FlagSet) func(ctx context.Context, r *runner) error {
+	scope := tenantFlag(fs)
+	return func(ctx context.Context, r *runner) error {
+		ctx = scope(ctx)
+		if len(r.args) == 0 {
+			return usageErrorf("token rm needs at least one token id")
+		}
+		db, err := r.database(ctx)
+		if err != nil {
+			return err
+		}
+		defer db.Disconnect(context.Background())
+		var errs []error
+		for _, id := range r.args {
+			err := db.DeleteToken(ctx, id)
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				errs = append(errs, fmt.Errorf("token %s not found", id))
+			case err != nil:
+				errs = append(errs, fmt.Errorf("delete %s failed: %w", id, err))
+			default:
+				fmt.Fprintf(r.stdout, "- delete token %s\n", id)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"go.uber.org/zap"
+)
+
+// heartbeatTimeout bounds each heartbeat sent to the controller
+const heartbeatTimeout = 10 * time.Second
+
+// registration returns the worker's registration with its current stats.
+// It reads statusThreads so it is only called from RunWorker.
+func (state *State) registration(stopped bool) checks.Worker {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return checks.Worker{
+		ID:         state.ID,
+		Region:     state.Region,
+		Version:    state.Version,
+		Hostname:   state.hostname,
+		Capacity:   state.Config.Capacity,
+		Started:    state.started,
+		Stopped:    stopped,
+		Checks:     len(state.statusThreads),
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+	}
+}
+
+// sendHeartbeats sends each registration from heartbeats in order until
+// heartbeats is closed
+func (state *State) sendHeartbeats(ctx context.Context, heartbeats <-chan checks.Worker) {
+	for worker := range heartbeats {
+		state.heartbeat(ctx, worker)
+	}
+}
+
+// heartbeat registers the worker with the controller or renews its
+// registration. The controller records when it was last seen.
+func (state *State) heartbeat(ctx context.Context, worker checks.Worker) {
+	if err := state.sendHeartbeat(ctx, worker); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		state.Log.Warn("Heartbeat failed.", zap.String("worker_id", worker.ID), zap.Error(err))
+		return
+	}
+	state.Log.Debug("Heartbeat sent", zap.String("worker_id", worker.ID), zap.Bool("stopped", worker.Stopped))
+}
+
+func (state *State) sendHeartbeat(ctx context.Context, worker checks.Worker) error {
+	ctx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+	body, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		state.controllerURL("/api/v1/workers/"+url.PathEscape(worker.ID)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	state.authorize(req)
+	resp, err := state.controllerClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("register worker: %s", resp.Status)
+	}
+	return nil
+}
+
+// controllerURL returns path on Config.Controller
+func (state *State) controllerURL(path string) string {
+	return strings.TrimSuffix(state.Config.Controller, "/") + path
+}
+
+// authorize sets Config.Token on req, requests without it are rejected by
+// a controller with auth on
+func (state *State) authorize(req *http.Request) {
+	if state.Config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+state.Config.Token)
+	}
+}
+
+// controllerClient returns ControllerClient or http.DefaultClient
+func (state *State) controllerClient() *http.Client {
+	if state.ControllerClient != nil {
+		return state.ControllerClient
+	}
+	return http.DefaultClient
+}
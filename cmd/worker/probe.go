@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// Probe is the outcome of running a check once
+type Probe struct {
+	Result checks.StatusCheckResult
+	// Trace holds the timing of each phase of the request
+	Trace *RequestTrace
+	// TLS is the connection state of https requests
+	TLS *tls.ConnectionState
+	// Assertions holds every assertion of the check, they are not
+	// evaluated when the request failed
+	Assertions []AssertionResult
+	// Err is set when the request failed
+	Err error
+}
+
+// AssertionResult is an evaluated assertion, Failure is "" when it passed
+type AssertionResult struct {
+	Assertion checks.Assertion
+	Failure   string
+}
+
+// RunProbe runs check once through transport and records the result for
+// region. It only returns an error when no request can be built for the
+// check, a failed request is reported in Probe.Err and the result.
+func RunProbe(ctx context.Context, transport http.RoundTripper, check *checks.StatusCheck, region string) (Probe, error) {
+	probe := Probe{
+		Trace: NewRequestTrace(),
+		Result: checks.StatusCheckResult{
+			Metadata: checks.StatusCheckMetadata{Region: region, CheckID: check.ID, Tenant: check.Tenant},
+		},
+	}
+	req, err := newCheckRequest(check)
+	if err != nil {
+		return probe, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.HTTPTimeout)*time.Second)
+	defer cancel()
+	resp, err := probe.Trace.TraceRequest(ctx, transport, req)
+	result := &probe.Result
+	result.Timestamp = probe.Trace.start
+	result.ResponseID = checks.NewResponseID(region, check.ID, result.Timestamp)
+	if err != nil {
+		probe.Err = err
+		result.ResponseInfo = err.Error()
+		return probe, nil
+	}
+	defer resp.Body.Close()
+
+	probe.TLS = resp.TLS
+	result.ResponseCode = resp.StatusCode
+	result.ResponseInfo = resp.Status
+	result.TTFB = probe.Trace.TTFB.Milliseconds()
+	result.DNSTiming = probe.Trace.DNSDur.Milliseconds()
+	result.TLSTiming = probe.Trace.TLSHandshakeDur.Milliseconds()
+	result.ConnectTiming = probe.Trace.ConnDur.Milliseconds()
+	probe.Assertions = assertionResults(check, resp, probe.Trace.TTFB)
+	if failure := firstFailure(probe.Assertions); failure != "" {
+		result.AssertionFailed = true
+		result.ResponseInfo += "; " + failure
+	}
+	return probe, nil
+}
+
+// assertionResults evaluates every assertion of check against resp
+func assertionResults(check *checks.StatusCheck, resp *http.Response, ttfb time.Duration) []AssertionResult {
+	var body []byte
+	var bodyErr error
+	results := make([]AssertionResult, len(check.Assertions))
+	for i, a := range check.Assertions {
+		results[i].Assertion = a
+		if a.NeedsBody() && body == nil && bodyErr == nil {
+			body, bodyErr = io.ReadAll(io.LimitReader(resp.Body, maxAssertionBody))
+		}
+		if a.NeedsBody() && bodyErr != nil {
+			results[i].Failure = "reading body failed: " + bodyErr.Error()
+			continue
+		}
+		results[i].Failure = a.Check(resp, ttfb, body)
+	}
+	return results
+}
+
+// firstFailure describes the first failed assertion, "" when they all passed
+func firstFailure(results []AssertionResult) string {
+	for _, a := range results {
+		if a.Failure != "" {
+			return "assertion failed: " + a.Failure
+		}
+	}
+	return ""
+}
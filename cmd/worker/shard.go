@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"go.uber.org/zap"
+)
+
+// watchPeers reads the region's workers from DBClient three times per
+// Config.Handoff until ctx is cancelled, so every worker sees a worker
+// joining before it becomes a shard member. It signals rebalance when the
+// shard members change so RunWorker starts and stops the checks that moved.
+func (state *State) watchPeers(ctx context.Context, rebalance chan<- struct{}) {
+	ticker := time.NewTicker(time.Duration(state.Config.Handoff) / 3)
+	defer ticker.Stop()
+	var members []string
+	for {
+		workers, err := state.DBClient.ListWorkers(ctx)
+		if err != nil && ctx.Err() == nil {
+			state.Log.Error("ListWorkers failed.", zap.String("error", err.Error()))
+		} else if err == nil {
+			state.peersMutex.Lock()
+			state.peers = workers
+			state.peersMutex.Unlock()
+		}
+		// members also change without new data, when a worker passes its
+		// handoff or misses a heartbeat
+		if current := state.members(time.Now()); !slices.Equal(current, members) {
+			members = current
+			select {
+			case rebalance <- struct{}{}:
+			default: // a rebalance is already pending
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// peerTimeout is how long a worker can go without a heartbeat before the
+// others take over its checks: one missed heartbeat, with Config.Handoff
+// for the heartbeat to arrive. Config.PeerTimeout can shorten it.
+func (state *State) peerTimeout() time.Duration {
+	timeout := time.Duration(state.Config.StatusInterval + state.Config.Handoff)
+	if peerTimeout := time.Duration(state.Config.PeerTimeout); peerTimeout > 0 && peerTimeout < timeout {
+		return peerTimeout
+	}
+	return timeout
+}
+
+// members returns the shard members of the worker's region at now
+func (state *State) members(now time.Time) []string {
+	state.peersMutex.Lock()
+	peers := state.peers
+	state.peersMutex.Unlock()
+	return checks.ShardMembers(peers, state.Region, now, state.peerTimeout(), time.Duration(state.Config.Handoff))
+}
+
+// owns reports whether the worker runs checkID at now. Workers that do not
+// register with a controller run every check of the region. Every check
+// is also run when the region has no shard members, e.g. while the
+// controller is down and heartbeats are missed, because running a check
+// twice is better than not at all.
+func (state *State) owns(checkID string, now time.Time) bool {
+	if state.Config.Controller == "" {
+		return true
+	}
+	members := state.members(now)
+	if len(members) == 0 {
+		return true
+	}
+	return checks.ShardOwner(checkID, members) == state.ID
+}
@@ -3,44 +3,41 @@ package worker
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/larntz/status/internal/checks"
 	"go.uber.org/zap"
 )
 
-func (state *State) statusCheck(ch chan *checks.StatusCheck, delay int) {
+func (state *State) statusCheck(ch chan *checks.StatusCheck, delay time.Duration) {
 	defer state.wg.Done()
 	check := <-ch
-
-	// delay to distribute checks over time
-	state.Log.Debug("Check Delay", zap.String("CheckID", check.ID), zap.Int("Seconds", delay))
-	time.Sleep(time.Duration(delay) * time.Second)
-
-	// Setup HTTP client once before we start the thread loop
-	req, err := http.NewRequest("GET", check.URL, nil)
-	if err != nil {
-		state.Log.Error("failed to create NewRequest", zap.String("err", err.Error()))
+	if !check.Active {
+		return
 	}
 
-	reqTrace := NewRequestTrace()
-
-	// run the check [almost] immediately, then after the first
-	// run Reset ticker to Interval. Helps with testing also.
-	ticker := time.NewTicker(1 * time.Nanosecond)
+	// the first run waits delay to distribute checks over time, then the
+	// ticker is Reset to Interval
+	state.Log.Debug("Check Delay", zap.String("CheckID", check.ID), zap.Duration("delay", delay))
+	ticker := time.NewTicker(max(delay, time.Nanosecond))
+	defer ticker.Stop()
 	firstRun := true
 
 	for {
 		select {
 		case update, ok := <-ch:
-			if !update.Active {
-				state.Log.Info("Check no longer active. Exiting.", zap.String("CheckID", check.ID))
+			if !ok {
+				state.Log.Info("Check channel closed. Exiting.", zap.String("CheckID", check.ID))
 				return
-			} else if !ok {
-				state.Log.Info("Check channel closed. Exiting.\n", zap.String("CheckID", check.ID))
+			} else if !update.Active {
+				state.Log.Info("Check no longer active. Exiting.", zap.String("CheckID", check.ID))
 				return
 			}
-			state.Log.Debug("Check updated.", zap.Any("check", update))
+			state.Log.Debug("Check updated.", zap.Any("check", update.Redacted()))
+			if update.Interval != check.Interval && !firstRun {
+				ticker.Reset(time.Duration(update.Interval) * time.Second)
+			}
 			check = update
 
 		case <-ticker.C:
@@ -49,46 +46,32 @@ func (state *State) statusCheck(ch chan *checks.StatusCheck, delay int) {
 				ticker.Reset(time.Duration(check.Interval) * time.Second)
 			}
 			state.Log.Debug("Starting Check", zap.String("CheckID", check.ID), zap.Bool("Active", check.Active))
-			state.Log.Debug("Check Details", zap.Any("check", check))
+			state.Log.Debug("Check Details", zap.Any("check", check.Redacted()))
 
-			result := checks.StatusCheckResult{
-				Metadata: checks.StatusCheckMetadata{
-					Region:  state.Region,
-					CheckID: check.ID,
-				},
+			// the request is built and secrets are resolved on every run
+			// so updates to the check and its secrets take effect
+			resolved, err := state.Secrets.Resolve(context.Background(), *check)
+			if err != nil {
+				state.Log.Error("Resolving secrets failed", zap.String("check_id", check.ID), zap.String("err", err.Error()))
+				continue
 			}
-
-			timeout := time.Duration(check.HTTPTimeout) * time.Second
-			ctx, cancelCTX := context.WithTimeout(context.Background(), timeout)
-
-			// TODO every result is getting sent to the database twice for some reason.
-			resp, err := reqTrace.TraceRequest(ctx, state.HTTPTransport, req)
+			probe, err := RunProbe(context.Background(), state.HTTPTransport, &resolved, state.Region)
 			if err != nil {
-				result.ResponseInfo = err.Error()
+				state.Log.Error("failed to create NewRequest", zap.String("err", err.Error()))
+				continue
+			}
+			result := probe.Result
+			if probe.Err != nil {
 				state.Log.Error("httpClient.Get() error",
 					zap.String("check_id", result.Metadata.CheckID),
 					zap.String("region", result.Metadata.Region),
 					zap.Int("response_code", result.ResponseCode),
 					zap.String("response_info", result.ResponseInfo),
 				)
-				result.ResponseCode = 0
 				state.statusCheckResultCh <- &result
-				cancelCTX()
 				continue
 			}
 
-			result.Timestamp = reqTrace.start
-			result.ResponseCode = resp.StatusCode
-			result.ResponseInfo = resp.Status
-			result.TTFB = reqTrace.TTFB.Milliseconds()
-			result.DNSTiming = reqTrace.DNSDur.Milliseconds()
-			result.TLSTiming = reqTrace.TLSHandshakeDur.Milliseconds()
-			result.ConnectTiming = reqTrace.ConnDur.Milliseconds()
-
-			// done with resp
-			resp.Body.Close()
-			cancelCTX()
-
 			state.statusCheckResultCh <- &result
 
 			state.Log.Info("check_result",
@@ -100,3 +83,29 @@ func (state *State) statusCheck(ch chan *checks.StatusCheck, delay int) {
 		}
 	}
 }
+
+// maxAssertionBody is how much of the response body assertions can inspect
+const maxAssertionBody = 1 << 20
+
+// newCheckRequest returns the GET request for check with its headers set
+func newCheckRequest(check *checks.StatusCheck) (*http.Request, error) {
+	req, err := http.NewRequest("GET", check.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range check.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// checkAssertions evaluates the check's assertions against resp. It
+// returns a description of the first failed assertion or "" when they
+// all passed.
+func checkAssertions(check *checks.StatusCheck, resp *http.Response, ttfb time.Duration) string {
+	return firstFailure(assertionResults(check, resp, ttfb))
+}
@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// Store is what the worker reads and writes. It is the database, or the
+// controller for a worker with a client certificate, see ControllerStore.
+type Store interface {
+	// GetRegionChecks returns all checks assigned to region
+	GetRegionChecks(ctx context.Context, region string) (checks.Checks, error)
+	// SendStatusResults writes results and returns how many were inserted,
+	// see data.Database
+	SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error)
+	// ListWorkers returns the registered workers, at least those of the
+	// worker's region
+	ListWorkers(ctx context.Context) ([]checks.Worker, error)
+	// GetSecret returns data.ErrNotFound if tenant has no secret with name
+	GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error)
+}
+
+// ControllerStore returns a Store that uses the controller's worker api
+// instead of the database. The controller only serves the worker its
+// region's checks, workers and secrets and only takes results for them,
+// so a worker needs no database credentials.
+func (state *State) ControllerStore() Store {
+	return &controllerStore{state: state}
+}
+
+type controllerStore struct {
+	state *State
+}
+
+// sendResultsResponse is the body of POST /api/v1/regions/{region}/results
+type sendResultsResponse struct {
+	Inserted int    `json:"inserted"`
+	Failed   []int  `json:"failed"`
+	Error    string `json:"error"`
+}
+
+// sealedSecret is the body of GET /api/v1/regions/{region}/secrets/{name}
+type sealedSecret struct {
+	checks.Secret
+	Value string `json:"value"`
+}
+
+func (s *controllerStore) GetRegionChecks(ctx context.Context, region string) (checks.Checks, error) {
+	var checkList checks.Checks
+	status, err := s.do(ctx, http.MethodGet, "/api/v1/regions/"+url.PathEscape(region)+"/checks", nil, &checkList)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("get checks: %d %s", status, http.StatusText(status))
+	}
+	return checkList, err
+}
+
+func (s *controllerStore) SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error) {
+	var response sendResultsResponse
+	status, err := s.do(ctx, http.MethodPost, s.regionPath("/results"), results, &response)
+	switch {
+	case err != nil:
+		return 0, err
+	case status == http.StatusInternalServerError && len(response.Failed) > 0:
+		return response.Inserted, &data.PartialWriteError{Failed: response.Failed, Err: errors.New(response.Error)}
+	case status != http.StatusOK:
+		return 0, fmt.Errorf("send results: %d %s", status, response.Error)
+	}
+	return response.Inserted, nil
+}
+
+func (s *controllerStore) ListWorkers(ctx context.Context) ([]checks.Worker, error) {
+	var workers []checks.Worker
+	status, err := s.do(ctx, http.MethodGet, s.regionPath("/workers"), nil, &workers)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("list workers: %d %s", status, http.StatusText(status))
+	}
+	return workers, err
+}
+
+func (s *controllerStore) GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error) {
+	var secret sealedSecret
+	status, err := s.do(ctx, http.MethodGet,
+		s.regionPath("/secrets/"+url.PathEscape(name)+"?tenant="+url.QueryEscape(tenant)), nil, &secret)
+	switch {
+	case err != nil:
+		return checks.Secret{}, err
+	case status == http.StatusNotFound:
+		return checks.Secret{}, data.ErrNotFound
+	case status != http.StatusOK:
+		return checks.Secret{}, fmt.Errorf("get secret: %d %s", status, http.StatusText(status))
+	}
+	secret.Secret.Value = secret.Value
+	return secret.Secret, nil
+}
+
+// regionPath returns path under the worker's region in the controller api
+func (s *controllerStore) regionPath(path string) string {
+	return "/api/v1/regions/" + url.PathEscape(s.state.Region) + path
+}
+
+// do sends body as JSON to path on the controller and decodes the JSON
+// response into out, whatever its status
+func (s *controllerStore) do(ctx context.Context, method string, path string, body any, out any) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.state.controllerURL(path), reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	s.state.authorize(req)
+	resp, err := s.state.controllerClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return resp.StatusCode, nil
+}
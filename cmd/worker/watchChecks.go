@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/sse"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxStreamRetry is the longest wait before reconnecting to the
+	// controller
+	maxStreamRetry = 30 * time.Second
+	// streamIdleTimeout closes a check stream that sent nothing, not even
+	// the keep-alive the controller sends every 15 seconds
+	streamIdleTimeout = 45 * time.Second
+)
+
+// watchChecks sends the region's checks to updates whenever the controller
+// pushes a change, until ctx is cancelled. A controller that does not
+// treat the worker as a worker only pushes that the checks changed, that
+// is signalled on reload. The stream is reopened when it ends and the
+// controller sends the current checks again on connect.
+func (state *State) watchChecks(ctx context.Context, updates chan<- checks.Checks, reload chan<- struct{}) {
+	client := state.controllerClient()
+	streamURL := state.controllerURL("/api/v1/regions/" + url.PathEscape(state.Region) + "/checks/stream")
+
+	retry := time.Second
+	for {
+		received, err := state.readCheckStream(ctx, client, streamURL, updates, reload)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			retry = time.Second
+		}
+		state.Log.Warn("Check stream closed, reconnecting.", zap.String("url", streamURL),
+			zap.Error(err), zap.Duration("retry", retry))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(2*retry, maxStreamRetry)
+	}
+}
+
+// readCheckStream sends the checks events of the stream at streamURL to
+// updates and signals its reload events on reload until the stream ends.
+// It reports whether any event was received.
+func (state *State) readCheckStream(ctx context.Context, client *http.Client, streamURL string,
+	updates chan<- checks.Checks, reload chan<- struct{}) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	state.authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("check stream: %s", resp.Status)
+	}
+	state.Log.Info("Check stream opened", zap.String("url", streamURL))
+
+	received := false
+	idle := time.AfterFunc(streamIdleTimeout, cancel)
+	defer idle.Stop()
+	body := &idleReader{r: resp.Body, timer: idle}
+	err = sse.Read(body, func(e sse.Event) error {
+		if e.Type == "reload" {
+			received = true
+			select {
+			case reload <- struct{}{}:
+			default: // a reload is already waiting
+			}
+			return nil
+		}
+		if e.Type != "checks" {
+			return nil
+		}
+		var checkList checks.Checks
+		if err := json.Unmarshal([]byte(e.Data), &checkList); err != nil {
+			return fmt.Errorf("invalid checks event: %w", err)
+		}
+		received = true
+		select {
+		case updates <- checkList:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	return received, err
+}
+
+// idleReader resets timer after every read
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.timer.Reset(streamIdleTimeout)
+	return n, err
+}
@@ -2,14 +2,20 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
-	"runtime"
+	"os"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/config"
 	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/secrets"
 	"go.uber.org/zap"
 )
 
@@ -17,132 +23,317 @@ import (
 // A map containing with keys being the CheckID and
 // values are channels allowing check updates to be sent to the thread
 type State struct {
-	Region              string
-	DBClient            data.Database
-	HTTPTransport       http.RoundTripper
+	// ID identifies the worker to the controller, it is unique per process
+	ID     string
+	Region string
+	// Version is reported to the controller when the worker registers
+	Version       string
+	Config        config.Worker
+	DBClient      Store
+	HTTPTransport http.RoundTripper
+	// FlushTimeout bounds sending the results left when the worker stops
+	FlushTimeout time.Duration
+	// Secrets resolves the secret references of checks before they run
+	Secrets *secrets.Resolver
+	// ControllerClient sends heartbeats to and receives check changes from
+	// Config.Controller, http.DefaultClient is used when it is nil
+	ControllerClient    *http.Client
 	Log                 *zap.Logger
 	statusChecks        map[string]*checks.StatusCheck
-	statusThreads       map[string](chan *checks.StatusCheck)
+	statusThreads       map[string](chan *checks.StatusCheck) // running checks
 	wg                  sync.WaitGroup
 	statusCheckResultCh chan *checks.StatusCheckResult
+	hostname            string
+	started             time.Time
+	peersMutex          sync.Mutex
+	peers               []checks.Worker // every registered worker, see owns
 }
 
-// NewState creates a new empty State struct
-func NewState() *State {
+// NewState creates a new empty State struct for cfg.Region
+func NewState(cfg config.Worker) *State {
+	hostname, _ := os.Hostname()
 	state := &State{
+		ID:                  fmt.Sprintf("%s-%08x", hostname, rand.Uint32()),
+		Region:              cfg.Region,
+		Config:              cfg,
+		Secrets:             &secrets.Resolver{Dir: cfg.SecretsDir},
 		statusChecks:        make(map[string]*checks.StatusCheck),
 		statusThreads:       make(map[string](chan *checks.StatusCheck)),
-		statusCheckResultCh: make(chan *checks.StatusCheckResult, 20000),
+		statusCheckResultCh: make(chan *checks.StatusCheckResult, cfg.ResultBuffer),
+		hostname:            hostname,
+		started:             time.Now().UTC(),
 	}
 	return state
 }
 
-// RunWorker runs the worker
-func (state *State) RunWorker() {
-	go state.sendResultsWorker(30000) // 30 seconds in ms
+// defaultFlushTimeout bounds the last send of results when FlushTimeout
+// is not set
+const defaultFlushTimeout = 30 * time.Second
+
+// RunWorker runs the worker until ctx is cancelled. Checks are loaded from
+// DBClient every Config.UpdateInterval and, when Config.Controller is
+// set, as soon as the controller pushes a change. The worker then also
+// registers with the controller, sends its stats as a heartbeat every
+// Config.StatusInterval and shares the region's checks with the other
+// registered workers, see owns. When ctx is cancelled the checks are
+// stopped and their results sent before RunWorker returns.
+func (state *State) RunWorker(ctx context.Context) {
+	resultsDone := make(chan struct{})
+	go func() {
+		state.sendResultsWorker(ctx, time.Duration(state.Config.SendInterval))
+		close(resultsDone)
+	}()
+
+	pushed := make(chan checks.Checks)
+	reload, rebalance := make(chan struct{}, 1), make(chan struct{}, 1)
+	registered := state.Config.Controller != ""
+	heartbeats, heartbeatsDone := make(chan checks.Worker, 1), make(chan struct{})
+	if registered {
+		state.Log.Info("Registering with controller", zap.String("worker_id", state.ID),
+			zap.String("controller", state.Config.Controller))
+		heartbeats <- state.registration(false)
+		go func() {
+			state.sendHeartbeats(ctx, heartbeats)
+			close(heartbeatsDone)
+		}()
+		go state.watchChecks(ctx, pushed, reload)
+		go state.watchPeers(ctx, rebalance)
+	}
 
 	firstRun := true
 	updateChecksTicker := time.NewTicker(1 * time.Nanosecond)
-	statusTicker := time.NewTicker(time.Duration(1) * time.Minute)
+	statusTicker := time.NewTicker(time.Duration(state.Config.StatusInterval))
 
 	for {
 		select {
+		case <-ctx.Done():
+			state.Log.Info("Worker stopping", zap.String("reason", ctx.Err().Error()))
+			state.stopChecks()
+			// the checks have stopped, send the results they left
+			close(state.statusCheckResultCh)
+			<-resultsDone
+			if registered {
+				// tell the controller the region lost a worker rather than
+				// waiting for the heartbeat to time out, after any heartbeat
+				// still being sent so it is not overwritten
+				close(heartbeats)
+				<-heartbeatsDone
+				state.heartbeat(context.Background(), state.registration(true))
+			}
+			return
 		case <-updateChecksTicker.C:
 			if firstRun {
-				updateChecksTicker.Reset(time.Duration(3) * time.Minute)
+				updateChecksTicker.Reset(time.Duration(state.Config.UpdateInterval))
 				firstRun = false
 			}
 			state.Log.Info("Update Status Checks Start")
-			newChecks := state.UpdateChecks()
-			for _, c := range newChecks.StatusChecks {
-				go state.statusCheck(state.statusThreads[c.ID], rand.Intn(60))
-			}
+			state.startChecks(state.UpdateChecks(ctx))
+		case checkList := <-pushed:
+			state.Log.Info("Checks pushed", zap.Int("check_count", len(checkList.StatusChecks)))
+			state.startChecks(state.applyChecks(checkList))
+		case <-reload:
+			state.Log.Info("Checks changed, reloading")
+			state.startChecks(state.UpdateChecks(ctx))
+		case <-rebalance:
+			state.Log.Info("Shard members changed", zap.Strings("members", state.members(time.Now())))
+			state.startChecks(state.rebalance())
 		case <-statusTicker.C:
-			var mem runtime.MemStats
-			runtime.ReadMemStats(&mem)
-			state.Log.Info("status_ticker", zap.Int("num_goroutines", runtime.NumGoroutine()), zap.Uint64("heap_alloc", mem.HeapAlloc))
+			stats := state.registration(false)
+			state.Log.Info("status_ticker", zap.Int("num_goroutines", stats.Goroutines), zap.Uint64("heap_alloc", stats.HeapAlloc),
+				zap.Int("check_count", stats.Checks))
+			if registered {
+				// skipped while the last heartbeat is still waiting to be sent
+				select {
+				case heartbeats <- stats:
+				default:
+				}
+			}
 		}
 	}
-
-	// TODO graceful shutdowns
-	// state.wg.Wait()
 }
 
-// UpdateChecks fetches checks from DB and updates threads and state.checks.StatusChecks
-func (state *State) UpdateChecks() checks.Checks {
-	//TODO Updates are not working properly
-	// updated a check url but it kept using the old url
-
-	/*
-			  - [x] Change active from true to false. Shuts down goroutine.
-			  - [x] Change active from false to true. Starts new goroutine.
-		    - [x] Add new check
-			  - [ ] Change interval; close existing goroutine and start another.
-			  - [ ] Change url; close existing goroutine and start another.
-	*/
-
-	newChecks := checks.Checks{}
-	// Fetch checks and populate statusChecks map.
-	checkList, err := state.DBClient.GetRegionChecks(state.Region)
+// UpdateChecks fetches checks from DBClient and updates threads and
+// state.statusChecks. It returns the checks that need a thread started.
+func (state *State) UpdateChecks(ctx context.Context) checks.Checks {
+	checkList, err := state.DBClient.GetRegionChecks(ctx, state.Region)
 	if err != nil {
+		// keep running the checks we have
 		state.Log.Error("GetRegionChecks failed.", zap.String("error", err.Error()))
+		return checks.Checks{}
 	}
+	// TODO
+	// update ssl checks
+	return state.applyChecks(checkList)
+}
 
-	for i, update := range checkList.StatusChecks {
-		_, containsKey := state.statusChecks[update.ID]
-		if containsKey && state.statusChecks[update.ID].Active {
-			// check url or interval change; if yes close thread and start another.
-			// better way to do that than a bunch of nested ifs?
-			state.statusChecks[update.ID] = &checkList.StatusChecks[i]
-			state.statusThreads[update.ID] <- state.statusChecks[update.ID]
+// applyChecks makes the running checks match checkList. Only the checks
+// the worker owns run, see owns. Running checks are sent their update, or
+// stopped when they are inactive, owned by another worker or no longer in
+// the list. A Redacted check is ignored, the check keeps running as it
+// was. It returns the active, owned checks that are not running, their
+// threads hold the check and are started by startChecks.
+func (state *State) applyChecks(checkList checks.Checks) checks.Checks {
+	newChecks := checks.Checks{}
+	listed := make(map[string]bool, len(checkList.StatusChecks))
+	now := time.Now()
+	for i := range checkList.StatusChecks {
+		update := &checkList.StatusChecks[i]
+		listed[update.ID] = true
+		if update.IsRedacted() {
+			state.Log.Warn("Check has redacted credentials, ignoring it", zap.String("CheckID", update.ID))
 			continue
 		}
-		if containsKey && !state.statusChecks[update.ID].Active { // original check is not active, update is active
-			state.statusChecks[update.ID] = &checkList.StatusChecks[i]
-			newChecks.StatusChecks = append(newChecks.StatusChecks, checkList.StatusChecks[i])
-			//state.statusThreads[update.ID] = make(chan *checks.StatusCheck, 1)
-			//state.statusThreads[update.ID] <- state.statusChecks[update.ID]
-			continue
+		current := state.statusChecks[update.ID]
+		state.statusChecks[update.ID] = update
+		ch, running := state.statusThreads[update.ID]
+		owned := state.owns(update.ID, now)
+		switch {
+		case running && !update.Active:
+			sendUpdate(ch, update)
+			delete(state.statusThreads, update.ID)
+		case running && !owned:
+			state.Log.Info("Check moved to another worker", zap.String("CheckID", update.ID))
+			stopped := *update
+			stopped.Active = false
+			sendUpdate(ch, &stopped)
+			delete(state.statusThreads, update.ID)
+		case running:
+			if !reflect.DeepEqual(current, update) {
+				sendUpdate(ch, update)
+			}
+		case update.Active && owned:
+			ch = make(chan *checks.StatusCheck, 1)
+			ch <- update
+			state.statusThreads[update.ID] = ch
+			newChecks.StatusChecks = append(newChecks.StatusChecks, *update)
 		}
-		if containsKey && !update.Active { // original check is active, update is not active
-			state.statusChecks[update.ID] = &checkList.StatusChecks[i]
-			state.statusThreads[update.ID] <- state.statusChecks[update.ID]
+	}
+
+	// checks that were deleted or moved to another region
+	for id := range state.statusChecks {
+		if listed[id] {
 			continue
 		}
-		if !containsKey && update.Active { // add new active check and append to newChecks
-			state.statusChecks[update.ID] = &checkList.StatusChecks[i]
-			newChecks.StatusChecks = append(newChecks.StatusChecks, checkList.StatusChecks[i])
-			state.statusThreads[update.ID] = make(chan *checks.StatusCheck, 1)
-			state.statusThreads[update.ID] <- state.statusChecks[update.ID]
+		if ch, running := state.statusThreads[id]; running {
+			state.Log.Info("Check removed from region", zap.String("CheckID", id))
+			stopped := *state.statusChecks[id]
+			stopped.Active = false
+			sendUpdate(ch, &stopped)
+			delete(state.statusThreads, id)
 		}
+		delete(state.statusChecks, id)
 	}
-
 	return newChecks
+}
 
-	// TODO
-	// update ssl checks
+// rebalance applies the region's checks again after the shard members
+// changed, it returns the checks the worker took over
+func (state *State) rebalance() checks.Checks {
+	all := checks.Checks{Region: state.Region}
+	for _, c := range state.statusChecks {
+		all.StatusChecks = append(all.StatusChecks, *c)
+	}
+	return state.applyChecks(all)
 }
 
-func (state *State) sendResultsWorker(intervalMS int) {
-	sendTicker := time.NewTicker(time.Duration(intervalMS) * time.Millisecond)
-	var results []interface{}
+// startChecks starts a thread for each of newChecks
+func (state *State) startChecks(newChecks checks.Checks) {
+	for _, c := range newChecks.StatusChecks {
+		state.wg.Add(1)
+		go state.statusCheck(state.statusThreads[c.ID], state.jitter())
+	}
+}
+
+// stopChecks stops every thread and waits for them to exit
+func (state *State) stopChecks() {
+	for id, ch := range state.statusThreads {
+		stopped := *state.statusChecks[id]
+		stopped.Active = false
+		sendUpdate(ch, &stopped)
+		delete(state.statusThreads, id)
+	}
+	state.wg.Wait()
+}
+
+// sendUpdate sends check to a thread, replacing an update the thread has
+// not read yet so it never blocks
+func sendUpdate(ch chan *checks.StatusCheck, check *checks.StatusCheck) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- check
+}
+
+// jitter returns a random delay up to Config.MaxJitter
+func (state *State) jitter() time.Duration {
+	if state.Config.MaxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(state.Config.MaxJitter)))
+}
+
+// sendResultsWorker sends the results of the checks every interval. It
+// keeps reading results after ctx is cancelled so stopping checks never
+// block, and returns once RunWorker closes statusCheckResultCh after
+// sending the results that are left.
+func (state *State) sendResultsWorker(ctx context.Context, interval time.Duration) {
+	sendTicker := time.NewTicker(interval)
+	defer sendTicker.Stop()
+	var results []checks.StatusCheckResult
 	for {
 		select {
 		case <-sendTicker.C:
-			if len(results) > 0 {
-				insertResult, err := state.DBClient.SendResults(results)
-				if err != nil {
-					state.Log.Error("send_results", zap.String("error", err.Error()))
-					continue
+			if ctx.Err() != nil {
+				continue // stopping, the results are sent below
+			}
+			results = state.sendResults(ctx, results)
+		case result, ok := <-state.statusCheckResultCh:
+			if !ok {
+				timeout := state.FlushTimeout
+				if timeout <= 0 {
+					timeout = defaultFlushTimeout
+				}
+				flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				if results = state.sendResults(flushCtx, results); len(results) > 0 {
+					state.Log.Error("Results lost on stop", zap.Int("lost_items", len(results)))
 				}
-				state.Log.Info("send_results", zap.Int("inserted_items", insertResult))
-				results = results[:0] // empty results
-			} else {
-				state.Log.Info("InsertMany - no results to insert")
+				return
 			}
-
-		case result := <-state.statusCheckResultCh:
 			results = append(results, *result)
 		}
 	}
 }
+
+// sendResults writes results and returns the ones to retry
+func (state *State) sendResults(ctx context.Context, results []checks.StatusCheckResult) []checks.StatusCheckResult {
+	if len(results) == 0 {
+		state.Log.Info("InsertMany - no results to insert")
+		return results
+	}
+	insertResult, err := state.DBClient.SendStatusResults(ctx, results)
+	if err != nil {
+		results = unsentResults(results, err)
+		state.Log.Error("send_results", zap.String("error", err.Error()),
+			zap.Int("inserted_items", insertResult), zap.Int("retry_items", len(results)))
+		return results
+	}
+	state.Log.Info("send_results", zap.Int("inserted_items", insertResult))
+	return results[:0] // empty results
+}
+
+// unsentResults returns the results that should be retried after
+// SendStatusResults failed. When the database reports a partial write only
+// the failed results are kept, otherwise the whole batch is retried.
+func unsentResults(results []checks.StatusCheckResult, err error) []checks.StatusCheckResult {
+	var pwe *data.PartialWriteError
+	if !errors.As(err, &pwe) {
+		return results
+	}
+	unsent := make([]checks.StatusCheckResult, 0, len(pwe.Failed))
+	for _, i := range pwe.Failed {
+		unsent = append(unsent, results[i])
+	}
+	return unsent
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/config"
 	"github.com/larntz/status/internal/data"
 	"go.uber.org/zap"
 )
@@ -16,8 +17,9 @@ type State struct {
 	Checks          checks.Checks
 	ChecksMutex     sync.Mutex
 	ChecksTimestamp time.Time
+	Config          config.Controller
 	Ctx             context.Context
-	DbClient        *data.Database
+	DbClient        data.Database
 	Log             *zap.Logger
 	Region          string
 }
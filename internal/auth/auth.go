@@ -0,0 +1,131 @@
+// Package auth issues and verifies the api tokens of the controller
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scope grants access to part of the controller api
+type Scope string
+
+// Scopes
+const (
+	ScopeChecksRead  Scope = "checks:read"
+	ScopeChecksWrite Scope = "checks:write"
+	ScopeResultsRead Scope = "results:read"
+	// ScopeWorker lets a worker read its region's checks and register
+	ScopeWorker Scope = "worker"
+)
+
+// Scopes lists every scope
+var Scopes = []Scope{ScopeChecksRead, ScopeChecksWrite, ScopeResultsRead, ScopeWorker}
+
+// tokenPrefix starts every token so they are easy to recognize, e.g. by
+// secret scanners
+const tokenPrefix = "st_"
+
+// Token is an api token. Only a hash of its secret is stored.
+type Token struct {
+	ID     string  `json:"id" bson:"_id"`
+	Name   string  `json:"name" bson:"name"`
+	Hash   string  `json:"-" bson:"hash"` // hex sha256 of the secret
+	Scopes []Scope `json:"scopes" bson:"scopes"`
+	// Created and Expires are UTC, a zero Expires never expires
+	Created time.Time `json:"created" bson:"created"`
+	Expires time.Time `json:"expires" bson:"expires"`
+	// Tenant restricts the token to one tenant's data, "" can see every
+	// tenant
+	Tenant string `json:"tenant,omitempty" bson:"tenant,omitempty"`
+}
+
+// Errors returned by Verify
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpired      = errors.New("token expired")
+)
+
+// ParseScope returns the scope named s
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range Scopes {
+		if string(scope) == s {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scope %q", s)
+}
+
+// NewToken returns a token with a random id and secret, and the string
+// the client sends. The string can not be recovered from the token.
+func NewToken(name string, scopes []Scope, created time.Time, expires time.Time) (Token, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	token := Token{
+		ID:      id,
+		Name:    name,
+		Hash:    hash(secret),
+		Scopes:  scopes,
+		Created: created.UTC(),
+		Expires: expires.UTC(),
+	}
+	return token, tokenPrefix + id + "_" + secret, nil
+}
+
+// ParseToken splits a token string into its id and secret
+func ParseToken(s string) (id string, secret string, err error) {
+	rest, ok := strings.CutPrefix(s, tokenPrefix)
+	if !ok {
+		return "", "", ErrInvalidToken
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidToken
+	}
+	return id, secret, nil
+}
+
+// Verify checks that secret belongs to t and t has not expired at now
+func (t Token) Verify(secret string, now time.Time) error {
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(t.Hash)) != 1 {
+		return ErrInvalidToken
+	}
+	if !t.Expires.IsZero() && !now.Before(t.Expires) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Allows reports whether t has scope
+func (t Token) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	now := time.Now()
+	token, s, err := NewToken("ci", []Scope{ScopeChecksRead}, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, err := ParseToken(s)
+	if err != nil || id != token.ID {
+		t.Fatalf("ParseToken. Want: %s Got: %s %v", token.ID, id, err)
+	}
+	if token.Hash == secret {
+		t.Fatal("token stores the secret")
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		now    time.Time
+		want   error
+	}{
+		{"valid", secret, now, nil},
+		{"wrong secret", secret + "0", now, ErrInvalidToken},
+		{"expired", secret, now.Add(time.Hour), ErrExpired},
+	}
+	for _, tt := range tests {
+		if err := token.Verify(tt.secret, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s. Want: %v Got: %v", tt.name, tt.want, err)
+		}
+	}
+	if !token.Allows(ScopeChecksRead) || token.Allows(ScopeWorker) {
+		t.Fatalf("Allows. Got: %v", token.Scopes)
+	}
+
+	for _, s := range []string{"", "st_", "st_abc", "st__secret", "xx_abc_secret"} {
+		if _, _, err := ParseToken(s); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("ParseToken %q. Want: ErrInvalidToken Got: %v", s, err)
+		}
+	}
+}
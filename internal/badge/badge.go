@@ -0,0 +1,83 @@
+// Package badge renders shields style SVG badges
+package badge
+
+import (
+	"fmt"
+	"html"
+	"math"
+)
+
+// Badge colors
+const (
+	Green       = "#4c1"
+	YellowGreen = "#97ca00"
+	Yellow      = "#dfb317"
+	Red         = "#e05d44"
+	Grey        = "#9f9f9f"
+)
+
+// padding on each side of the label and message text
+const padding = 6
+
+const svgTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">` +
+	`<title>%[4]s: %[5]s</title>` +
+	`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)">` +
+	`<rect width="%[2]d" height="20" fill="#555"/>` +
+	`<rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/>` +
+	`<rect width="%[1]d" height="20" fill="url(#s)"/>` +
+	`</g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%.1[7]f" y="15" fill="#010101" fill-opacity=".3">%[4]s</text>` +
+	`<text x="%.1[7]f" y="14">%[4]s</text>` +
+	`<text x="%.1[8]f" y="15" fill="#010101" fill-opacity=".3">%[5]s</text>` +
+	`<text x="%.1[8]f" y="14">%[5]s</text>` +
+	`</g></svg>`
+
+// Render returns a badge with label on the left and message on the right
+// on a background of color
+func Render(label string, message string, color string) []byte {
+	labelWidth := textWidth(label) + 2*padding
+	messageWidth := textWidth(message) + 2*padding
+	return []byte(fmt.Sprintf(svgTemplate,
+		labelWidth+messageWidth, labelWidth, messageWidth,
+		html.EscapeString(label), html.EscapeString(message), html.EscapeString(color),
+		float64(labelWidth)/2, float64(labelWidth)+float64(messageWidth)/2))
+}
+
+// UptimeColor returns the badge color for an uptime percentage
+func UptimeColor(percent float64) string {
+	switch {
+	case percent >= 99.9:
+		return Green
+	case percent >= 99:
+		return YellowGreen
+	case percent >= 95:
+		return Yellow
+	default:
+		return Red
+	}
+}
+
+// textWidth estimates the width in pixels of s in 11px Verdana
+func textWidth(s string) int {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case r == ' ':
+			width += 3.9
+		case r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ',' || r == ':' || r == '!' || r == '|' || r == '\'':
+			width += 3.4
+		case r == 'f' || r == 't' || r == 'r' || r == 'I' || r == '(' || r == ')' || r == '-':
+			width += 4.9
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W' || r == '%':
+			width += 11
+		case r >= 'A' && r <= 'Z':
+			width += 7.7
+		default:
+			width += 7
+		}
+	}
+	return int(math.Ceil(width))
+}
@@ -0,0 +1,32 @@
+package badge
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	svg := Render("api <prod>", "99.95%", Green)
+
+	// the badge must be well formed xml with the text escaped
+	decoder := xml.NewDecoder(strings.NewReader(string(svg)))
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			if err.Error() != "EOF" {
+				t.Fatalf("invalid svg: %v\n%s", err, svg)
+			}
+			break
+		}
+	}
+	for _, want := range []string{"api &lt;prod&gt;", "99.95%", `fill="#4c1"`} {
+		if !strings.Contains(string(svg), want) {
+			t.Fatalf("badge missing %q:\n%s", want, svg)
+		}
+	}
+
+	if textWidth("uptime 30d") >= textWidth("UPTIME 30D WWW") {
+		t.Fatal("textWidth should grow with wider text")
+	}
+}
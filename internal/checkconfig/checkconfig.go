@@ -0,0 +1,290 @@
+// Package checkconfig reads declarative check files so checks can be kept
+// in git and synced to the database
+package checkconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// Defaults for fields left out of a check file
+const (
+	DefaultInterval = time.Minute
+	DefaultTimeout  = 10 * time.Second
+)
+
+// File is a list of checks read from YAML or JSON:
+//
+//	checks:
+//	  - id: api-health
+//	    url: https://api.example.com/health
+//	    interval: 30s
+//	    timeout: 5s
+//	    regions: [us-east-1, eu-west-1]
+//	    headers:
+//	      Accept: application/json
+//	    assertions:
+//	      - type: body_contains
+//	        value: ok
+//	    tags: [team-api]
+type File struct {
+	Checks []Check `json:"checks" yaml:"checks"`
+}
+
+// Check is the file format of a checks.StatusCheck
+type Check struct {
+	ID         string             `json:"id" yaml:"id"`
+	Name       string             `json:"name,omitempty" yaml:"name,omitempty"`
+	Group      string             `json:"group,omitempty" yaml:"group,omitempty"`
+	URL        string             `json:"url" yaml:"url"`
+	Interval   Duration           `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout    Duration           `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Regions    []string           `json:"regions" yaml:"regions"`
+	Active     *bool              `json:"active,omitempty" yaml:"active,omitempty"` // default true
+	Headers    map[string]string  `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Assertions []checks.Assertion `json:"assertions,omitempty" yaml:"assertions,omitempty"`
+	Tags       []string           `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Duration is a whole number of seconds written as a number of seconds or
+// a duration string such as 30s or 5m
+type Duration time.Duration
+
+// UnmarshalJSON accepts a number of seconds or a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML accepts a number of seconds or a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+// MarshalJSON writes the duration as a string, e.g. 5m
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// MarshalYAML writes the duration as a string, e.g. 5m
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// Set parses a number of seconds or a duration string so a Duration can be
+// used as a flag
+func (d *Duration) Set(s string) error {
+	return d.parse(s)
+}
+
+func (d Duration) String() string {
+	seconds := int64(time.Duration(d).Seconds())
+	if seconds != 0 && seconds%60 == 0 {
+		return strconv.FormatInt(seconds/60, 10) + "m"
+	}
+	return strconv.FormatInt(seconds, 10) + "s"
+}
+
+func (d *Duration) parse(s string) error {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use seconds or e.g. 30s, 5m", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Load reads a check file. Files ending in .json are read as JSON,
+// anything else as YAML. Unknown fields are an error so typos are not
+// silently ignored.
+func Load(path string) (File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	return Parse(b, strings.EqualFold(filepath.Ext(path), ".json"))
+}
+
+// Parse decodes and validates a check file
+func Parse(b []byte, isJSON bool) (File, error) {
+	var file File
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return file, err
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return file, err
+		}
+	}
+	return file, file.Validate()
+}
+
+// Validate returns every problem found in the file
+func (f File) Validate() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, c := range f.Checks {
+		name := c.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if c.ID != "" && seen[c.ID] {
+			errs = append(errs, fmt.Errorf("check %s: duplicate id", name))
+		}
+		seen[c.ID] = true
+		for _, err := range c.problems() {
+			errs = append(errs, fmt.Errorf("check %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns an error if the check can not be run
+func (c Check) Validate() error {
+	return errors.Join(c.problems()...)
+}
+
+func (c Check) problems() []error {
+	var errs []error
+	if c.ID == "" {
+		errs = append(errs, errors.New("id is required"))
+	}
+	// secret references are only resolved on the worker, any value
+	// stands in for them here
+	if u, err := url.Parse(checks.MaskSecrets(c.URL, "x")); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("url must be an http or https url, got %q", c.URL))
+	}
+	if _, err := checks.SecretRefs(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	names := make([]string, 0, len(c.Headers))
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+	for _, name := range sorted(names) {
+		if _, err := checks.SecretRefs(c.Headers[name]); err != nil {
+			errs = append(errs, fmt.Errorf("header %s: %w", name, err))
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{{"interval", c.Interval}, {"timeout", c.Timeout}} {
+		if d.value < 0 || time.Duration(d.value)%time.Second != 0 {
+			errs = append(errs, fmt.Errorf("%s must be a positive whole number of seconds, got %s",
+				d.name, time.Duration(d.value)))
+		}
+	}
+	if len(c.Regions) == 0 {
+		errs = append(errs, errors.New("at least one region is required"))
+	}
+	for i, a := range c.Assertions {
+		if err := a.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("assertion %d: %w", i+1, err))
+		}
+	}
+	return errs
+}
+
+// StatusCheck converts c, filling in defaults. Modified and Serial are
+// left for the caller to set.
+func (c Check) StatusCheck() checks.StatusCheck {
+	interval, timeout := time.Duration(c.Interval), time.Duration(c.Timeout)
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return checks.StatusCheck{
+		ID:          c.ID,
+		URL:         c.URL,
+		Interval:    int(interval.Seconds()),
+		HTTPTimeout: int(timeout.Seconds()),
+		Regions:     c.Regions,
+		Active:      c.Active == nil || *c.Active,
+		Name:        c.Name,
+		Group:       c.Group,
+		Headers:     c.Headers,
+		Assertions:  c.Assertions,
+		Tags:        c.Tags,
+	}
+}
+
+// FromStatusCheck converts a checks.StatusCheck to the file format
+func FromStatusCheck(s checks.StatusCheck) Check {
+	c := Check{
+		ID:         s.ID,
+		Name:       s.Name,
+		Group:      s.Group,
+		URL:        s.URL,
+		Interval:   Duration(time.Duration(s.Interval) * time.Second),
+		Timeout:    Duration(time.Duration(s.HTTPTimeout) * time.Second),
+		Regions:    s.Regions,
+		Headers:    s.Headers,
+		Assertions: s.Assertions,
+		Tags:       s.Tags,
+	}
+	if !s.Active {
+		c.Active = &s.Active
+	}
+	return c
+}
+
+// FromStatusChecks converts checks to a File
+func FromStatusChecks(statusChecks []checks.StatusCheck) File {
+	file := File{Checks: make([]Check, len(statusChecks))}
+	for i, s := range statusChecks {
+		file.Checks[i] = FromStatusCheck(s)
+	}
+	return file
+}
+
+// Write encodes the file as JSON or YAML so it can be read by Load
+func (f File) Write(w io.Writer, isJSON bool) error {
+	if isJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(f)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// StatusChecks converts every check in the file
+func (f File) StatusChecks() []checks.StatusCheck {
+	statusChecks := make([]checks.StatusCheck, len(f.Checks))
+	for i, c := range f.Checks {
+		statusChecks[i] = c.StatusCheck()
+	}
+	return statusChecks
+}
@@ -0,0 +1,197 @@
+package checkconfig
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/test"
+)
+
+func TestLoadExample(t *testing.T) {
+	file, err := Load("../../checks.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Checks) != 3 {
+		t.Fatalf("checks. Want: 3 Got: %d", len(file.Checks))
+	}
+	mail := file.Checks[2].StatusCheck()
+	if mail.Interval != 300 || mail.HTTPTimeout != int(DefaultTimeout.Seconds()) || !mail.Active {
+		t.Fatalf("mail defaults. Got: %+v", mail)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	b := []byte(`{"checks": [{"id": "api", "url": "https://api.example.com", "interval": 30, "timeout": "5s",
+		"regions": ["us-east-1"], "active": false, "headers": {"Accept": "application/json"},
+		"assertions": [{"type": "body_contains", "value": "ok"}], "tags": ["api"]}]}`)
+	file, err := Parse(b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := checks.StatusCheck{
+		ID:          "api",
+		URL:         "https://api.example.com",
+		Interval:    30,
+		HTTPTimeout: 5,
+		Regions:     []string{"us-east-1"},
+		Headers:     map[string]string{"Accept": "application/json"},
+		Assertions:  []checks.Assertion{{Type: checks.AssertBodyContains, Value: "ok"}},
+		Tags:        []string{"api"},
+	}
+	if got := file.Checks[0].StatusCheck(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("StatusCheck.\nWant: %+v\nGot:  %+v", want, got)
+	}
+	if got := FromStatusCheck(want); !reflect.DeepEqual(got, file.Checks[0]) {
+		t.Fatalf("FromStatusCheck.\nWant: %+v\nGot:  %+v", file.Checks[0], got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{"unknown field", "checks:\n  - id: a\n    urll: https://a.example.com\n", []string{"urll"}},
+		{"invalid", `
+checks:
+  - url: ftp://a.example.com
+    interval: 1.5s
+  - id: b
+    url: https://b.example.com
+    regions: [us-east-1]
+    assertions:
+      - type: status_code
+        value: ok
+  - id: b
+    url: https://b.example.com
+    regions: [us-east-1]
+`, []string{
+			"check #1: id is required",
+			"check #1: url must be an http or https url",
+			"check #1: interval must be a positive whole number of seconds",
+			"check #1: at least one region is required",
+			"check b: assertion 1: status_code assertion value must be an integer",
+			"check b: duplicate id",
+		}},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.yaml), false)
+		if err == nil {
+			t.Fatalf("%s: want error", tt.name)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("%s: error missing %q:\n%v", tt.name, want, err)
+			}
+		}
+	}
+}
+
+func TestSecretRefs(t *testing.T) {
+	c := Check{ID: "c", URL: "https://${secret:user}:${secret:pass}@${secret:host}/?key=${secret:key}",
+		Regions: []string{"us-east-1"}, Headers: map[string]string{"Authorization": "Bearer ${secret:token}"}}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate with secret references: %v", err)
+	}
+	c.URL = "https://example.com/?key=${secret:}"
+	c.Headers["Authorization"] = "Bearer ${secret:a/b}"
+	err := c.Validate()
+	for _, want := range []string{`url: invalid secret name ""`, `header Authorization: invalid secret name "a/b"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate. Want: %s Got: %v", want, err)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	db := &test.MockDB{}
+	db.AddCheck(checks.StatusCheck{ID: "keep", URL: "https://keep.example.com", Interval: 60, HTTPTimeout: 10,
+		Regions: []string{"us-east-1", "eu-west-1"}, Active: true, Serial: 3})
+	db.AddCheck(checks.StatusCheck{ID: "change", URL: "https://change.example.com", Interval: 60, HTTPTimeout: 10,
+		Regions: []string{"us-east-1"}, Active: true, Serial: 7})
+	db.AddCheck(checks.StatusCheck{ID: "remove", URL: "https://remove.example.com", Interval: 60, HTTPTimeout: 10,
+		Regions: []string{"us-east-1"}, Active: true})
+
+	file, err := Parse([]byte(`
+checks:
+  - id: keep
+    url: https://keep.example.com
+    regions: [eu-west-1, us-east-1]
+  - id: change
+    url: https://change.example.com/health
+    interval: 30s
+    regions: [us-east-1]
+  - id: add
+    url: https://add.example.com
+    regions: [us-east-1]
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, _ := db.ListStatusChecks(ctx)
+
+	var out strings.Builder
+	Diff(file.StatusChecks(), existing, false).Write(&out)
+	if !strings.Contains(out.String(), "1 to create, 1 to update, 0 to delete, 1 unchanged") {
+		t.Fatalf("plan without prune:\n%s", out.String())
+	}
+
+	plan := Diff(file.StatusChecks(), existing, true)
+	out.Reset()
+	plan.Write(&out)
+	want := "+ create add (https://add.example.com)\n" +
+		"~ update change (url, interval)\n" +
+		"- delete remove (https://remove.example.com)\n" +
+		"1 to create, 1 to update, 1 to delete, 1 unchanged\n"
+	if out.String() != want {
+		t.Fatalf("plan.\nWant:\n%s\nGot:\n%s", want, out.String())
+	}
+
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := plan.Apply(ctx, db, now); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := db.GetStatusCheck(ctx, "change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Interval != 30 || changed.Serial != 8 || !changed.Modified.Equal(now) {
+		t.Fatalf("updated check. Want: interval 30, serial 8 Got: %+v", changed)
+	}
+	if _, err := db.GetStatusCheck(ctx, "remove"); err == nil {
+		t.Fatal("remove should be deleted")
+	}
+
+	// syncing again changes nothing
+	existing, _ = db.ListStatusChecks(ctx)
+	if plan := Diff(file.StatusChecks(), existing, true); len(plan.Changes) != 0 || plan.Unchanged != 3 {
+		t.Fatalf("second sync. Want: no changes Got: %+v", plan)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	file, err := Load("../../checks.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, isJSON := range []bool{false, true} {
+		var buf strings.Builder
+		if err := FromStatusChecks(file.StatusChecks()).Write(&buf, isJSON); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse([]byte(buf.String()), isJSON)
+		if err != nil {
+			t.Fatalf("json %v: %v\n%s", isJSON, err, buf.String())
+		}
+		if !reflect.DeepEqual(got.StatusChecks(), file.StatusChecks()) {
+			t.Fatalf("json %v.\nWant: %+v\nGot:  %+v", isJSON, file.StatusChecks(), got.StatusChecks())
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package checkconfig
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// csvColumns maps header names to the check field they set. id, url and
+// regions are required.
+var csvColumns = map[string]func(c *Check, value string) error{
+	"id":  func(c *Check, v string) error { c.ID = v; return nil },
+	"url": func(c *Check, v string) error { c.URL = v; return nil },
+	"interval": func(c *Check, v string) error {
+		return c.Interval.parse(v)
+	},
+	"timeout": func(c *Check, v string) error {
+		return c.Timeout.parse(v)
+	},
+	"regions": func(c *Check, v string) error { c.Regions = splitList(v); return nil },
+	"name":    func(c *Check, v string) error { c.Name = v; return nil },
+	"group":   func(c *Check, v string) error { c.Group = v; return nil },
+	"active": func(c *Check, v string) error {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid active value %q, use true or false", v)
+		}
+		c.Active = &active
+		return nil
+	},
+	"tags": func(c *Check, v string) error { c.Tags = splitList(v); return nil },
+}
+
+// csvAliases are other accepted header names
+var csvAliases = map[string]string{
+	"check_id":         "id",
+	"interval_seconds": "interval",
+	"timeout_seconds":  "timeout",
+	"region":           "regions",
+	"region_codes":     "regions",
+}
+
+// CSVRow is a check read from one line of a CSV file
+type CSVRow struct {
+	Line  int
+	Check Check
+}
+
+// LoadCSV reads a CSV check file, see ParseCSV
+func LoadCSV(path string) ([]CSVRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCSV(f)
+}
+
+// ParseCSV reads checks from CSV. The first row is a header naming the
+// column of each field, e.g.
+//
+//	id,url,interval,regions
+//	api-health,https://api.example.com/health,30,us-east-1;eu-west-1
+//
+// Regions and tags are separated by ';', '|' or spaces. Intervals and
+// timeouts are seconds or a duration such as 5m. Empty cells are left
+// unset. Every row is validated and problems are reported with their line
+// number.
+func ParseCSV(r io.Reader) ([]CSVRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty csv file, the first row must be a header such as: id,url,interval,regions")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line, _ := reader.FieldPos(0)
+	setters, err := csvHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	var rows []CSVRow
+	var errs []error
+	seen := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+			errs = append(errs, fmt.Errorf("line %d: want %d columns, got %d", parseErr.Line, len(header), len(record)))
+			continue
+		}
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := CSVRow{Line: line}
+		var problems []error
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if err := setters[i](&row.Check, value); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", header[i], err))
+			}
+		}
+		problems = append(problems, row.Check.problems()...)
+		if first, ok := seen[row.Check.ID]; ok && row.Check.ID != "" {
+			problems = append(problems, fmt.Errorf("duplicate id %q, first used on line %d", row.Check.ID, first))
+		} else {
+			seen[row.Check.ID] = line
+		}
+		for _, err := range problems {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+		}
+		rows = append(rows, row)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rows, nil
+}
+
+// csvHeader returns the setter for each column
+func csvHeader(header []string) ([]func(c *Check, value string) error, error) {
+	setters := make([]func(c *Check, value string) error, len(header))
+	used := make(map[string]bool)
+	for i, name := range header {
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+		if alias, ok := csvAliases[name]; ok {
+			name = alias
+		}
+		setter, ok := csvColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, the first row must be a header using: %s", header[i], csvColumnNames)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("column %q is used more than once", name)
+		}
+		used[name] = true
+		setters[i] = setter
+	}
+	for _, required := range []string{"id", "url", "regions"} {
+		if !used[required] {
+			return nil, fmt.Errorf("missing required column %q", required)
+		}
+	}
+	return setters, nil
+}
+
+const csvColumnNames = "id, url, interval, timeout, regions, name, group, active, tags"
+
+// splitList splits a cell holding several values
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == '|' || unicode.IsSpace(r)
+	})
+}
+
+// WriteCSV writes checks in the format read by ParseCSV. Headers and
+// assertions have no CSV column and are left out, use YAML or JSON to
+// keep them.
+func WriteCSV(w io.Writer, statusChecks []checks.StatusCheck) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "url", "interval", "timeout", "regions", "name", "group", "active", "tags"})
+	for _, s := range statusChecks {
+		writer.Write([]string{
+			s.ID,
+			s.URL,
+			strconv.Itoa(s.Interval),
+			strconv.Itoa(s.HTTPTimeout),
+			strings.Join(s.Regions, ";"),
+			s.Name,
+			s.Group,
+			strconv.FormatBool(s.Active),
+			strings.Join(s.Tags, ";"),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// MergeCSV returns the checks an import should write. Rows for existing
+// checks only change the fields the row sets, new checks get defaults.
+func MergeCSV(rows []CSVRow, existing []checks.StatusCheck) []checks.StatusCheck {
+	current := make(map[string]checks.StatusCheck, len(existing))
+	for _, c := range existing {
+		current[c.ID] = c
+	}
+
+	merged := make([]checks.StatusCheck, len(rows))
+	for i, row := range rows {
+		c, ok := current[row.Check.ID]
+		if !ok {
+			merged[i] = row.Check.StatusCheck()
+			continue
+		}
+		c.URL = row.Check.URL
+		c.Regions = row.Check.Regions
+		if row.Check.Interval != 0 {
+			c.Interval = row.Check.StatusCheck().Interval
+		}
+		if row.Check.Timeout != 0 {
+			c.HTTPTimeout = row.Check.StatusCheck().HTTPTimeout
+		}
+		if row.Check.Active != nil {
+			c.Active = *row.Check.Active
+		}
+		if row.Check.Name != "" {
+			c.Name = row.Check.Name
+		}
+		if row.Check.Group != "" {
+			c.Group = row.Check.Group
+		}
+		if row.Check.Tags != nil {
+			c.Tags = row.Check.Tags
+		}
+		merged[i] = c
+	}
+	return merged
+}
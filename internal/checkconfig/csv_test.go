@@ -0,0 +1,137 @@
+package checkconfig
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/test"
+)
+
+func TestLoadCSVExample(t *testing.T) {
+	rows, err := LoadCSV("../../checks.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("rows. Want: 3 Got: %d", len(rows))
+	}
+	got := rows[0].Check.StatusCheck()
+	want := checks.StatusCheck{ID: "check2", URL: "https://blue42.net/", Interval: 300,
+		HTTPTimeout: int(DefaultTimeout.Seconds()), Regions: []string{"SOFLO", "OHIO"}, Active: true}
+	if rows[0].Line != 2 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("first row.\nWant: line 2 %+v\nGot:  line %d %+v", want, rows[0].Line, got)
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []string
+	}{
+		{"no header", "check2,https://blue42.net/,300,SOFLO\n", []string{`line 1: unknown column "check2"`}},
+		{"missing column", "id,url\n", []string{`line 1: missing required column "regions"`}},
+		{"invalid rows", `id,url,interval,regions,active
+# comment lines are skipped
+a,ftp://a.example.com,1.5s,us-east-1,yes
+,https://b.example.com,30,,true
+a,https://a.example.com,30
+c,https://c.example.com,never,us-east-1,false
+a,https://a.example.com,30,us-east-1,true
+`, []string{
+			"line 3: url must be an http or https url",
+			"line 3: interval must be a positive whole number of seconds",
+			`line 3: active: invalid active value "yes"`,
+			"line 4: id is required",
+			"line 4: at least one region is required",
+			"line 5: want 5 columns, got 3",
+			`line 6: interval: invalid duration "never"`,
+			`line 7: duplicate id "a", first used on line 3`,
+		}},
+	}
+	for _, tt := range tests {
+		_, err := ParseCSV(strings.NewReader(tt.csv))
+		if err == nil {
+			t.Fatalf("%s: want error", tt.name)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("%s: error missing %q:\n%v", tt.name, want, err)
+			}
+		}
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	db := &test.MockDB{}
+	db.AddCheck(checks.StatusCheck{ID: "keep", URL: "https://keep.example.com", Interval: 60, HTTPTimeout: 5,
+		Regions: []string{"us-east-1"}, Active: true, Name: "Keep", Tags: []string{"web"}, Serial: 3})
+	db.AddCheck(checks.StatusCheck{ID: "other", URL: "https://other.example.com", Interval: 60, HTTPTimeout: 10,
+		Regions: []string{"us-east-1"}, Active: true})
+
+	rows, err := ParseCSV(strings.NewReader("ID,URL,Interval,Region Codes\n" +
+		"keep,https://keep.example.com/health,,us-east-1|eu-west-1\n" +
+		"add,https://add.example.com,5m,us-east-1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, _ := db.ListStatusChecks(ctx)
+	plan := Diff(MergeCSV(rows, existing), existing, false)
+	var out strings.Builder
+	plan.Write(&out)
+	want := "+ create add (https://add.example.com)\n" +
+		"~ update keep (url, regions)\n" +
+		"1 to create, 1 to update, 0 to delete, 0 unchanged\n"
+	if out.String() != want {
+		t.Fatalf("plan.\nWant:\n%s\nGot:\n%s", want, out.String())
+	}
+	if err := plan.Apply(ctx, db, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	keep, err := db.GetStatusCheck(ctx, "keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fields without a column are kept
+	if keep.Name != "Keep" || keep.HTTPTimeout != 5 || keep.Interval != 60 || keep.Serial != 4 ||
+		!reflect.DeepEqual(keep.Tags, []string{"web"}) {
+		t.Fatalf("keep. Got: %+v", keep)
+	}
+	if _, err := db.GetStatusCheck(ctx, "other"); err != nil {
+		t.Fatalf("other was deleted without replace: %v", err)
+	}
+
+	existing, _ = db.ListStatusChecks(ctx)
+	out.Reset()
+	Diff(MergeCSV(rows, existing), existing, true).Write(&out)
+	if out.String() != "- delete other (https://other.example.com)\n0 to create, 0 to update, 1 to delete, 2 unchanged\n" {
+		t.Fatalf("replace plan:\n%s", out.String())
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	want := []checks.StatusCheck{
+		{ID: "api", URL: "https://api.example.com", Interval: 30, HTTPTimeout: 5, Regions: []string{"us-east-1", "eu-west-1"},
+			Active: true, Name: "API", Group: "Backend", Tags: []string{"team-api"}},
+		{ID: "paused", URL: "https://paused.example.com", Interval: 300, HTTPTimeout: 10, Regions: []string{"us-east-1"}},
+	}
+	var buf strings.Builder
+	if err := WriteCSV(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ParseCSV(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		if got := row.Check.StatusCheck(); !reflect.DeepEqual(got, want[i]) {
+			t.Fatalf("row %d.\nWant: %+v\nGot:  %+v", i, want[i], got)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package checkconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// Action is what a Change does to a check
+type Action string
+
+// Change actions
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// Change is one difference between the desired and existing checks
+type Change struct {
+	Action Action
+	ID     string
+	// Check is the desired check, the existing one for deletes
+	Check checks.StatusCheck
+	// Fields lists the fields an update changes
+	Fields []string
+}
+
+// Plan is the set of changes that makes the database match a check file
+type Plan struct {
+	Changes   []Change
+	Unchanged int
+}
+
+// Diff compares desired checks with the existing ones in the database.
+// Existing checks missing from desired are deleted when prune is set.
+func Diff(desired []checks.StatusCheck, existing []checks.StatusCheck, prune bool) Plan {
+	current := make(map[string]checks.StatusCheck, len(existing))
+	for _, c := range existing {
+		current[c.ID] = c
+	}
+
+	var plan Plan
+	wanted := make(map[string]bool, len(desired))
+	for _, c := range desired {
+		wanted[c.ID] = true
+		old, ok := current[c.ID]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: Create, ID: c.ID, Check: c})
+			continue
+		}
+		fields := changedFields(old, c)
+		if len(fields) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		// the file does not name tenants, a check keeps its owner
+		c.Serial, c.Tenant = old.Serial, old.Tenant
+		plan.Changes = append(plan.Changes, Change{Action: Update, ID: c.ID, Check: c, Fields: fields})
+	}
+	if prune {
+		for _, c := range existing {
+			if !wanted[c.ID] {
+				plan.Changes = append(plan.Changes, Change{Action: Delete, ID: c.ID, Check: c})
+			}
+		}
+	}
+	sort.SliceStable(plan.Changes, func(i, j int) bool { return plan.Changes[i].ID < plan.Changes[j].ID })
+	return plan
+}
+
+// Apply makes the changes. Created and updated checks get Modified set to
+// now and their Serial incremented so workers pick up the change. A check
+// that would exceed its tenant's quota stops Apply with a
+// *checks.QuotaError.
+func (p Plan) Apply(ctx context.Context, db data.Database, now time.Time) error {
+	for _, change := range p.Changes {
+		c := change.Check
+		c.Modified = now.UTC()
+		c.Serial++
+		var err error
+		switch change.Action {
+		case Create:
+			if err = data.CheckQuota(ctx, db, c); err == nil {
+				err = db.CreateStatusCheck(ctx, c)
+			}
+		case Update:
+			if err = data.CheckQuota(ctx, db, c); err == nil {
+				err = db.UpdateStatusCheck(ctx, c)
+			}
+		case Delete:
+			err = db.DeleteStatusCheck(ctx, change.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s failed: %w", change.Action, change.ID, err)
+		}
+	}
+	return nil
+}
+
+// Write prints the plan, one line per change and a summary
+func (p Plan) Write(w io.Writer) {
+	counts := make(map[Action]int)
+	for _, change := range p.Changes {
+		counts[change.Action]++
+		switch change.Action {
+		case Create:
+			fmt.Fprintf(w, "+ create %s (%s)\n", change.ID, change.Check.URL)
+		case Update:
+			fmt.Fprintf(w, "~ update %s (%s)\n", change.ID, strings.Join(change.Fields, ", "))
+		case Delete:
+			fmt.Fprintf(w, "- delete %s (%s)\n", change.ID, change.Check.URL)
+		}
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete, %d unchanged\n",
+		counts[Create], counts[Update], counts[Delete], p.Unchanged)
+}
+
+// changedFields lists the fields that differ between two checks, ignoring
+// Modified and Serial. Region and tag order does not matter.
+func changedFields(old checks.StatusCheck, c checks.StatusCheck) []string {
+	var fields []string
+	compare := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			fields = append(fields, name)
+		}
+	}
+	compare("url", old.URL, c.URL)
+	compare("interval", old.Interval, c.Interval)
+	compare("timeout", old.HTTPTimeout, c.HTTPTimeout)
+	compare("regions", sorted(old.Regions), sorted(c.Regions))
+	compare("active", old.Active, c.Active)
+	compare("name", old.Name, c.Name)
+	compare("group", old.Group, c.Group)
+	if len(old.Headers) != 0 || len(c.Headers) != 0 {
+		compare("headers", old.Headers, c.Headers)
+	}
+	if len(old.Assertions) != 0 || len(c.Assertions) != 0 {
+		compare("assertions", old.Assertions, c.Assertions)
+	}
+	compare("tags", sorted(old.Tags), sorted(c.Tags))
+	return fields
+}
+
+// sorted returns a sorted copy of s, nil when s is empty
+func sorted(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
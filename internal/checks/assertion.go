@@ -0,0 +1,165 @@
+package checks
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AssertionType is what an Assertion inspects
+type AssertionType string
+
+// Assertion types
+const (
+	// AssertStatusCode compares the response status code
+	AssertStatusCode AssertionType = "status_code"
+	// AssertResponseTime compares the time to first byte in milliseconds
+	AssertResponseTime AssertionType = "response_time"
+	// AssertBodyContains checks the response body contains Value
+	AssertBodyContains AssertionType = "body_contains"
+	// AssertHeader compares the response header named Target
+	AssertHeader AssertionType = "header"
+)
+
+// Assertion operators. eq, ne and contains apply to every type, the
+// numeric comparisons to status_code and response_time.
+const (
+	OpEqual       = "eq"
+	OpNotEqual    = "ne"
+	OpLess        = "lt"
+	OpLessOrEqual = "lte"
+	OpGreater     = "gt"
+	OpGreaterOrEq = "gte"
+	OpContains    = "contains"
+)
+
+// Assertion is a condition a response must meet for a StatusCheck to be
+// up. Assertions apply on top of the 2xx or 3xx status code rule.
+type Assertion struct {
+	Type     AssertionType `json:"type" yaml:"type"`
+	Operator string        `json:"operator,omitempty" yaml:"operator,omitempty"`
+	// Target is the header name for header assertions
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	Value  string `json:"value" yaml:"value"`
+}
+
+// operator returns Operator or the default for the assertion type
+func (a Assertion) operator() string {
+	if a.Operator != "" {
+		return a.Operator
+	}
+	switch a.Type {
+	case AssertResponseTime:
+		return OpLess
+	case AssertBodyContains:
+		return OpContains
+	default:
+		return OpEqual
+	}
+}
+
+// Validate returns an error if the assertion can never be evaluated
+func (a Assertion) Validate() error {
+	op := a.operator()
+	numeric := op == OpLess || op == OpLessOrEqual || op == OpGreater || op == OpGreaterOrEq
+	switch a.Type {
+	case AssertStatusCode, AssertResponseTime:
+		if op != OpEqual && op != OpNotEqual && !numeric {
+			return fmt.Errorf("%s assertion does not support operator %q", a.Type, op)
+		}
+		if _, err := strconv.ParseInt(a.Value, 10, 64); err != nil {
+			return fmt.Errorf("%s assertion value must be an integer, got %q", a.Type, a.Value)
+		}
+	case AssertBodyContains:
+		if op != OpContains {
+			return fmt.Errorf("%s assertion does not support operator %q", a.Type, op)
+		}
+	case AssertHeader:
+		if a.Target == "" {
+			return fmt.Errorf("%s assertion needs a target header", a.Type)
+		}
+		if op != OpEqual && op != OpNotEqual && op != OpContains {
+			return fmt.Errorf("%s assertion does not support operator %q", a.Type, op)
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+	return nil
+}
+
+// String describes the assertion, e.g. status_code eq 200
+func (a Assertion) String() string {
+	switch a.Type {
+	case AssertBodyContains:
+		return fmt.Sprintf("body contains %q", a.Value)
+	case AssertHeader:
+		return fmt.Sprintf("header %s %s %q", a.Target, a.operator(), a.Value)
+	}
+	return fmt.Sprintf("%s %s %s", a.Type, a.operator(), a.Value)
+}
+
+// NeedsBody reports whether the assertion reads the response body
+func (a Assertion) NeedsBody() bool {
+	return a.Type == AssertBodyContains
+}
+
+// Check evaluates the assertion against a response, its time to first
+// byte and body. It returns a description of the failure or "" when the
+// assertion passed.
+func (a Assertion) Check(resp *http.Response, ttfb time.Duration, body []byte) string {
+	var actual string
+	switch a.Type {
+	case AssertStatusCode:
+		actual = strconv.Itoa(resp.StatusCode)
+	case AssertResponseTime:
+		actual = strconv.FormatInt(ttfb.Milliseconds(), 10)
+	case AssertBodyContains:
+		actual = string(body)
+	case AssertHeader:
+		actual = resp.Header.Get(a.Target)
+	}
+	if a.compare(actual) {
+		return ""
+	}
+	if a.Type == AssertBodyContains {
+		return fmt.Sprintf("body does not contain %q", a.Value)
+	}
+	name := string(a.Type)
+	if a.Type == AssertHeader {
+		name = "header " + a.Target
+	}
+	return fmt.Sprintf("%s %q is not %s %q", name, actual, a.operator(), a.Value)
+}
+
+func (a Assertion) compare(actual string) bool {
+	switch op := a.operator(); op {
+	case OpEqual:
+		return actual == a.Value
+	case OpNotEqual:
+		return actual != a.Value
+	case OpContains:
+		return strings.Contains(actual, a.Value)
+	default:
+		got, err := strconv.ParseInt(actual, 10, 64)
+		if err != nil {
+			return false
+		}
+		want, err := strconv.ParseInt(a.Value, 10, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case OpLess:
+			return got < want
+		case OpLessOrEqual:
+			return got <= want
+		case OpGreater:
+			return got > want
+		case OpGreaterOrEq:
+			return got >= want
+		}
+		return false
+	}
+}
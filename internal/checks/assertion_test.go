@@ -0,0 +1,27 @@
+package checks
+
+import "testing"
+
+func TestAssertionValidate(t *testing.T) {
+	tests := []struct {
+		assertion Assertion
+		valid     bool
+	}{
+		{Assertion{Type: AssertStatusCode, Value: "200"}, true},
+		{Assertion{Type: AssertStatusCode, Operator: OpLess, Value: "400"}, true},
+		{Assertion{Type: AssertStatusCode, Value: "ok"}, false},
+		{Assertion{Type: AssertStatusCode, Operator: OpContains, Value: "2"}, false},
+		{Assertion{Type: AssertResponseTime, Value: "500"}, true},
+		{Assertion{Type: AssertBodyContains, Value: "ok"}, true},
+		{Assertion{Type: AssertBodyContains, Operator: OpEqual, Value: "ok"}, false},
+		{Assertion{Type: AssertHeader, Target: "Content-Type", Value: "text/html"}, true},
+		{Assertion{Type: AssertHeader, Value: "text/html"}, false},
+		{Assertion{Type: "cert_expiry", Value: "30"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.assertion.Validate()
+		if (err == nil) != tt.valid {
+			t.Fatalf("%+v. Want valid: %v Got: %v", tt.assertion, tt.valid, err)
+		}
+	}
+}
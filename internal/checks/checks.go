@@ -1,7 +1,10 @@
 // Package checks defines our checks structs
 package checks
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Checks is a list of checks
 type Checks struct {
@@ -20,25 +23,49 @@ type StatusCheck struct {
 	Modified    time.Time
 	Serial      uint64
 	Active      bool
+	Name        string // shown on the status page instead of ID
+	Group       string // status page group
+	Headers     map[string]string
+	Assertions  []Assertion
+	Tags        []string
+	Tenant      string // owner, "" is the default tenant
 }
 
 // StatusCheckMetadata models our timeseries metadata
 type StatusCheckMetadata struct {
-	Region  string `bson:"region"`
-	CheckID string `bson:"check_id"`
+	Region  string `json:"region" bson:"region"`
+	CheckID string `json:"check_id" bson:"check_id"`
+	// Tenant owns the check, "" is the default tenant
+	Tenant string `json:"tenant,omitempty" bson:"tenant,omitempty"`
 }
 
 // StatusCheckResult is the result of a StatusCheck
 type StatusCheckResult struct {
 	Metadata      StatusCheckMetadata `json:"metadata" bson:"metadata"`
 	Timestamp     time.Time           `json:"timestamp" bson:"timestamp"`
-	ResponseID    string              `json:"-" bson:"-"`
+	ResponseID    string              `json:"response_id" bson:"_id"`
 	ResponseCode  int                 `json:"response_code" bson:"response_code,omitempty"`
 	TTFB          int64               `json:"firstbyte_ms" bson:"firstbyte_ms,omitempty"`
 	ConnectTiming int64               `json:"connect_ms" bson:"connect_ms,omitempty"`
 	TLSTiming     int64               `json:"tls_ms" bson:"tls_ms,omitempty"`
 	DNSTiming     int64               `json:"dns_ms" bson:"dns_ms,omitempty"`
 	ResponseInfo  string              `json:"response_info" bson:"response_info"`
+	// AssertionFailed is set when the response did not meet one of the
+	// check's Assertions
+	AssertionFailed bool `json:"assertion_failed" bson:"assertion_failed,omitempty"`
+}
+
+// Up reports whether the check succeeded, i.e. the server responded
+// with a 2xx or 3xx status code and every assertion passed
+func (r StatusCheckResult) Up() bool {
+	return r.ResponseCode >= 200 && r.ResponseCode < 400 && !r.AssertionFailed
+}
+
+// NewResponseID returns a stable ID for a StatusCheckResult. The same
+// region, check and start time always produce the same ID, so a result
+// that is sent more than once can be de-duplicated by the database.
+func NewResponseID(region string, checkID string, timestamp time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", region, checkID, timestamp.UnixNano())
 }
 
 // SSLCheck defines an SSL check
@@ -51,8 +78,8 @@ type SSLCheck struct {
 
 // SSLCheckResult is the result of an SSLCheck
 type SSLCheckResult struct {
-	ID            string // uuid
-	ResponseID    string // uuid
-	SSLExpiration time.Time
-	Valid         bool
+	ID            string    `json:"check_id" bson:"check_id"` // uuid
+	ResponseID    string    `json:"response_id" bson:"_id"`   // uuid
+	SSLExpiration time.Time `json:"ssl_expiration" bson:"ssl_expiration"`
+	Valid         bool      `json:"valid" bson:"valid"`
 }
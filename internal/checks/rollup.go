@@ -0,0 +1,60 @@
+package checks
+
+import (
+	"fmt"
+	"time"
+)
+
+// RollupPeriod is the bucket size of a StatusCheckRollup
+type RollupPeriod string
+
+// Rollup periods
+const (
+	RollupHourly RollupPeriod = "hourly"
+	RollupDaily  RollupPeriod = "daily"
+)
+
+// RollupPeriods lists every RollupPeriod
+var RollupPeriods = []RollupPeriod{RollupHourly, RollupDaily}
+
+// Duration of a bucket
+func (p RollupPeriod) Duration() time.Duration {
+	if p == RollupDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// Validate returns an error for unknown periods
+func (p RollupPeriod) Validate() error {
+	if p != RollupHourly && p != RollupDaily {
+		return fmt.Errorf("unknown rollup period %q", p)
+	}
+	return nil
+}
+
+// StatusCheckRollup aggregates the StatusCheckResults of one check and
+// region over a bucket starting at Timestamp. Latency percentiles only
+// include results that received a response.
+type StatusCheckRollup struct {
+	Metadata      StatusCheckMetadata `json:"metadata" bson:"metadata"`
+	Timestamp     time.Time           `json:"timestamp" bson:"timestamp"`
+	Count         int64               `json:"count" bson:"count"`
+	Failures      int64               `json:"failures" bson:"failures"`
+	UptimePercent float64             `json:"uptime_percent" bson:"uptime_percent"`
+	TTFBP50       int64               `json:"firstbyte_p50_ms" bson:"firstbyte_p50_ms"`
+	TTFBP95       int64               `json:"firstbyte_p95_ms" bson:"firstbyte_p95_ms"`
+	TTFBP99       int64               `json:"firstbyte_p99_ms" bson:"firstbyte_p99_ms"`
+	ConnectP50    int64               `json:"connect_p50_ms" bson:"connect_p50_ms"`
+	ConnectP95    int64               `json:"connect_p95_ms" bson:"connect_p95_ms"`
+	ConnectP99    int64               `json:"connect_p99_ms" bson:"connect_p99_ms"`
+}
+
+// RollupID returns the stable ID of a rollup bucket. Check ids are unique
+// per tenant, the ID of a bucket of the default tenant has no tenant part.
+func RollupID(tenant string, region string, checkID string, timestamp time.Time) string {
+	if tenant == "" {
+		return fmt.Sprintf("%s:%s:%d", region, checkID, timestamp.Unix())
+	}
+	return fmt.Sprintf("%s:%s:%s:%d", tenant, region, checkID, timestamp.Unix())
+}
@@ -0,0 +1,236 @@
+package checks
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// secretRef matches a ${secret:name} reference in a check's url or header
+// values
+var secretRef = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// secretName is what a secret can be called
+var secretName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Secret is a value checks reference as ${secret:name} instead of storing
+// it. Value is sealed with a key only the workers and the operator have.
+type Secret struct {
+	Name string `json:"name" bson:"name"`
+	// Tenant owns the secret, only its checks can use it
+	Tenant   string    `json:"tenant,omitempty" bson:"tenant"`
+	Value    string    `json:"-" bson:"value"` // base64 nonce and ciphertext
+	Modified time.Time `json:"modified" bson:"modified"`
+}
+
+// ValidSecretName returns an error if name can not be referenced
+func ValidSecretName(name string) error {
+	if !secretName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// SecretRefs returns the names of the secrets s references
+func SecretRefs(s string) ([]string, error) {
+	var names []string
+	for _, m := range secretRef.FindAllStringSubmatch(s, -1) {
+		if err := ValidSecretName(m[1]); err != nil {
+			return nil, err
+		}
+		names = append(names, m[1])
+	}
+	return names, nil
+}
+
+// ExpandSecrets replaces the secret references in s with the values
+// lookup returns
+func ExpandSecrets(s string, lookup func(name string) (string, error)) (string, error) {
+	var err error
+	expanded := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		var value string
+		value, err = lookup(secretRef.FindStringSubmatch(ref)[1])
+		return value
+	})
+	return expanded, err
+}
+
+// MaskSecrets replaces the secret references in s with value
+func MaskSecrets(s string, value string) string {
+	return secretRef.ReplaceAllLiteralString(s, value)
+}
+
+// HasSecrets reports whether c references any secrets
+func (c StatusCheck) HasSecrets() bool {
+	if secretRef.MatchString(c.URL) {
+		return true
+	}
+	for _, value := range c.Headers {
+		if secretRef.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of checks with every check Redacted
+func (c Checks) Redacted() Checks {
+	statusChecks := c.StatusChecks
+	c.StatusChecks = nil
+	for _, check := range statusChecks {
+		c.StatusChecks = append(c.StatusChecks, check.Redacted())
+	}
+	return c
+}
+
+// sensitive are parts of header and query parameter names whose values
+// are hidden by Redacted
+var sensitive = []string{"auth", "cookie", "key", "password", "secret", "session", "token"}
+
+// RedactedValue replaces the credentials Redacted hides
+const RedactedValue = "xxxxx"
+
+// Redacted returns a copy of c with credentials that are not secret
+// references hidden, for logs and api responses. It hides the url
+// password and the values of headers and query parameters that look like
+// credentials.
+func (c StatusCheck) Redacted() StatusCheck {
+	c.URL = redactURL(c.URL)
+	if len(c.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers))
+		for name, value := range c.Headers {
+			if isSensitive(name) && value != "" && !secretRef.MatchString(value) {
+				value = RedactedValue
+			}
+			headers[name] = value
+		}
+		c.Headers = headers
+	}
+	return c
+}
+
+// IsRedacted reports whether c has a credential replaced by Redacted, a
+// redacted check can not be run or stored
+func (c StatusCheck) IsRedacted() bool {
+	_, err := c.Unredacted(StatusCheck{})
+	return err != nil
+}
+
+// Unredacted returns a copy of c, a check edited from its Redacted copy,
+// with every credential Redacted hid taken from stored. It returns an
+// error when stored does not have a hidden credential.
+func (c StatusCheck) Unredacted(stored StatusCheck) (StatusCheck, error) {
+	if len(c.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers))
+		for name, value := range c.Headers {
+			if isSensitive(name) && value == RedactedValue {
+				if value = stored.Headers[name]; value == "" || value == RedactedValue {
+					return c, fmt.Errorf("header %s is redacted, set its value", name)
+				}
+			}
+			headers[name] = value
+		}
+		c.Headers = headers
+	}
+	u, unmask, err := parseMasked(c.URL)
+	if err != nil {
+		return c, nil
+	}
+	storedURL, _, err := parseMasked(stored.URL)
+	if err != nil {
+		storedURL = &url.URL{}
+	}
+	restored := false
+	if password, ok := u.User.Password(); ok && password == RedactedValue {
+		storedPassword, ok := storedURL.User.Password()
+		if !ok || storedPassword == RedactedValue || strings.Contains(storedPassword, refMarker) {
+			return c, fmt.Errorf("url password is redacted, set its value")
+		}
+		u.User = url.UserPassword(u.User.Username(), storedPassword)
+		restored = true
+	}
+	query, storedQuery := u.Query(), storedURL.Query()
+	for name, values := range query {
+		for i, v := range values {
+			if !isSensitive(name) || v != RedactedValue {
+				continue
+			}
+			if i >= len(storedQuery[name]) || storedQuery[name][i] == RedactedValue || strings.Contains(storedQuery[name][i], refMarker) {
+				return c, fmt.Errorf("url query parameter %s is redacted, set its value", name)
+			}
+			values[i] = storedQuery[name][i]
+			restored = true
+		}
+	}
+	if restored {
+		u.RawQuery = query.Encode()
+		c.URL = unmask(u.String())
+	}
+	return c, nil
+}
+
+// refMarker stands in for the secret references of a url while it is
+// parsed, url.Parse rejects braces in some parts of a url
+const refMarker = "STATUSSECRETREF"
+
+// parseMasked parses rawURL with its secret references replaced by
+// markers, unmask puts the references back into a url string
+func parseMasked(rawURL string) (*url.URL, func(string) string, error) {
+	refs := secretRef.FindAllString(rawURL, -1)
+	i := 0
+	masked := secretRef.ReplaceAllStringFunc(rawURL, func(string) string {
+		i++
+		return fmt.Sprintf("%s%dX", refMarker, i-1)
+	})
+	u, err := url.Parse(masked)
+	unmask := func(s string) string {
+		for i := len(refs) - 1; i >= 0; i-- {
+			s = strings.ReplaceAll(s, fmt.Sprintf("%s%dX", refMarker, i), refs[i])
+		}
+		return s
+	}
+	return u, unmask, err
+}
+
+// redactURL hides the password and credential query parameters of
+// rawURL, it is returned unchanged when there is nothing to hide
+func redactURL(rawURL string) string {
+	u, unmask, err := parseMasked(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	redacted := false
+	if password, ok := u.User.Password(); ok && !strings.Contains(password, refMarker) {
+		u.User = url.UserPassword(u.User.Username(), RedactedValue)
+		redacted = true
+	}
+	query := u.Query()
+	for name, values := range query {
+		for i, v := range values {
+			if isSensitive(name) && !strings.Contains(v, refMarker) {
+				values[i] = RedactedValue
+				redacted = true
+			}
+		}
+	}
+	if !redacted {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return unmask(u.String())
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitive {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
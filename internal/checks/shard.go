@@ -0,0 +1,49 @@
+package checks
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// ShardMembers returns the ids of the workers that share region's checks at
+// now, sorted. A worker is a member once it has been running for handoff,
+// which gives the other workers time to see it before it takes over part
+// of their checks, and until it stops or misses its heartbeats for
+// timeout.
+func ShardMembers(workers []Worker, region string, now time.Time, timeout time.Duration, handoff time.Duration) []string {
+	var members []string
+	for _, w := range workers {
+		if w.Region == region && w.Live(now, timeout) && !now.Before(w.Started.Add(handoff)) {
+			members = append(members, w.ID)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// ShardOwner returns the member that runs checkID, or "" when there are no
+// members. It uses rendezvous hashing so when a member joins or leaves
+// only the checks it gains or loses move.
+func ShardOwner(checkID string, members []string) string {
+	owner, best := "", uint64(0)
+	for _, m := range members {
+		if score := shardScore(m, checkID); owner == "" || score > best || (score == best && m < owner) {
+			owner, best = m, score
+		}
+	}
+	return owner
+}
+
+// shardScore hashes member and checkID, finished with the splitmix64 mixer
+// so similar ids spread evenly
+func shardScore(member string, checkID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	h.Write([]byte{0})
+	h.Write([]byte(checkID))
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,69 @@
+package checks
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShardMembers(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	workers := []Worker{
+		{ID: "b", Region: "us-test-1", Started: now.Add(-time.Hour), LastSeen: now},
+		{ID: "a", Region: "us-test-1", Started: now.Add(-time.Hour), LastSeen: now.Add(-time.Minute)},
+		{ID: "joining", Region: "us-test-1", Started: now.Add(-5 * time.Second), LastSeen: now},
+		{ID: "stopped", Region: "us-test-1", Started: now.Add(-time.Hour), LastSeen: now, Stopped: true},
+		{ID: "missing", Region: "us-test-1", Started: now.Add(-time.Hour), LastSeen: now.Add(-10 * time.Minute)},
+		{ID: "other", Region: "eu-test-1", Started: now.Add(-time.Hour), LastSeen: now},
+	}
+	got := ShardMembers(workers, "us-test-1", now, 3*time.Minute, 15*time.Second)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members. Want: %v Got: %v", want, got)
+	}
+	got = ShardMembers(workers, "us-test-1", now.Add(10*time.Second), 3*time.Minute, 15*time.Second)
+	if want := []string{"a", "b", "joining"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members after handoff. Want: %v Got: %v", want, got)
+	}
+}
+
+func TestShardOwner(t *testing.T) {
+	if owner := ShardOwner("api", nil); owner != "" {
+		t.Fatalf("no members. Want: \"\" Got: %q", owner)
+	}
+	members := []string{"worker-1", "worker-2", "worker-3"}
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		id := fmt.Sprintf("check-%d", i)
+		owners[id] = ShardOwner(id, members)
+		counts[owners[id]]++
+	}
+	for _, m := range members {
+		if counts[m] < 800 || counts[m] > 1200 {
+			t.Fatalf("uneven shards: %v", counts)
+		}
+	}
+
+	// a member joining only takes checks, the rest stay where they were
+	moved := 0
+	for id, owner := range owners {
+		switch joined := ShardOwner(id, append(members, "worker-4")); joined {
+		case owner:
+		case "worker-4":
+			moved++
+		default:
+			t.Fatalf("%s moved from %s to %s", id, owner, joined)
+		}
+	}
+	if moved < 600 || moved > 900 {
+		t.Fatalf("moved to the new member. Want: about 750 Got: %d", moved)
+	}
+
+	// a member leaving only gives up its own checks
+	for id, owner := range owners {
+		if left := ShardOwner(id, members[1:]); owner != "worker-1" && left != owner {
+			t.Fatalf("%s moved from %s to %s", id, owner, left)
+		}
+	}
+}
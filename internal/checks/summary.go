@@ -0,0 +1,38 @@
+package checks
+
+import "time"
+
+// StatusCheckSummary aggregates the StatusCheckResults of one check and
+// region over a bucket starting at Timestamp. Latency averages only
+// include results that received a response.
+type StatusCheckSummary struct {
+	Metadata      StatusCheckMetadata `json:"metadata"`
+	Timestamp     time.Time           `json:"timestamp"`
+	Count         int64               `json:"count"`
+	Failures      int64               `json:"failures"`
+	UptimePercent float64             `json:"uptime_percent"`
+	TTFBAvg       int64               `json:"firstbyte_avg_ms"`
+	TTFBMax       int64               `json:"firstbyte_max_ms"`
+	ConnectAvg    int64               `json:"connect_avg_ms"`
+}
+
+// Uptime is the share of successful results of a check between From and
+// To. Region is empty when every region is included.
+type Uptime struct {
+	CheckID       string    `json:"check_id"`
+	Region        string    `json:"region,omitempty"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Count         int64     `json:"count"`
+	Failures      int64     `json:"failures"`
+	UptimePercent float64   `json:"uptime_percent"`
+}
+
+// UptimePercent returns the percentage of count that did not fail, or 0
+// when there are no results
+func UptimePercent(count int64, failures int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(count-failures) / float64(count) * 100
+}
@@ -0,0 +1,37 @@
+package checks
+
+import "fmt"
+
+// Tenant is a team sharing the installation. Its checks, results and api
+// tokens are only visible to it, and its quotas limit the checks it can
+// add.
+type Tenant struct {
+	Name string `json:"name" bson:"_id"`
+	// MaxChecks is how many checks the tenant can have, 0 is no limit
+	MaxChecks int `json:"max_checks" bson:"max_checks"`
+	// MinInterval is the shortest check interval in seconds, 0 is no limit
+	MinInterval int `json:"min_interval" bson:"min_interval"`
+}
+
+// QuotaError is returned when a check exceeds its tenant's quota
+type QuotaError struct {
+	Tenant string
+	Reason string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s quota: %s", e.Tenant, e.Reason)
+}
+
+// CheckQuota returns a *QuotaError if the tenant can not have check in
+// addition to count other checks
+func (t Tenant) CheckQuota(check StatusCheck, count int) error {
+	if t.MinInterval > 0 && check.Interval < t.MinInterval {
+		return &QuotaError{t.Name, fmt.Sprintf("check %s interval %ds is shorter than the minimum %ds",
+			check.ID, check.Interval, t.MinInterval)}
+	}
+	if t.MaxChecks > 0 && count+1 > t.MaxChecks {
+		return &QuotaError{t.Name, fmt.Sprintf("at most %d checks", t.MaxChecks)}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package checks
+
+import "time"
+
+// Worker is a worker process registered with the controller. The stats are
+// from its last heartbeat.
+type Worker struct {
+	ID       string `json:"id" bson:"_id"`
+	Region   string `json:"region" bson:"region"`
+	Version  string `json:"version" bson:"version"`
+	Hostname string `json:"hostname" bson:"hostname"`
+	// Capacity is how many checks the worker should run, 0 is no limit
+	Capacity int       `json:"capacity" bson:"capacity"`
+	Started  time.Time `json:"started" bson:"started"`
+	// LastSeen is when the controller last heard from the worker
+	LastSeen time.Time `json:"last_seen" bson:"last_seen"`
+	// Stopped is set when the worker shut down cleanly
+	Stopped    bool   `json:"stopped" bson:"stopped"`
+	Checks     int    `json:"checks" bson:"checks"`
+	Goroutines int    `json:"goroutines" bson:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc" bson:"heap_alloc"`
+}
+
+// Live reports whether the worker is running and was seen within timeout
+func (w Worker) Live(now time.Time, timeout time.Duration) bool {
+	return !w.Stopped && now.Sub(w.LastSeen) <= timeout
+}
+
+// OfflineRegions returns the regions that have registered workers but no
+// live one. Regions that never had a registered worker are not included,
+// their workers may not be configured to register.
+func OfflineRegions(workers []Worker, now time.Time, timeout time.Duration) map[string]bool {
+	offline := make(map[string]bool)
+	for _, w := range workers {
+		if w.Live(now, timeout) {
+			offline[w.Region] = false
+		} else if _, ok := offline[w.Region]; !ok {
+			offline[w.Region] = true
+		}
+	}
+	for region, isOffline := range offline {
+		if !isOffline {
+			delete(offline, region)
+		}
+	}
+	return offline
+}
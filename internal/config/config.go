@@ -0,0 +1,363 @@
+// Package config loads the settings for every subcommand. Values come from
+// the defaults, then a YAML or JSON file, then environment variables and
+// finally flags, each overriding the one before.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/larntz/status/internal/data"
+)
+
+// Environments
+const (
+	Production  = "production"
+	Development = "development"
+)
+
+// Config holds every setting, see Default for the default values
+type Config struct {
+	// Environment is production or development and picks the log format,
+	// any other value is development as it was before the config file
+	Environment string     `json:"environment" yaml:"environment"`
+	Database    Database   `json:"database" yaml:"database"`
+	Worker      Worker     `json:"worker" yaml:"worker"`
+	Controller  Controller `json:"controller" yaml:"controller"`
+}
+
+// Database configures the database connection, see data.Options
+type Database struct {
+	ConnectionString      string   `json:"connection_string" yaml:"connection_string"`
+	ConnectTimeout        Duration `json:"connect_timeout" yaml:"connect_timeout"`
+	QueryTimeout          Duration `json:"query_timeout" yaml:"query_timeout"`
+	WriteTimeout          Duration `json:"write_timeout" yaml:"write_timeout"`
+	MaxPoolSize           uint64   `json:"max_pool_size" yaml:"max_pool_size"` // 0 uses the backend default
+	MinPoolSize           uint64   `json:"min_pool_size" yaml:"min_pool_size"` // 0 uses the backend default
+	ResultRetention       Duration `json:"result_retention" yaml:"result_retention"`
+	ResultGranularity     string   `json:"result_granularity" yaml:"result_granularity"`
+	HourlyRollupRetention Duration `json:"hourly_rollup_retention" yaml:"hourly_rollup_retention"`
+	DailyRollupRetention  Duration `json:"daily_rollup_retention" yaml:"daily_rollup_retention"`
+}
+
+// Worker configures the worker subcommand
+type Worker struct {
+	// Region is required to run a worker
+	Region string `json:"region" yaml:"region"`
+	// UpdateInterval is how often checks are reloaded
+	UpdateInterval Duration `json:"update_interval" yaml:"update_interval"`
+	// StatusInterval is how often goroutine and memory stats are logged
+	StatusInterval Duration `json:"status_interval" yaml:"status_interval"`
+	// SendInterval is how often results are written to the database
+	SendInterval Duration `json:"send_interval" yaml:"send_interval"`
+	// ResultBuffer is how many results can wait to be sent
+	ResultBuffer int `json:"result_buffer" yaml:"result_buffer"`
+	// MaxJitter is the longest random delay before a check first runs,
+	// it spreads checks over time
+	MaxJitter Duration `json:"max_jitter" yaml:"max_jitter"`
+	// Controller is the controller url the worker registers with, sends
+	// heartbeats to and receives check changes from. The database is still
+	// polled every UpdateInterval in case the push connection misses a
+	// change.
+	Controller string `json:"controller" yaml:"controller"`
+	// Capacity is how many checks the worker reports it can run, 0 is no
+	// limit. It is sent to the controller when the worker registers.
+	Capacity int `json:"capacity" yaml:"capacity"`
+	// Handoff is how long a worker that joins the region waits before it
+	// takes over its share of the checks. Workers that register with a
+	// controller re-read the other workers of the region three times per
+	// Handoff and run only the checks they own.
+	Handoff Duration `json:"handoff" yaml:"handoff"`
+	// PeerTimeout is the longest a worker can go without a heartbeat
+	// before the other workers take over its checks. They take over as
+	// soon as it misses one, after StatusInterval plus Handoff, when that
+	// is shorter.
+	PeerTimeout Duration `json:"peer_timeout" yaml:"peer_timeout"`
+	// Token is the api token, with the worker scope, the worker sends to
+	// the controller
+	Token string `json:"token" yaml:"token"`
+	// TLSCert and TLSKey are the worker's client certificate for a
+	// controller with controller.client_ca set, see status ca worker. A
+	// worker with a certificate loads checks, sends results and reads
+	// sealed secrets through the controller, which only serves the region
+	// in the certificate. It needs no database connection string.
+	TLSCert string `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey  string `json:"tls_key" yaml:"tls_key"`
+	// TLSCA verifies the controller's certificate instead of the system
+	// roots
+	TLSCA string `json:"tls_ca" yaml:"tls_ca"`
+	// SecretsDir holds one file per secret named after it, for the
+	// ${secret:name} references in checks
+	SecretsDir string `json:"secrets_dir" yaml:"secrets_dir"`
+	// SecretKeyFile is the key that decrypts the secrets stored in the
+	// database, see status secret key
+	SecretKeyFile string `json:"secret_key_file" yaml:"secret_key_file"`
+}
+
+// Controller configures the controller subcommand
+type Controller struct {
+	// Addr is the address the api and status page listen on
+	Addr string `json:"addr" yaml:"addr"`
+	// RollupInterval is how often rollups are recomputed
+	RollupInterval Duration `json:"rollup_interval" yaml:"rollup_interval"`
+	// RollupLookback is how far back each rollup run recomputes
+	RollupLookback Duration `json:"rollup_lookback" yaml:"rollup_lookback"`
+	// WatchInterval is how often the controller looks for check changes
+	// to push to workers
+	WatchInterval Duration `json:"watch_interval" yaml:"watch_interval"`
+	// WorkerTimeout is how long a worker can go without a heartbeat before
+	// it is no longer live
+	WorkerTimeout Duration `json:"worker_timeout" yaml:"worker_timeout"`
+	// LeaderLease is how long the leader's lease lasts without renewal.
+	// Only the leader computes rollups, when it stops another replica
+	// takes over within LeaderLease.
+	LeaderLease Duration `json:"leader_lease" yaml:"leader_lease"`
+	// Auth requires an api token on every api request. The status page,
+	// static files and badges stay public. It can only be turned off when
+	// Addr is a loopback address.
+	Auth bool `json:"auth" yaml:"auth"`
+	// TLSCert and TLSKey make the controller serve https
+	TLSCert string `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey  string `json:"tls_key" yaml:"tls_key"`
+	// ClientCA verifies worker client certificates. A worker with a
+	// certificate needs no token and is only served the checks of the
+	// region in its certificate.
+	ClientCA string `json:"client_ca" yaml:"client_ca"`
+}
+
+// Default returns the default config
+func Default() Config {
+	return Config{
+		Environment: Production,
+		Database: Database{
+			ConnectTimeout:        Duration(5 * time.Second),
+			QueryTimeout:          Duration(30 * time.Second),
+			WriteTimeout:          Duration(30 * time.Second),
+			ResultRetention:       Duration(72 * time.Hour),
+			ResultGranularity:     "minutes",
+			HourlyRollupRetention: Duration(90 * 24 * time.Hour),
+			DailyRollupRetention:  Duration(3 * 365 * 24 * time.Hour),
+		},
+		Worker: Worker{
+			UpdateInterval: Duration(3 * time.Minute),
+			StatusInterval: Duration(time.Minute),
+			SendInterval:   Duration(30 * time.Second),
+			ResultBuffer:   20000,
+			MaxJitter:      Duration(60 * time.Second),
+			Handoff:        Duration(15 * time.Second),
+			PeerTimeout:    Duration(3 * time.Minute),
+		},
+		Controller: Controller{
+			Addr:           "127.0.0.1:4242",
+			RollupInterval: Duration(10 * time.Minute),
+			RollupLookback: Duration(2 * time.Hour),
+			WatchInterval:  Duration(2 * time.Second),
+			WorkerTimeout:  Duration(3 * time.Minute),
+			LeaderLease:    Duration(15 * time.Second),
+			Auth:           true,
+		},
+	}
+}
+
+// Duration is a time.Duration written as a string such as 30s or 3m
+type Duration time.Duration
+
+// MarshalText writes the duration as a string, e.g. 3m0s
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText reads a duration string such as 30s or 3m
+func (d *Duration) UnmarshalText(b []byte) error {
+	parsed, err := time.ParseDuration(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use e.g. 30s or 5m", b)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// LoadFile reads path into c. Files ending in .json are read as JSON,
+// anything else as YAML. Unknown keys are an error so typos are not
+// silently ignored.
+func (c *Config) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(c); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadEnv sets every setting that has its environment variable set
+func (c *Config) LoadEnv() error {
+	var errs []error
+	for _, s := range c.settings() {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns every setting that is out of range
+func (c Config) Validate() error {
+	var errs []error
+	if c.Database.ConnectionString != "" {
+		if _, err := data.NewDatabase(c.Database.Options()); err != nil {
+			errs = append(errs, fmt.Errorf("database.connection_string: %w", err))
+		}
+	}
+	if err := c.Database.Options().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("database: %w", err))
+	}
+	for _, d := range []struct {
+		key   string
+		value Duration
+	}{
+		{"database.connect_timeout", c.Database.ConnectTimeout},
+		{"database.query_timeout", c.Database.QueryTimeout},
+		{"database.write_timeout", c.Database.WriteTimeout},
+		{"database.result_retention", c.Database.ResultRetention},
+		{"database.hourly_rollup_retention", c.Database.HourlyRollupRetention},
+		{"database.daily_rollup_retention", c.Database.DailyRollupRetention},
+		{"worker.update_interval", c.Worker.UpdateInterval},
+		{"worker.status_interval", c.Worker.StatusInterval},
+		{"worker.send_interval", c.Worker.SendInterval},
+		{"worker.handoff", c.Worker.Handoff},
+		{"worker.peer_timeout", c.Worker.PeerTimeout},
+		{"controller.rollup_interval", c.Controller.RollupInterval},
+		{"controller.rollup_lookback", c.Controller.RollupLookback},
+		{"controller.watch_interval", c.Controller.WatchInterval},
+		{"controller.worker_timeout", c.Controller.WorkerTimeout},
+		{"controller.leader_lease", c.Controller.LeaderLease},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.key, d.value))
+		}
+	}
+	if c.Worker.MaxJitter < 0 {
+		errs = append(errs, fmt.Errorf("worker.max_jitter must not be negative, got %s", c.Worker.MaxJitter))
+	}
+	if c.Worker.ResultBuffer <= 0 {
+		errs = append(errs, fmt.Errorf("worker.result_buffer must be positive, got %d", c.Worker.ResultBuffer))
+	}
+	if c.Worker.Capacity < 0 {
+		errs = append(errs, fmt.Errorf("worker.capacity must not be negative, got %d", c.Worker.Capacity))
+	}
+	if c.Worker.Controller != "" {
+		if u, err := url.Parse(c.Worker.Controller); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("worker.controller must be an http or https url, got %q", c.Worker.Controller))
+		}
+	}
+	if (c.Worker.TLSCert == "") != (c.Worker.TLSKey == "") {
+		errs = append(errs, errors.New("worker.tls_cert and worker.tls_key must be set together"))
+	}
+	if c.Worker.TLSCert != "" && c.Worker.Controller == "" {
+		errs = append(errs, errors.New("worker.tls_cert needs worker.controller"))
+	}
+	if (c.Controller.TLSCert == "") != (c.Controller.TLSKey == "") {
+		errs = append(errs, errors.New("controller.tls_cert and controller.tls_key must be set together"))
+	}
+	if c.Controller.ClientCA != "" && c.Controller.TLSCert == "" {
+		errs = append(errs, errors.New("controller.client_ca needs controller.tls_cert and controller.tls_key"))
+	}
+	if host, _, err := net.SplitHostPort(c.Controller.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("controller.addr must be host:port, got %q", c.Controller.Addr))
+	} else if !c.Controller.Auth && !isLoopback(host) {
+		errs = append(errs, fmt.Errorf("controller.auth can only be off when controller.addr is a loopback address, got %q",
+			c.Controller.Addr))
+	}
+	return errors.Join(errs...)
+}
+
+// isLoopback reports whether host only accepts connections from the same
+// machine, "" listens on every address
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Options returns the data.Options for the database settings
+func (d Database) Options() data.Options {
+	return data.Options{
+		ConnectionString:      d.ConnectionString,
+		ConnectTimeout:        time.Duration(d.ConnectTimeout),
+		QueryTimeout:          time.Duration(d.QueryTimeout),
+		WriteTimeout:          time.Duration(d.WriteTimeout),
+		MaxPoolSize:           d.MaxPoolSize,
+		MinPoolSize:           d.MinPoolSize,
+		ResultRetention:       time.Duration(d.ResultRetention),
+		ResultGranularity:     d.ResultGranularity,
+		HourlyRollupRetention: time.Duration(d.HourlyRollupRetention),
+		DailyRollupRetention:  time.Duration(d.DailyRollupRetention),
+	}
+}
+
+// dsnPassword matches the password in a key=value connection string
+var dsnPassword = regexp.MustCompile(`(password=)\S+`)
+
+// Redacted returns a copy of c with the database password and the worker
+// token hidden
+func (c Config) Redacted() Config {
+	if c.Worker.Token != "" {
+		c.Worker.Token = "xxxxx"
+	}
+	conn := c.Database.ConnectionString
+	if u, err := url.Parse(conn); err == nil && u.Scheme != "" {
+		conn = u.Redacted()
+	} else {
+		conn = dsnPassword.ReplaceAllString(conn, "${1}xxxxx")
+	}
+	c.Database.ConnectionString = conn
+	return c
+}
+
+// Write encodes c as YAML or JSON in the format read by LoadFile
+func (c Config) Write(w io.Writer, isJSON bool) error {
+	if isJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(c)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
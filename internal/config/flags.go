@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a config value that can be set from the environment or a flag
+type setting struct {
+	key   string // file key, e.g. worker.send_interval
+	env   string
+	usage string
+	value flag.Value
+}
+
+// flagName is the flag for the setting, e.g. --worker.send-interval
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// settings lists every setting of c
+func (c *Config) settings() []setting {
+	return []setting{
+		{"environment", "ENVIRONMENT", "production or development, development logs are human readable and any other value is development", (*stringValue)(&c.Environment)},
+
+		{"database.connection_string", "DB_CONNECTION_STRING", "database url, e.g. mongodb://, postgres:// or sqlite://", (*stringValue)(&c.Database.ConnectionString)},
+		{"database.connect_timeout", "DB_CONNECT_TIMEOUT", "timeout for connecting to the database", (*durationValue)(&c.Database.ConnectTimeout)},
+		{"database.query_timeout", "DB_QUERY_TIMEOUT", "timeout for check reads and writes and result queries", (*durationValue)(&c.Database.QueryTimeout)},
+		{"database.write_timeout", "DB_WRITE_TIMEOUT", "timeout for result writes", (*durationValue)(&c.Database.WriteTimeout)},
+		{"database.max_pool_size", "DB_MAX_POOL_SIZE", "max database connections, 0 uses the backend default", (*uintValue)(&c.Database.MaxPoolSize)},
+		{"database.min_pool_size", "DB_MIN_POOL_SIZE", "min database connections, 0 uses the backend default", (*uintValue)(&c.Database.MinPoolSize)},
+		{"database.result_retention", "DB_RESULT_RETENTION", "how long check results are kept", (*durationValue)(&c.Database.ResultRetention)},
+		{"database.result_granularity", "DB_RESULT_GRANULARITY", "mongo time series granularity: seconds, minutes or hours", (*stringValue)(&c.Database.ResultGranularity)},
+		{"database.hourly_rollup_retention", "DB_HOURLY_ROLLUP_RETENTION", "how long hourly rollups are kept", (*durationValue)(&c.Database.HourlyRollupRetention)},
+		{"database.daily_rollup_retention", "DB_DAILY_ROLLUP_RETENTION", "how long daily rollups are kept", (*durationValue)(&c.Database.DailyRollupRetention)},
+
+		{"worker.region", "WORKER_REGION", "region the worker runs checks for", (*stringValue)(&c.Worker.Region)},
+		{"worker.update_interval", "WORKER_UPDATE_INTERVAL", "how often the worker reloads checks", (*durationValue)(&c.Worker.UpdateInterval)},
+		{"worker.status_interval", "WORKER_STATUS_INTERVAL", "how often the worker logs goroutine and memory stats", (*durationValue)(&c.Worker.StatusInterval)},
+		{"worker.send_interval", "WORKER_SEND_INTERVAL", "how often the worker writes results", (*durationValue)(&c.Worker.SendInterval)},
+		{"worker.result_buffer", "WORKER_RESULT_BUFFER", "how many results can wait to be written", (*intValue)(&c.Worker.ResultBuffer)},
+		{"worker.max_jitter", "WORKER_MAX_JITTER", "longest random delay before a check first runs", (*durationValue)(&c.Worker.MaxJitter)},
+		{"worker.controller", "WORKER_CONTROLLER", "controller url to register with and receive check changes from, e.g. http://controller:4242", (*stringValue)(&c.Worker.Controller)},
+		{"worker.capacity", "WORKER_CAPACITY", "how many checks the worker reports it can run, 0 is no limit", (*intValue)(&c.Worker.Capacity)},
+		{"worker.handoff", "WORKER_HANDOFF", "how long a worker joining the region waits before taking its share of the checks", (*durationValue)(&c.Worker.Handoff)},
+		{"worker.peer_timeout", "WORKER_PEER_TIMEOUT", "longest a worker can miss heartbeats before the others take over its checks, they usually do after one", (*durationValue)(&c.Worker.PeerTimeout)},
+		{"worker.token", "WORKER_TOKEN", "api token with the worker scope sent to the controller", (*stringValue)(&c.Worker.Token)},
+		{"worker.tls_cert", "WORKER_TLS_CERT", "client certificate presented to the controller, see status ca worker, the worker then uses the controller instead of the database", (*stringValue)(&c.Worker.TLSCert)},
+		{"worker.tls_key", "WORKER_TLS_KEY", "key of worker.tls_cert", (*stringValue)(&c.Worker.TLSKey)},
+		{"worker.tls_ca", "WORKER_TLS_CA", "CA certificate that verifies the controller instead of the system roots", (*stringValue)(&c.Worker.TLSCA)},
+		{"worker.secrets_dir", "WORKER_SECRETS_DIR", "directory with one file per secret referenced as ${secret:name}", (*stringValue)(&c.Worker.SecretsDir)},
+		{"worker.secret_key_file", "WORKER_SECRET_KEY_FILE", "key that decrypts the secrets stored in the database", (*stringValue)(&c.Worker.SecretKeyFile)},
+
+		{"controller.addr", "CONTROLLER_ADDR", "address the controller listens on", (*stringValue)(&c.Controller.Addr)},
+		{"controller.rollup_interval", "CONTROLLER_ROLLUP_INTERVAL", "how often the controller recomputes rollups", (*durationValue)(&c.Controller.RollupInterval)},
+		{"controller.rollup_lookback", "CONTROLLER_ROLLUP_LOOKBACK", "how far back each rollup run recomputes", (*durationValue)(&c.Controller.RollupLookback)},
+		{"controller.watch_interval", "CONTROLLER_WATCH_INTERVAL", "how often the controller looks for check changes to push to workers", (*durationValue)(&c.Controller.WatchInterval)},
+		{"controller.worker_timeout", "CONTROLLER_WORKER_TIMEOUT", "how long a worker can miss heartbeats before its region shows unknown", (*durationValue)(&c.Controller.WorkerTimeout)},
+		{"controller.leader_lease", "CONTROLLER_LEADER_LEASE", "how long the leader's lease lasts, another replica takes over within it", (*durationValue)(&c.Controller.LeaderLease)},
+		{"controller.auth", "CONTROLLER_AUTH", "require an api token on api requests, the status page and badges stay public, it can only be off on a loopback controller.addr", (*boolValue)(&c.Controller.Auth)},
+		{"controller.tls_cert", "CONTROLLER_TLS_CERT", "certificate to serve https with", (*stringValue)(&c.Controller.TLSCert)},
+		{"controller.tls_key", "CONTROLLER_TLS_KEY", "key of controller.tls_cert", (*stringValue)(&c.Controller.TLSKey)},
+		{"controller.client_ca", "CONTROLLER_CLIENT_CA", "CA certificate that verifies worker client certificates", (*stringValue)(&c.Controller.ClientCA)},
+	}
+}
+
+// Flags are the config flags registered on a subcommand's flag set
+type Flags struct {
+	path *string
+	set  map[string]string
+}
+
+// RegisterFlags adds --config and a flag for every setting to fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{set: make(map[string]string)}
+	f.path = fs.String("config", "", "config file, yaml or json (env STATUS_CONFIG)")
+
+	defaults := Default()
+	scratch := Default()
+	check := scratch.settings()
+	for i, s := range defaults.settings() {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		if def := s.value.String(); def != "" && def != "0" {
+			usage += fmt.Sprintf(" (default %s)", def)
+		}
+		key, value := s.key, check[i].value
+		fs.Func(s.flagName(), usage, func(v string) error {
+			// parse now so bad values are reported with the flag usage
+			if err := value.Set(v); err != nil {
+				return err
+			}
+			f.set[key] = v
+			return nil
+		})
+	}
+	return f
+}
+
+// IsFlag reports whether name is a flag added by RegisterFlags
+func IsFlag(name string) bool {
+	if name == "config" {
+		return true
+	}
+	var cfg Config
+	for _, s := range cfg.settings() {
+		if s.flagName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Load returns the config after fs has been parsed. The file named by
+// --config or STATUS_CONFIG is read first, then environment variables and
+// then flags. The config is validated and every problem is returned.
+func (f *Flags) Load() (Config, error) {
+	cfg := Default()
+	path := *f.path
+	if path == "" {
+		path = os.Getenv("STATUS_CONFIG")
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	envErr := cfg.LoadEnv()
+	for _, s := range cfg.settings() {
+		if v, ok := f.set[s.key]; ok {
+			s.value.Set(v)
+		}
+	}
+	return cfg, errors.Join(envErr, cfg.Validate())
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q, use true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use e.g. 30s or 5m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return Duration(*v).String() }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	*v = intValue(i)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type uintValue uint64
+
+func (v *uintValue) Set(s string) error {
+	i, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid number %q, must be a positive integer", s)
+	}
+	*v = uintValue(i)
+	return nil
+}
+func (v *uintValue) String() string { return strconv.FormatUint(uint64(*v), 10) }
@@ -0,0 +1,61 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/test"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	test.DatabaseConformance(t, func(t *testing.T) data.Database {
+		t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+		return connect(t, &data.SQLite{})
+	})
+}
+
+// TestPostgresConformance runs against a real server when POSTGRES_TEST_URL
+// is set. Every table is truncated before each test.
+func TestPostgresConformance(t *testing.T) {
+	url, ok := os.LookupEnv("POSTGRES_TEST_URL")
+	if !ok {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	test.DatabaseConformance(t, func(t *testing.T) data.Database {
+		t.Setenv("DB_CONNECTION_STRING", url)
+		db := connect(t, &data.Postgres{})
+		if _, err := db.Pool.Exec(context.Background(),
+			`TRUNCATE status_checks, check_results, ssl_check_results`); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+// TestMongoConformance runs against a real server when MONGO_TEST_URL is
+// set. The status database is dropped before each test.
+func TestMongoConformance(t *testing.T) {
+	url, ok := os.LookupEnv("MONGO_TEST_URL")
+	if !ok {
+		t.Skip("MONGO_TEST_URL not set")
+	}
+	test.DatabaseConformance(t, func(t *testing.T) data.Database {
+		t.Setenv("DB_CONNECTION_STRING", url)
+		db := connect(t, &data.MongoDB{})
+		if err := db.Client.Database("status").Drop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func connect[T data.Database](t *testing.T, db T) T {
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Disconnect(context.Background()) })
+	return db
+}
@@ -1,13 +1,166 @@
 package data
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
 	"github.com/larntz/status/internal/checks"
 )
 
-// Database interface abstracts database access.
+// Database interface abstracts database access. Calls with a context from
+// WithTenant only see and change that tenant's data.
 type Database interface {
-	Connect() error
-	GetRegionChecks(region string) (checks.Checks, error)
-	SendResults(results []interface{}) (int, error)
-	Disconnect()
+	Connect(ctx context.Context) error
+	Disconnect(ctx context.Context) error
+	// Migrate creates or updates collections, tables and indexes and applies
+	// the configured result retention. It is safe to run more than once.
+	Migrate(ctx context.Context) error
+
+	// GetRegionChecks returns all checks assigned to region
+	GetRegionChecks(ctx context.Context, region string) (checks.Checks, error)
+	ListStatusChecks(ctx context.Context) ([]checks.StatusCheck, error)
+	// GetStatusCheck returns ErrNotFound if there is no check with id. Check
+	// ids are unique per tenant, without WithTenant the check of the first
+	// tenant in name order is returned, the default tenant first.
+	GetStatusCheck(ctx context.Context, id string) (checks.StatusCheck, error)
+	// CreateStatusCheck returns ErrExists if the tenant has a check with the
+	// same ID
+	CreateStatusCheck(ctx context.Context, check checks.StatusCheck) error
+	// UpdateStatusCheck returns ErrNotFound if the tenant has no check with
+	// check.ID, the tenant is check.Tenant without WithTenant
+	UpdateStatusCheck(ctx context.Context, check checks.StatusCheck) error
+	// DeleteStatusCheck returns ErrNotFound if there is no check with id, it
+	// deletes the check GetStatusCheck returns
+	DeleteStatusCheck(ctx context.Context, id string) error
+
+	// SendStatusResults writes results and returns how many were inserted.
+	// Results with a ResponseID that was already written are skipped.
+	SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error)
+	// SendSSLResults writes results and returns how many were inserted.
+	// Results with a ResponseID that was already written are skipped.
+	SendSSLResults(ctx context.Context, results []checks.SSLCheckResult) (int, error)
+	// GetStatusResults returns results matching query ordered by timestamp
+	GetStatusResults(ctx context.Context, query ResultQuery) ([]checks.StatusCheckResult, error)
+	// SummarizeStatusResults aggregates results matching query into buckets
+	// of the given length per check and region, ordered by timestamp, check
+	// and region. Limit and Offset apply to the buckets.
+	SummarizeStatusResults(ctx context.Context, query ResultQuery, bucket time.Duration) ([]checks.StatusCheckSummary, error)
+
+	// SaveRollups writes rollups for period, replacing existing buckets for
+	// the same check, region and timestamp
+	SaveRollups(ctx context.Context, period checks.RollupPeriod, rollups []checks.StatusCheckRollup) error
+	// GetRollups returns rollups for period matching query ordered by timestamp
+	GetRollups(ctx context.Context, period checks.RollupPeriod, query ResultQuery) ([]checks.StatusCheckRollup, error)
+
+	// SaveWorker registers a worker or replaces its registration
+	SaveWorker(ctx context.Context, worker checks.Worker) error
+	// ListWorkers returns every registered worker ordered by region and id
+	ListWorkers(ctx context.Context) ([]checks.Worker, error)
+	// DeleteWorker returns ErrNotFound if there is no worker with id
+	DeleteWorker(ctx context.Context, id string) error
+
+	// AcquireLease takes the lease name for holder, or renews it, until
+	// ttl from now by the database clock. It returns false when another
+	// holder has a lease that has not expired.
+	AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease deletes the lease name if holder has it
+	ReleaseLease(ctx context.Context, name string, holder string) error
+
+	// CreateToken returns ErrExists if a token with the same ID exists
+	CreateToken(ctx context.Context, token auth.Token) error
+	// GetToken returns ErrNotFound if there is no token with id
+	GetToken(ctx context.Context, id string) (auth.Token, error)
+	// ListTokens returns every token ordered by id
+	ListTokens(ctx context.Context) ([]auth.Token, error)
+	// DeleteToken returns ErrNotFound if there is no token with id
+	DeleteToken(ctx context.Context, id string) error
+
+	// SaveTenant creates a tenant or replaces its quotas
+	SaveTenant(ctx context.Context, tenant checks.Tenant) error
+	// GetTenant returns ErrNotFound if there is no tenant with name
+	GetTenant(ctx context.Context, name string) (checks.Tenant, error)
+	// ListTenants returns every tenant ordered by name
+	ListTenants(ctx context.Context) ([]checks.Tenant, error)
+	// DeleteTenant returns ErrNotFound if there is no tenant with name.
+	// The tenant's checks are kept.
+	DeleteTenant(ctx context.Context, name string) error
+
+	// SaveSecret creates a secret or replaces its value
+	SaveSecret(ctx context.Context, secret checks.Secret) error
+	// GetSecret returns ErrNotFound if tenant has no secret with name
+	GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error)
+	// ListSecrets returns every secret ordered by tenant and name
+	ListSecrets(ctx context.Context) ([]checks.Secret, error)
+	// DeleteSecret returns ErrNotFound if tenant has no secret with name
+	DeleteSecret(ctx context.Context, tenant string, name string) error
+}
+
+// ResultQuery filters GetStatusResults, SummarizeStatusResults and
+// GetRollups. Zero values match everything.
+type ResultQuery struct {
+	CheckID string
+	Region  string
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	Limit   int
+	Offset  int
+	// After pages GetStatusResults by key, only results ordered after it
+	// are returned. Unlike Offset it stays correct while results are written.
+	After *ResultCursor
+
+	tenant *string // set by scope
+}
+
+// ResultCursor is the position of a result in GetStatusResults order
+type ResultCursor struct {
+	Timestamp  time.Time
+	ResponseID string
+}
+
+var (
+	// ErrNotFound is returned when a check, worker, token, tenant or
+	// secret does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned when creating a check or token that already exists
+	ErrExists = errors.New("already exists")
+)
+
+// NewDatabase returns the Database implementation matching the scheme of
+// the connection string, e.g. mongodb://, postgres:// or sqlite://
+func NewDatabase(opts Options) (Database, error) {
+	connString, err := opts.connectionString()
+	if err != nil {
+		return nil, err
+	}
+	scheme, _, _ := strings.Cut(connString, "://")
+	switch scheme {
+	case "mongodb", "mongodb+srv":
+		return &MongoDB{Options: opts}, nil
+	case "postgres", "postgresql":
+		return &Postgres{Options: opts}, nil
+	case "sqlite":
+		return &SQLite{Options: opts}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database connection string scheme %q", scheme)
+	}
+}
+
+// PartialWriteError is returned by SendStatusResults when only some of the
+// results were written. Failed holds the indexes of the results that
+// were not written and should be retried.
+type PartialWriteError struct {
+	Failed []int
+	Err    error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("%d results not written: %s", len(e.Failed), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
 }
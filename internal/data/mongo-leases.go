@@ -0,0 +1,48 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AcquireLease takes or renews the lease name for holder. Expiry uses the
+// server clock, $$NOW, so controllers with skewed clocks agree. When
+// another holder has the lease the upsert collides with its _id.
+func (db *MongoDB) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: name},
+		{Key: "$expr", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$holder", holder}}},
+			bson.D{{Key: "$lte", Value: bson.A{"$expires", "$$NOW"}}},
+		}}}},
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "holder", Value: holder},
+		{Key: "expires", Value: bson.D{{Key: "$add", Value: bson.A{"$$NOW", ttl.Milliseconds()}}}},
+	}}}}
+	_, err := db.leases().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReleaseLease deletes the lease name if holder has it
+func (db *MongoDB) ReleaseLease(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.leases().DeleteOne(ctx, bson.D{{Key: "_id", Value: name}, {Key: "holder", Value: holder}})
+	return err
+}
+
+func (db *MongoDB) leases() *mongo.Collection {
+	return db.Client.Database("status").Collection("leases")
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// indexOptionsConflictCode is the server error code returned when an index
+// exists with different options
+const indexOptionsConflictCode = 85
+
+// SaveRollups upserts rollups for period. Expired buckets are removed by
+// the TTL index created by Migrate.
+func (db *MongoDB) SaveRollups(ctx context.Context, period checks.RollupPeriod, rollups []checks.StatusCheckRollup) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	if len(rollups) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	models := make([]mongo.WriteModel, len(rollups))
+	for i, r := range rollups {
+		if tenant, ok := TenantFrom(ctx); ok {
+			r.Metadata.Tenant = tenant
+		}
+		id := checks.RollupID(r.Metadata.Tenant, r.Metadata.Region, r.Metadata.CheckID, r.Timestamp)
+		models[i] = mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: id}}).
+			SetReplacement(r).SetUpsert(true)
+	}
+	_, err := db.rollups(period).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// GetRollups returns rollups for period matching query ordered by timestamp
+func (db *MongoDB) GetRollups(ctx context.Context, period checks.RollupPeriod, query ResultQuery) ([]checks.StatusCheckRollup, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	if query.Offset > 0 {
+		opts.SetSkip(int64(query.Offset))
+	}
+	cursor, err := db.rollups(period).Find(ctx, resultFilter(query.scope(ctx)), opts)
+	if err != nil {
+		return nil, err
+	}
+	var rollups []checks.StatusCheckRollup
+	if err = cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+func (db *MongoDB) rollups(period checks.RollupPeriod) *mongo.Collection {
+	return db.Client.Database("status").Collection(rollupTable(period))
+}
+
+// migrateRollupIDs moves the buckets of tenants written before check ids
+// were unique per tenant to their RollupID
+func (db *MongoDB) migrateRollupIDs(ctx context.Context, period checks.RollupPeriod) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	coll := db.rollups(period)
+	cursor, err := coll.Find(ctx, bson.D{{Key: "metadata.tenant", Value: bson.D{{Key: "$nin", Value: bson.A{"", nil}}}}})
+	if err != nil {
+		return err
+	}
+	var docs []struct {
+		ID                       string `bson:"_id"`
+		checks.StatusCheckRollup `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+	var models []mongo.WriteModel
+	for _, d := range docs {
+		r := d.StatusCheckRollup
+		id := checks.RollupID(r.Metadata.Tenant, r.Metadata.Region, r.Metadata.CheckID, r.Timestamp)
+		if id == d.ID {
+			continue
+		}
+		models = append(models,
+			mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: id}}).SetReplacement(r).SetUpsert(true),
+			mongo.NewDeleteOneModel().SetFilter(bson.D{{Key: "_id", Value: d.ID}}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err = coll.BulkWrite(ctx, models)
+	return err
+}
+
+// createRollupIndexes creates the query index and the TTL index enforcing
+// rollup retention, updating the TTL if the retention changed
+func (db *MongoDB) createRollupIndexes(ctx context.Context, period checks.RollupPeriod) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	coll := db.rollups(period)
+	if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "metadata.check_id", Value: 1}, {Key: "timestamp", Value: 1}},
+		Options: options.Index().SetName("check_id_timestamp"),
+	}); err != nil {
+		return err
+	}
+
+	expireAfter := int32(db.Options.rollupRetention(period).Seconds())
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "timestamp", Value: 1}},
+		Options: options.Index().SetName("timestamp_ttl").SetExpireAfterSeconds(expireAfter),
+	})
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != indexOptionsConflictCode {
+		return err
+	}
+	return db.Client.Database("status").RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: rollupTable(period)},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: "timestamp_ttl"},
+			{Key: "expireAfterSeconds", Value: expireAfter},
+		}},
+	}).Err()
+}
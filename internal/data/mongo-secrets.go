@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// SaveSecret creates a secret or replaces its value
+func (db *MongoDB) SaveSecret(ctx context.Context, secret checks.Secret) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		secret.Tenant = tenant
+	}
+	secret.Modified = secret.Modified.UTC()
+	_, err := db.secrets().ReplaceOne(ctx, secretFilter(secret.Tenant, secret.Name), secret,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetSecret returns the secret of tenant with name
+func (db *MongoDB) GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error) {
+	if scope, ok := TenantFrom(ctx); ok && scope != tenant {
+		return checks.Secret{}, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	var secret checks.Secret
+	err := db.secrets().FindOne(ctx, secretFilter(tenant, name)).Decode(&secret)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return checks.Secret{}, ErrNotFound
+	}
+	secret.Modified = secret.Modified.UTC()
+	return secret, err
+}
+
+// ListSecrets returns every secret ordered by tenant and name
+func (db *MongoDB) ListSecrets(ctx context.Context) ([]checks.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "tenant", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := db.secrets().Find(ctx, mongoTenantFilter(ctx, "tenant", bson.D{}), opts)
+	if err != nil {
+		return nil, err
+	}
+	var secrets []checks.Secret
+	if err = cursor.All(ctx, &secrets); err != nil {
+		return nil, err
+	}
+	for i := range secrets {
+		secrets[i].Modified = secrets[i].Modified.UTC()
+	}
+	return secrets, nil
+}
+
+// DeleteSecret removes the secret of tenant with name
+func (db *MongoDB) DeleteSecret(ctx context.Context, tenant string, name string) error {
+	if scope, ok := TenantFrom(ctx); ok && scope != tenant {
+		return ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	result, err := db.secrets().DeleteOne(ctx, secretFilter(tenant, name))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// createSecretIndexes makes tenant and name unique
+func (db *MongoDB) createSecretIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	_, err := db.secrets().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("tenant_name_unique"),
+	})
+	return err
+}
+
+func secretFilter(tenant string, name string) bson.D {
+	return bson.D{{Key: "tenant", Value: tenant}, {Key: "name", Value: name}}
+}
+
+func (db *MongoDB) secrets() *mongo.Collection {
+	return db.Client.Database("status").Collection("secrets")
+}
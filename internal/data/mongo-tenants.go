@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// SaveTenant creates a tenant or replaces its quotas
+func (db *MongoDB) SaveTenant(ctx context.Context, tenant checks.Tenant) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.tenants().ReplaceOne(ctx, bson.D{{Key: "_id", Value: tenant.Name}}, tenant,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetTenant returns the tenant with name
+func (db *MongoDB) GetTenant(ctx context.Context, name string) (checks.Tenant, error) {
+	if tenant, ok := TenantFrom(ctx); ok && tenant != name {
+		return checks.Tenant{}, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	var tenant checks.Tenant
+	err := db.tenants().FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&tenant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return checks.Tenant{}, ErrNotFound
+	}
+	return tenant, err
+}
+
+// ListTenants returns every tenant ordered by name
+func (db *MongoDB) ListTenants(ctx context.Context) ([]checks.Tenant, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	filter := bson.D{}
+	if tenant, ok := TenantFrom(ctx); ok {
+		filter = bson.D{{Key: "_id", Value: tenant}}
+	}
+	cursor, err := db.tenants().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var tenants []checks.Tenant
+	if err = cursor.All(ctx, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// DeleteTenant removes the tenant with name
+func (db *MongoDB) DeleteTenant(ctx context.Context, name string) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	result, err := db.tenants().DeleteOne(ctx, bson.D{{Key: "_id", Value: name}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *MongoDB) tenants() *mongo.Collection {
+	return db.Client.Database("status").Collection("tenants")
+}
@@ -2,25 +2,191 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/checks"
 )
 
 // ResultCollection document format:
 // {
-//   timestamp: "unix_time??",
+//   _id: ResponseID,
+//   timestamp: Timestamp,
 //   metadata: {"region": region, "check_id": checkID},
 //   response_code: ResponseCode,
-//   reoponse_time: ResponseTime,
-//   response_desc: ResponseText
+//   firstbyte_ms: TTFB,
+//   connect_ms: ConnectTiming,
+//   tls_ms: TLSTiming,
+//   dns_ms: DNSTiming,
+//   response_info: ResponseInfo
 // }
 
-// CreateResultCollection creates a time series collection to store check results
-func CreateResultCollection(ctx context.Context, client *mongo.Client, name string) {
-	db := client.Database("status")
-	tso := options.TimeSeries().SetTimeField("timestamp").SetMetaField("metadata").SetGranularity("minutes")
-	// expire after 3 days (60*60*24*3 = 259200)
-	opts := options.CreateCollection().SetTimeSeriesOptions(tso).SetExpireAfterSeconds(259200)
-	db.CreateCollection(ctx, name, opts)
+// Server error codes returned when dropping an index that, or whose
+// collection, does not exist
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+// granularityRank orders time series granularities, mongo can only
+// increase the granularity of an existing collection
+var granularityRank = map[string]int{"seconds": 0, "minutes": 1, "hours": 2}
+
+// Migrate creates the status_checks indexes, the check_results time series
+// collection and the rollup and secrets indexes, and applies the configured retention
+// and granularity.
+// It is safe to run more than once.
+func (db *MongoDB) Migrate(ctx context.Context) error {
+	if err := db.createStatusCheckIndexes(ctx); err != nil {
+		return fmt.Errorf("creating status_checks indexes failed: %w", err)
+	}
+	if err := db.createResultCollection(ctx, "check_results"); err != nil {
+		return fmt.Errorf("creating check_results failed: %w", err)
+	}
+	for _, period := range checks.RollupPeriods {
+		if err := db.createRollupIndexes(ctx, period); err != nil {
+			return fmt.Errorf("creating %s indexes failed: %w", rollupTable(period), err)
+		}
+		if err := db.migrateRollupIDs(ctx, period); err != nil {
+			return fmt.Errorf("migrating %s ids failed: %w", rollupTable(period), err)
+		}
+	}
+	if err := db.createSecretIndexes(ctx); err != nil {
+		return fmt.Errorf("creating secrets indexes failed: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoDB) createStatusCheckIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	// check ids are unique per tenant, checks written before tenants have
+	// no tenant field
+	if _, err := db.statusChecks().UpdateMany(ctx, bson.D{{Key: "tenant", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "tenant", Value: ""}}}}); err != nil {
+		return err
+	}
+	_, err := db.statusChecks().Indexes().DropOne(ctx, "id_unique")
+	var cmdErr mongo.CommandError
+	if err != nil && (!errors.As(err, &cmdErr) || (cmdErr.Code != indexNotFoundCode && cmdErr.Code != namespaceNotFoundCode)) {
+		return err
+	}
+	_, err = db.statusChecks().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("tenant_id_unique")},
+		{Keys: bson.D{{Key: "regions", Value: 1}}, Options: options.Index().SetName("regions")},
+		{Keys: bson.D{{Key: "tenant", Value: 1}}, Options: options.Index().SetName("tenant")},
+	})
+	return err
+}
+
+// createResultCollection creates a time series collection to store check
+// results. An existing time series collection has its retention and
+// granularity updated. A regular collection, which mongo creates when
+// results are inserted before Migrate runs, is renamed to name_legacy
+// and the results inside the retention window are copied over.
+func (db *MongoDB) createResultCollection(ctx context.Context, name string) error {
+	statusDB := db.Client.Database("status")
+	expireAfter := int64(db.Options.resultRetention().Seconds())
+	granularity := db.Options.resultGranularity()
+
+	specs, err := statusDB.ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return err
+	}
+
+	legacy := ""
+	if len(specs) == 1 {
+		if specs[0].Type == "timeseries" {
+			return db.updateResultCollection(ctx, name, specs[0].Options, expireAfter, granularity)
+		}
+		legacy = name + "_legacy"
+		if err := statusDB.RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: "status." + name},
+			{Key: "to", Value: "status." + legacy},
+		}).Err(); err != nil {
+			return fmt.Errorf("renaming %s to %s failed: %w", name, legacy, err)
+		}
+	}
+
+	tso := options.TimeSeries().SetTimeField("timestamp").SetMetaField("metadata").SetGranularity(granularity)
+	opts := options.CreateCollection().SetTimeSeriesOptions(tso).SetExpireAfterSeconds(expireAfter)
+	if err := statusDB.CreateCollection(ctx, name, opts); err != nil {
+		return err
+	}
+	if legacy == "" {
+		return nil
+	}
+	return db.copyLegacyResults(ctx, legacy, name)
+}
+
+// updateResultCollection applies retention and granularity to an existing
+// time series collection
+func (db *MongoDB) updateResultCollection(ctx context.Context, name string, current bson.Raw,
+	expireAfter int64, granularity string) error {
+	currentGranularity, _ := current.Lookup("timeseries", "granularity").StringValueOK()
+	if granularityRank[granularity] < granularityRank[currentGranularity] {
+		return fmt.Errorf("%s granularity is %s and can not be decreased to %s",
+			name, currentGranularity, granularity)
+	}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "expireAfterSeconds", Value: expireAfter},
+	}
+	if granularity != currentGranularity {
+		cmd = append(cmd, bson.E{Key: "timeseries", Value: bson.D{{Key: "granularity", Value: granularity}}})
+	}
+	return db.Client.Database("status").RunCommand(ctx, cmd).Err()
+}
+
+// copyLegacyResults copies results that have not expired from the legacy
+// collection into the time series collection. The legacy collection is
+// left in place for the operator to drop.
+func (db *MongoDB) copyLegacyResults(ctx context.Context, legacy string, name string) error {
+	statusDB := db.Client.Database("status")
+	cutoff := time.Now().UTC().Add(-db.Options.resultRetention())
+	cursor, err := statusDB.Collection(legacy).Find(ctx,
+		bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: cutoff}}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	const batchSize = 1000
+	coll := statusDB.Collection(name)
+	batch := make([]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := db.insertNew(ctx, coll, batch)
+		batch = batch[:0]
+		if err != nil {
+			return fmt.Errorf("copying %s results failed: %w", legacy, err)
+		}
+		return nil
+	}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
 }
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/auth"
+)
+
+// CreateToken inserts a new token
+func (db *MongoDB) CreateToken(ctx context.Context, token auth.Token) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		token.Tenant = tenant
+	}
+	token.Created, token.Expires = token.Created.UTC(), token.Expires.UTC()
+	_, err := db.tokens().InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	return err
+}
+
+// GetToken returns the token with id
+func (db *MongoDB) GetToken(ctx context.Context, id string) (auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	var token auth.Token
+	err := db.tokens().FindOne(ctx, mongoTenantFilter(ctx, "tenant", bson.D{{Key: "_id", Value: id}})).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return auth.Token{}, ErrNotFound
+	}
+	token.Created, token.Expires = token.Created.UTC(), token.Expires.UTC()
+	return token, err
+}
+
+// ListTokens returns every token ordered by id
+func (db *MongoDB) ListTokens(ctx context.Context) ([]auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	cursor, err := db.tokens().Find(ctx, mongoTenantFilter(ctx, "tenant", bson.D{}), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var tokens []auth.Token
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		tokens[i].Created, tokens[i].Expires = tokens[i].Created.UTC(), tokens[i].Expires.UTC()
+	}
+	return tokens, nil
+}
+
+// DeleteToken removes the token with id
+func (db *MongoDB) DeleteToken(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	result, err := db.tokens().DeleteOne(ctx, mongoTenantFilter(ctx, "tenant", bson.D{{Key: "_id", Value: id}}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *MongoDB) tokens() *mongo.Collection {
+	return db.Client.Database("status").Collection("api_tokens")
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// SaveWorker registers a worker or replaces its registration
+func (db *MongoDB) SaveWorker(ctx context.Context, worker checks.Worker) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	worker.Started, worker.LastSeen = worker.Started.UTC(), worker.LastSeen.UTC()
+	_, err := db.workers().ReplaceOne(ctx, bson.D{{Key: "_id", Value: worker.ID}}, worker,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// ListWorkers returns every registered worker ordered by region and id
+func (db *MongoDB) ListWorkers(ctx context.Context) ([]checks.Worker, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "region", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := db.workers().Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var workers []checks.Worker
+	if err = cursor.All(ctx, &workers); err != nil {
+		return nil, err
+	}
+	for i := range workers {
+		workers[i].Started, workers[i].LastSeen = workers[i].Started.UTC(), workers[i].LastSeen.UTC()
+	}
+	return workers, nil
+}
+
+// DeleteWorker removes the worker with id
+func (db *MongoDB) DeleteWorker(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	result, err := db.workers().DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *MongoDB) workers() *mongo.Collection {
+	return db.Client.Database("status").Collection("workers")
+}
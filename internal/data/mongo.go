@@ -4,7 +4,7 @@ package data
 import (
 	"context"
 	"errors"
-	"os"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,36 +15,38 @@ import (
 	"github.com/larntz/status/internal/checks"
 )
 
+// duplicateKeyCode is the server error code for a unique index violation
+const duplicateKeyCode = 11000
+
 // MongoDB struct implements the Database interface
 type MongoDB struct {
-	Client *mongo.Client
+	Client  *mongo.Client
+	Options Options
 }
 
 // Connect to mongo server
-func (db *MongoDB) Connect() error {
+func (db *MongoDB) Connect(ctx context.Context) error {
 	var err error
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, db.Options.connectTimeout())
 	defer cancel()
-	db.Client, err = connect(ctx)
+	connString, err := db.Options.connectionString()
+	if err != nil {
+		return err
+	}
+	db.Client, err = connect(ctx, connString, db.Options)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// Connect verifies we can connect to the database
-func connect(ctx context.Context) (*mongo.Client, error) {
-	connString, ok := os.LookupEnv("DB_CONNECTION_STRING")
-	if !ok {
-		return nil, errors.New("no environment variable DB_CONNECTION_STRING")
-	}
-
+// connect verifies we can connect to the database
+func connect(ctx context.Context, connString string, opts Options) (*mongo.Client, error) {
 	options := options.Client()
 	options.ApplyURI(connString)
-	maxPoolSize := uint64(500)
-	options.MaxPoolSize = &maxPoolSize
-	minPoolSize := uint64(50)
-	options.MinPoolSize = &minPoolSize
+	maxPoolSize, minPoolSize := opts.poolSize(500, 50)
+	options.SetMaxPoolSize(maxPoolSize)
+	options.SetMinPoolSize(minPoolSize)
 
 	dbClient, err := mongo.NewClient(options)
 	if err != nil {
@@ -64,18 +66,17 @@ func connect(ctx context.Context) (*mongo.Client, error) {
 }
 
 // GetRegionChecks returns all checks assigned to a region
-func (db MongoDB) GetRegionChecks(region string) (checks.Checks, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (db *MongoDB) GetRegionChecks(ctx context.Context, region string) (checks.Checks, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
 	defer cancel()
 
-	filter := bson.D{{Key: "regions", Value: region}}
-	statusChecksColl := db.Client.Database("status").Collection("status_checks")
-	cursor, err := statusChecksColl.Find(ctx, filter)
+	filter := mongoTenantFilter(ctx, "tenant", bson.D{{Key: "regions", Value: region}})
+	cursor, err := db.statusChecks().Find(ctx, filter)
 	if err != nil {
 		return checks.Checks{}, err
 	}
 
-	var statusChecks checks.Checks
+	statusChecks := checks.Checks{Region: region}
 	if err = cursor.All(ctx, &statusChecks.StatusChecks); err != nil {
 		return checks.Checks{}, err
 	}
@@ -83,20 +84,390 @@ func (db MongoDB) GetRegionChecks(region string) (checks.Checks, error) {
 	return statusChecks, nil
 }
 
-// SendResults to Mongo
-func (db MongoDB) SendResults(results []interface{}) (int, error) {
-	coll := db.Client.Database("status").Collection("check_results")
-	result, err := coll.InsertMany(context.TODO(), results)
+// ListStatusChecks returns every check
+func (db *MongoDB) ListStatusChecks(ctx context.Context) ([]checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cursor, err := db.statusChecks().Find(ctx, mongoTenantFilter(ctx, "tenant", bson.D{}), opts)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	var statusChecks []checks.StatusCheck
+	if err = cursor.All(ctx, &statusChecks); err != nil {
+		return nil, err
+	}
+	return statusChecks, nil
+}
+
+// GetStatusCheck returns the check with id
+func (db *MongoDB) GetStatusCheck(ctx context.Context, id string) (checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	var check checks.StatusCheck
+	opts := options.FindOne().SetSort(bson.D{{Key: "tenant", Value: 1}})
+	err := db.statusChecks().FindOne(ctx, mongoTenantFilter(ctx, "tenant", bson.D{{Key: "id", Value: id}}), opts).Decode(&check)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return checks.StatusCheck{}, ErrNotFound
+	}
+	return check, err
+}
+
+// CreateStatusCheck inserts a new check
+func (db *MongoDB) CreateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		check.Tenant = tenant
+	}
+	// upsert with $setOnInsert so an existing check is never overwritten
+	opts := options.Update().SetUpsert(true)
+	result, err := db.statusChecks().UpdateOne(ctx, bson.D{{Key: "tenant", Value: check.Tenant}, {Key: "id", Value: check.ID}},
+		bson.D{{Key: "$setOnInsert", Value: check}}, opts)
+	if err != nil {
+		return err
+	}
+	if result.UpsertedCount == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+// UpdateStatusCheck replaces an existing check
+func (db *MongoDB) UpdateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		check.Tenant = tenant
+	}
+	filter := bson.D{{Key: "id", Value: check.ID}, tenantElement("tenant", check.Tenant)}
+	result, err := db.statusChecks().ReplaceOne(ctx, filter, check)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteStatusCheck deletes the check with id
+func (db *MongoDB) DeleteStatusCheck(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	opts := options.FindOneAndDelete().SetSort(bson.D{{Key: "tenant", Value: 1}})
+	err := db.statusChecks().FindOneAndDelete(ctx, mongoTenantFilter(ctx, "tenant", bson.D{{Key: "id", Value: id}}), opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SendStatusResults to Mongo. Results are keyed on their ResponseID so a
+// result that was already written is skipped instead of duplicated.
+// When some of the results fail a *PartialWriteError lists the ones
+// that should be retried.
+func (db *MongoDB) SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error) {
+	docs := make([]interface{}, len(results))
+	for i := range results {
+		docs[i] = scopeResult(ctx, results[i])
+	}
+	return db.insertNew(ctx, db.Client.Database("status").Collection("check_results"), docs)
+}
+
+// SendSSLResults to Mongo. Like SendStatusResults duplicates are skipped.
+func (db *MongoDB) SendSSLResults(ctx context.Context, results []checks.SSLCheckResult) (int, error) {
+	docs := make([]interface{}, len(results))
+	for i := range results {
+		docs[i] = results[i]
+	}
+	return db.insertMany(ctx, db.Client.Database("status").Collection("ssl_check_results"), docs)
+}
+
+// GetStatusResults returns results matching query ordered by timestamp
+func (db *MongoDB) GetStatusResults(ctx context.Context, query ResultQuery) ([]checks.StatusCheckResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	filter := resultFilter(query.scope(ctx))
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	if query.Offset > 0 {
+		opts.SetSkip(int64(query.Offset))
+	}
+	cursor, err := db.Client.Database("status").Collection("check_results").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []checks.StatusCheckResult
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SummarizeStatusResults aggregates results matching query into buckets
+func (db *MongoDB) SummarizeStatusResults(ctx context.Context, query ResultQuery, bucket time.Duration) ([]checks.StatusCheckSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	millis := bson.D{{Key: "$toLong", Value: "$timestamp"}}
+	bucketStart := bson.D{{Key: "$toDate", Value: bson.D{{Key: "$subtract", Value: bson.A{
+		millis, bson.D{{Key: "$mod", Value: bson.A{millis, bucket.Milliseconds()}}}}}}}}
+	up := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$gte", Value: bson.A{"$response_code", 200}}},
+		bson.D{{Key: "$lt", Value: bson.A{"$response_code", 400}}},
+		bson.D{{Key: "$ne", Value: bson.A{"$assertion_failed", true}}},
+	}}}
+	// only results that got a response have timings, $avg and $max skip nulls
+	timed := func(field string) bson.D {
+		return bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{"$response_code", 0}}},
+			bson.D{{Key: "$ifNull", Value: bson.A{"$" + field, 0}}},
+			nil,
+		}}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: resultFilter(query.scope(ctx))}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "region", Value: "$metadata.region"},
+				{Key: "check_id", Value: "$metadata.check_id"},
+				{Key: "tenant", Value: "$metadata.tenant"},
+				{Key: "timestamp", Value: bucketStart},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "failures", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{up, 0, 1}}}}}},
+			{Key: "firstbyte_avg_ms", Value: bson.D{{Key: "$avg", Value: timed("firstbyte_ms")}}},
+			{Key: "firstbyte_max_ms", Value: bson.D{{Key: "$max", Value: timed("firstbyte_ms")}}},
+			{Key: "connect_avg_ms", Value: bson.D{{Key: "$avg", Value: timed("connect_ms")}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "_id.timestamp", Value: 1}, {Key: "_id.check_id", Value: 1}, {Key: "_id.region", Value: 1},
+		}}},
+	}
+	if query.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: query.Offset}})
+	}
+	if query.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit}})
+	}
+
+	cursor, err := db.Client.Database("status").Collection("check_results").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID struct {
+			Region    string    `bson:"region"`
+			CheckID   string    `bson:"check_id"`
+			Tenant    string    `bson:"tenant"`
+			Timestamp time.Time `bson:"timestamp"`
+		} `bson:"_id"`
+		Count      int64    `bson:"count"`
+		Failures   int64    `bson:"failures"`
+		TTFBAvg    *float64 `bson:"firstbyte_avg_ms"`
+		TTFBMax    *int64   `bson:"firstbyte_max_ms"`
+		ConnectAvg *float64 `bson:"connect_avg_ms"`
+	}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
 	}
 
-	return len(result.InsertedIDs), nil
+	summaries := make([]checks.StatusCheckSummary, len(docs))
+	for i, d := range docs {
+		s := checks.StatusCheckSummary{
+			Metadata:      checks.StatusCheckMetadata{Region: d.ID.Region, CheckID: d.ID.CheckID, Tenant: d.ID.Tenant},
+			Timestamp:     d.ID.Timestamp.UTC(),
+			Count:         d.Count,
+			Failures:      d.Failures,
+			UptimePercent: checks.UptimePercent(d.Count, d.Failures),
+		}
+		if d.TTFBAvg != nil {
+			s.TTFBAvg = int64(math.Round(*d.TTFBAvg))
+		}
+		if d.TTFBMax != nil {
+			s.TTFBMax = *d.TTFBMax
+		}
+		if d.ConnectAvg != nil {
+			s.ConnectAvg = int64(math.Round(*d.ConnectAvg))
+		}
+		summaries[i] = s
+	}
+	return summaries, nil
 }
 
 // Disconnect Mongo
-func (db MongoDB) Disconnect() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (db *MongoDB) Disconnect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.connectTimeout())
+	defer cancel()
+	return db.Client.Disconnect(ctx)
+}
+
+func (db *MongoDB) statusChecks() *mongo.Collection {
+	return db.Client.Database("status").Collection("status_checks")
+}
+
+// insertMany inserts docs keyed on _id, treating duplicate keys as already written
+func (db *MongoDB) insertMany(ctx context.Context, coll *mongo.Collection, docs []interface{}) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	opts := options.InsertMany().SetOrdered(false)
+	result, err := coll.InsertMany(ctx, docs, opts)
+	if err == nil {
+		return len(result.InsertedIDs), nil
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+		return 0, err
+	}
+
+	var failed []int
+	for _, we := range bwe.WriteErrors {
+		if we.Code == duplicateKeyCode {
+			continue // already written
+		}
+		failed = append(failed, we.Index)
+	}
+	inserted := len(docs) - len(bwe.WriteErrors)
+	if len(failed) == 0 {
+		return inserted, nil
+	}
+	return inserted, &PartialWriteError{Failed: failed, Err: err}
+}
+
+// insertNew inserts the docs whose _id is not in coll yet. check_results
+// is a time series collection after Migrate and those do not enforce a
+// unique _id, so insertMany alone would store a resent result twice. Only
+// one worker sends a result, the lookup does not race with another insert.
+func (db *MongoDB) insertNew(ctx context.Context, coll *mongo.Collection, docs []interface{}) (int, error) {
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	ids := make([]interface{}, len(docs))
+	keys := make([]string, len(docs))
+	var from, to time.Time
+	for i, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return 0, err
+		}
+		id := bson.Raw(raw).Lookup("_id")
+		ids[i], keys[i] = id, rawKey(id)
+		// the time range lets mongo skip buckets outside the batch
+		if ts, ok := bson.Raw(raw).Lookup("timestamp").TimeOK(); ok {
+			if from.IsZero() || ts.Before(from) {
+				from = ts
+			}
+			if ts.After(to) {
+				to = ts
+			}
+		}
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if !from.IsZero() {
+		filter = append(filter, bson.E{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lte", Value: to}}})
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
 	defer cancel()
-	db.Client.Disconnect(ctx)
+	cursor, err := coll.Find(queryCtx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	var found []bson.Raw
+	if err := cursor.All(queryCtx, &found); err != nil {
+		return 0, err
+	}
+	existing := make(map[string]bool, len(found))
+	for _, doc := range found {
+		existing[rawKey(doc.Lookup("_id"))] = true
+	}
+
+	// index maps the position of a new doc back to docs for PartialWriteError
+	var newDocs []interface{}
+	var index []int
+	for i, doc := range docs {
+		if existing[keys[i]] {
+			continue // already written
+		}
+		existing[keys[i]] = true
+		newDocs = append(newDocs, doc)
+		index = append(index, i)
+	}
+	inserted, err := db.insertMany(ctx, coll, newDocs)
+	var partial *PartialWriteError
+	if errors.As(err, &partial) {
+		for i, failed := range partial.Failed {
+			partial.Failed[i] = index[failed]
+		}
+	}
+	return inserted, err
+}
+
+// rawKey identifies a bson value for comparisons
+func rawKey(v bson.RawValue) string {
+	return string(v.Type) + string(v.Value)
+}
+
+// resultFilter returns the mongo filter for query, used for results and rollups
+func resultFilter(query ResultQuery) bson.D {
+	filter := bson.D{}
+	if query.CheckID != "" {
+		filter = append(filter, bson.E{Key: "metadata.check_id", Value: query.CheckID})
+	}
+	if query.Region != "" {
+		filter = append(filter, bson.E{Key: "metadata.region", Value: query.Region})
+	}
+	timestamp := bson.D{}
+	if !query.From.IsZero() {
+		timestamp = append(timestamp, bson.E{Key: "$gte", Value: query.From})
+	}
+	if !query.To.IsZero() {
+		timestamp = append(timestamp, bson.E{Key: "$lt", Value: query.To})
+	}
+	if len(timestamp) > 0 {
+		filter = append(filter, bson.E{Key: "timestamp", Value: timestamp})
+	}
+	if query.tenant != nil {
+		filter = append(filter, tenantElement("metadata.tenant", *query.tenant))
+	}
+	if query.After != nil {
+		// check_results only, _id is the ResponseID
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gt", Value: query.After.Timestamp}}}},
+			bson.D{{Key: "timestamp", Value: query.After.Timestamp}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: query.After.ResponseID}}}},
+		}})
+	}
+	return filter
+}
+
+// mongoTenantFilter restricts filter to the tenant of ctx stored in key
+func mongoTenantFilter(ctx context.Context, key string, filter bson.D) bson.D {
+	if tenant, ok := TenantFrom(ctx); ok {
+		filter = append(filter, tenantElement(key, tenant))
+	}
+	return filter
+}
+
+// tenantElement matches tenant in key. The default tenant is stored
+// without the field.
+func tenantElement(key string, tenant string) bson.E {
+	if tenant == "" {
+		return bson.E{Key: key, Value: bson.D{{Key: "$in", Value: bson.A{"", nil}}}}
+	}
+	return bson.E{Key: key, Value: tenant}
 }
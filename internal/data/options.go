@@ -0,0 +1,116 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// Options configures a Database. Zero values use the defaults.
+type Options struct {
+	// ConnectionString picks the backend by its scheme, e.g. mongodb://,
+	// postgres:// or sqlite://. Defaults to the DB_CONNECTION_STRING
+	// environment variable.
+	ConnectionString string
+	// ConnectTimeout bounds Connect and Disconnect, default 5s
+	ConnectTimeout time.Duration
+	// QueryTimeout bounds check reads and writes and result queries, default 30s
+	QueryTimeout time.Duration
+	// WriteTimeout bounds result writes, default 30s
+	WriteTimeout time.Duration
+	// MaxPoolSize and MinPoolSize size the connection pool. The defaults
+	// depend on the backend: 500/50 for mongo and 50/5 for postgres.
+	MaxPoolSize uint64
+	MinPoolSize uint64
+	// ResultRetention is how long check results are kept, default 3 days
+	ResultRetention time.Duration
+	// ResultGranularity is the mongo time series granularity for check
+	// results: seconds, minutes or hours. Default minutes.
+	ResultGranularity string
+	// HourlyRollupRetention is how long hourly rollups are kept, default 90 days
+	HourlyRollupRetention time.Duration
+	// DailyRollupRetention is how long daily rollups are kept, default 3 years
+	DailyRollupRetention time.Duration
+}
+
+// Validate returns an error if any option is out of range
+func (o Options) Validate() error {
+	switch o.ResultGranularity {
+	case "", "seconds", "minutes", "hours":
+	default:
+		return fmt.Errorf("result granularity must be seconds, minutes or hours, got %q", o.ResultGranularity)
+	}
+	if o.ResultRetention < 0 {
+		return fmt.Errorf("result retention must be positive, got %s", o.ResultRetention)
+	}
+	if o.MaxPoolSize > 0 && o.MinPoolSize > o.MaxPoolSize {
+		return fmt.Errorf("min pool size (%d) is larger than max pool size (%d)", o.MinPoolSize, o.MaxPoolSize)
+	}
+	return nil
+}
+
+func (o Options) connectionString() (string, error) {
+	if o.ConnectionString != "" {
+		return o.ConnectionString, nil
+	}
+	connString, ok := os.LookupEnv("DB_CONNECTION_STRING")
+	if !ok {
+		return "", errors.New("no database connection string, set DB_CONNECTION_STRING")
+	}
+	return connString, nil
+}
+
+func (o Options) connectTimeout() time.Duration {
+	return durationOrDefault(o.ConnectTimeout, 5*time.Second)
+}
+
+func (o Options) queryTimeout() time.Duration {
+	return durationOrDefault(o.QueryTimeout, 30*time.Second)
+}
+
+func (o Options) writeTimeout() time.Duration {
+	return durationOrDefault(o.WriteTimeout, 30*time.Second)
+}
+
+func (o Options) resultRetention() time.Duration {
+	return durationOrDefault(o.ResultRetention, 72*time.Hour)
+}
+
+func (o Options) rollupRetention(period checks.RollupPeriod) time.Duration {
+	if period == checks.RollupDaily {
+		return durationOrDefault(o.DailyRollupRetention, 3*365*24*time.Hour)
+	}
+	return durationOrDefault(o.HourlyRollupRetention, 90*24*time.Hour)
+}
+
+func (o Options) resultGranularity() string {
+	if o.ResultGranularity == "" {
+		return "minutes"
+	}
+	return o.ResultGranularity
+}
+
+// poolSize returns the configured max and min pool sizes or the defaults
+func (o Options) poolSize(defaultMax uint64, defaultMin uint64) (uint64, uint64) {
+	max, min := o.MaxPoolSize, o.MinPoolSize
+	if max == 0 {
+		max = defaultMax
+	}
+	if min == 0 {
+		min = defaultMin
+	}
+	if min > max {
+		min = max
+	}
+	return max, min
+}
+
+func durationOrDefault(d time.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
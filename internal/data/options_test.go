@@ -0,0 +1,36 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	opts := Options{QueryTimeout: 10 * time.Second, MaxPoolSize: 20}
+	if opts.queryTimeout() != 10*time.Second {
+		t.Fatalf("queryTimeout. Want: 10s Got: %s", opts.queryTimeout())
+	}
+	if opts.writeTimeout() != 30*time.Second {
+		t.Fatalf("writeTimeout default. Want: 30s Got: %s", opts.writeTimeout())
+	}
+	max, min := opts.poolSize(500, 50)
+	if max != 20 || min != 20 {
+		t.Fatalf("poolSize. Want: 20/20 Got: %d/%d", max, min)
+	}
+
+	if err := (Options{ResultGranularity: "days"}).Validate(); err == nil {
+		t.Fatal("Want error for invalid ResultGranularity")
+	}
+	if err := (Options{MaxPoolSize: 5, MinPoolSize: 10}).Validate(); err == nil {
+		t.Fatal("Want error for MinPoolSize larger than MaxPoolSize")
+	}
+
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://env.db")
+	if got, _ := opts.connectionString(); got != "sqlite://env.db" {
+		t.Fatalf("connectionString from env. Got: %s", got)
+	}
+	opts.ConnectionString = "sqlite://opts.db"
+	if got, _ := opts.connectionString(); got != "sqlite://opts.db" {
+		t.Fatalf("connectionString. Got: %s", got)
+	}
+}
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigration is one schema change. Migrations are applied in order
+// and each version is recorded in schema_migrations so it only runs once.
+type postgresMigration struct {
+	version int
+	// timescale migrations only run when the timescaledb extension is installed
+	timescale  bool
+	statements []string
+}
+
+var postgresMigrations = []postgresMigration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE status_checks (
+				id                   text PRIMARY KEY,
+				url                  text NOT NULL,
+				interval_seconds     integer NOT NULL,
+				http_timeout_seconds integer NOT NULL,
+				regions              text[] NOT NULL DEFAULT '{}',
+				modified             timestamptz NOT NULL DEFAULT now(),
+				serial               bigint NOT NULL DEFAULT 0,
+				active               boolean NOT NULL DEFAULT true
+			)`,
+			`CREATE INDEX status_checks_regions_idx ON status_checks USING GIN (regions)`,
+			`CREATE TABLE check_results (
+				response_id   text NOT NULL,
+				region        text NOT NULL,
+				check_id      text NOT NULL,
+				timestamp     timestamptz NOT NULL,
+				response_code integer NOT NULL DEFAULT 0,
+				firstbyte_ms  bigint NOT NULL DEFAULT 0,
+				connect_ms    bigint NOT NULL DEFAULT 0,
+				tls_ms        bigint NOT NULL DEFAULT 0,
+				dns_ms        bigint NOT NULL DEFAULT 0,
+				response_info text NOT NULL DEFAULT ''
+			)`,
+			// hypertables require the time column in every unique index
+			`CREATE UNIQUE INDEX check_results_response_id_idx ON check_results (response_id, timestamp)`,
+			`CREATE INDEX check_results_check_id_idx ON check_results (check_id, timestamp DESC)`,
+		},
+	},
+	{
+		version:   2,
+		timescale: true,
+		statements: []string{
+			`SELECT create_hypertable('check_results', 'timestamp', migrate_data => true, if_not_exists => true)`,
+			// expire after 3 days, the same as the mongo time series collection
+			`SELECT add_retention_policy('check_results', INTERVAL '3 days', if_not_exists => true)`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`CREATE TABLE ssl_check_results (
+				response_id    text PRIMARY KEY,
+				check_id       text NOT NULL,
+				ssl_expiration timestamptz NOT NULL,
+				valid          boolean NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			rollupTableSQL("check_rollups_hourly", "double precision", "timestamptz"),
+			rollupTableSQL("check_rollups_daily", "double precision", "timestamptz"),
+		},
+	},
+	{
+		version: 5,
+		statements: []string{
+			`ALTER TABLE status_checks
+				ADD COLUMN name       text NOT NULL DEFAULT '',
+				ADD COLUMN group_name text NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`ALTER TABLE status_checks
+				ADD COLUMN headers    jsonb NOT NULL DEFAULT '{}',
+				ADD COLUMN assertions jsonb NOT NULL DEFAULT '[]',
+				ADD COLUMN tags       text[] NOT NULL DEFAULT '{}'`,
+			`ALTER TABLE check_results ADD COLUMN assertion_failed boolean NOT NULL DEFAULT false`,
+		},
+	},
+	{
+		version: 7,
+		statements: []string{
+			workerTableSQL("timestamptz"),
+		},
+	},
+	{
+		version: 8,
+		statements: []string{
+			leaseTableSQL("timestamptz"),
+		},
+	},
+	{
+		version: 9,
+		statements: []string{
+			tokenTableSQL("timestamptz"),
+		},
+	},
+	{
+		version: 10,
+		statements: []string{
+			`ALTER TABLE status_checks ADD COLUMN tenant text NOT NULL DEFAULT ''`,
+			`ALTER TABLE check_results ADD COLUMN tenant text NOT NULL DEFAULT ''`,
+			`ALTER TABLE check_rollups_hourly ADD COLUMN tenant text NOT NULL DEFAULT ''`,
+			`ALTER TABLE check_rollups_daily ADD COLUMN tenant text NOT NULL DEFAULT ''`,
+			`ALTER TABLE api_tokens ADD COLUMN tenant text NOT NULL DEFAULT ''`,
+			`CREATE INDEX status_checks_tenant_idx ON status_checks (tenant)`,
+			tenantTableSQL,
+		},
+	},
+	{
+		version: 11,
+		statements: []string{
+			secretTableSQL("timestamptz"),
+		},
+	},
+	{
+		// check ids are unique per tenant
+		version: 12,
+		statements: []string{
+			`ALTER TABLE status_checks DROP CONSTRAINT status_checks_pkey, ADD PRIMARY KEY (tenant, id)`,
+			`ALTER TABLE check_rollups_hourly DROP CONSTRAINT check_rollups_hourly_pkey,
+				ADD PRIMARY KEY (tenant, check_id, region, timestamp)`,
+			`ALTER TABLE check_rollups_daily DROP CONSTRAINT check_rollups_daily_pkey,
+				ADD PRIMARY KEY (tenant, check_id, region, timestamp)`,
+		},
+	},
+}
+
+// Migrate applies schema migrations and the configured result retention.
+// With timescaledb the hypertable retention policy is replaced, otherwise
+// expired results are deleted.
+func (db *Postgres) Migrate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if err := migratePostgres(ctx, db.Pool); err != nil {
+		return err
+	}
+	timescale, err := hasTimescale(ctx, db.Pool)
+	if err != nil {
+		return err
+	}
+	retention := db.Options.resultRetention()
+	if !timescale {
+		_, err := db.Pool.Exec(ctx, `DELETE FROM check_results WHERE timestamp < $1`,
+			time.Now().UTC().Add(-retention))
+		return err
+	}
+	return pgx.BeginFunc(ctx, db.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT remove_retention_policy('check_results', if_exists => true)`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `SELECT add_retention_policy('check_results', $1::interval)`, retention)
+		return err
+	})
+}
+
+// migratePostgres applies any migrations that have not been applied yet
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    integer PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+		return err
+	}
+
+	timescale, err := hasTimescale(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range postgresMigrations {
+		if m.timescale && !timescale {
+			continue
+		}
+		if err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			// serialize concurrent workers running migrations on startup
+			if _, err := tx.Exec(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+			var applied bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.version).Scan(&applied); err != nil {
+				return err
+			}
+			if applied {
+				return nil
+			}
+			for _, stmt := range m.statements {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, m.version)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasTimescale(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var timescale bool
+	err := pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&timescale)
+	return timescale, err
+}
@@ -0,0 +1,666 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+)
+
+// uniqueViolation is the postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// Postgres struct implements the Database interface for PostgreSQL. When
+// the timescaledb extension is installed check_results is created as a
+// hypertable.
+type Postgres struct {
+	Pool    *pgxpool.Pool
+	Options Options
+}
+
+// Connect to the postgres server and apply schema migrations
+func (db *Postgres) Connect(ctx context.Context) error {
+	connString, err := db.Options.connectionString()
+	if err != nil {
+		return err
+	}
+
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return err
+	}
+	maxConns, minConns := db.Options.poolSize(50, 5)
+	config.MaxConns = int32(maxConns)
+	config.MinConns = int32(minConns)
+
+	connectCtx, cancel := context.WithTimeout(ctx, db.Options.connectTimeout())
+	defer cancel()
+	db.Pool, err = pgxpool.NewWithConfig(connectCtx, config)
+	if err != nil {
+		return err
+	}
+	if err := db.Pool.Ping(connectCtx); err != nil {
+		db.Pool.Close()
+		return err
+	}
+
+	migrateCtx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+	if err := migratePostgres(migrateCtx, db.Pool); err != nil {
+		db.Pool.Close()
+		return fmt.Errorf("postgres migrations failed: %w", err)
+	}
+	return nil
+}
+
+// GetRegionChecks returns all checks assigned to a region
+func (db *Postgres) GetRegionChecks(ctx context.Context, region string) (checks.Checks, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "$1 = ANY(regions)", region)
+	statusChecks, err := db.queryStatusChecks(ctx,
+		`SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return checks.Checks{}, err
+	}
+	return checks.Checks{StatusChecks: statusChecks, Region: region}, nil
+}
+
+// ListStatusChecks returns every check
+func (db *Postgres) ListStatusChecks(ctx context.Context) ([]checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "true")
+	return db.queryStatusChecks(ctx, `SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY id`, args...)
+}
+
+// GetStatusCheck returns the check with id
+func (db *Postgres) GetStatusCheck(ctx context.Context, id string) (checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "id = $1", id)
+	statusChecks, err := db.queryStatusChecks(ctx,
+		`SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY tenant LIMIT 1`, args...)
+	if err != nil {
+		return checks.StatusCheck{}, err
+	}
+	if len(statusChecks) == 0 {
+		return checks.StatusCheck{}, ErrNotFound
+	}
+	return statusChecks[0], nil
+}
+
+// CreateStatusCheck inserts a new check
+func (db *Postgres) CreateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO status_checks (`+statusCheckColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		statusCheckArgs(ctx, check)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrExists
+	}
+	return err
+}
+
+// UpdateStatusCheck replaces an existing check
+func (db *Postgres) UpdateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE status_checks
+		SET url = $2, interval_seconds = $3, http_timeout_seconds = $4, regions = $5,
+		    modified = $6, serial = $7, active = $8, name = $9, group_name = $10,
+		    headers = $11, assertions = $12, tags = $13
+		WHERE id = $1 AND tenant = $14`, statusCheckArgs(ctx, check)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteStatusCheck deletes the check with id
+func (db *Postgres) DeleteStatusCheck(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "id = $1", id)
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM status_checks
+		WHERE (tenant, id) = (SELECT tenant, id FROM status_checks WHERE `+where+` ORDER BY tenant LIMIT 1)`, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SendStatusResults to postgres. Results are copied into a temporary table
+// and then inserted into check_results, skipping any ResponseID that was
+// already written.
+func (db *Postgres) SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error) {
+	rows := make([][]interface{}, len(results))
+	for i := range results {
+		rows[i] = resultRow(scopeResult(ctx, results[i]))
+	}
+	return db.copyInsert(ctx, "check_results", resultColumns, rows)
+}
+
+// SendSSLResults to postgres. Like SendStatusResults duplicates are skipped.
+func (db *Postgres) SendSSLResults(ctx context.Context, results []checks.SSLCheckResult) (int, error) {
+	rows := make([][]interface{}, len(results))
+	for i, r := range results {
+		rows[i] = []interface{}{r.ResponseID, r.ID, r.SSLExpiration, r.Valid}
+	}
+	return db.copyInsert(ctx, "ssl_check_results",
+		[]string{"response_id", "check_id", "ssl_expiration", "valid"}, rows)
+}
+
+// GetStatusResults returns results matching query ordered by timestamp
+func (db *Postgres) GetStatusResults(ctx context.Context, query ResultQuery) ([]checks.StatusCheckResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := resultQuerySQL(query.scope(ctx), func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []checks.StatusCheckResult
+	for rows.Next() {
+		var r checks.StatusCheckResult
+		if err := rows.Scan(resultScanDest(&r)...); err != nil {
+			return nil, err
+		}
+		r.Timestamp = r.Timestamp.UTC()
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SummarizeStatusResults aggregates results matching query into buckets
+func (db *Postgres) SummarizeStatusResults(ctx context.Context, query ResultQuery, bucket time.Duration) ([]checks.StatusCheckSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := summaryQuerySQL(query.scope(ctx), bucket,
+		`(floor(extract(epoch FROM timestamp) / %[1]d) * %[1]d)::bigint`,
+		func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []checks.StatusCheckSummary
+	for rows.Next() {
+		s, err := summaryScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// SaveRollups upserts rollups for period and deletes expired buckets
+func (db *Postgres) SaveRollups(ctx context.Context, period checks.RollupPeriod, rollups []checks.StatusCheckRollup) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	table := rollupTable(period)
+	upsert := rollupUpsertSQL(table, func(n int) string { return "$" + strconv.Itoa(n) })
+	batch := &pgx.Batch{}
+	for _, r := range rollups {
+		if tenant, ok := TenantFrom(ctx); ok {
+			r.Metadata.Tenant = tenant
+		}
+		batch.Queue(upsert, rollupRow(r)...)
+	}
+	batch.Queue(`DELETE FROM `+table+` WHERE timestamp < $1`,
+		time.Now().UTC().Add(-db.Options.rollupRetention(period)))
+	return db.Pool.SendBatch(ctx, batch).Close()
+}
+
+// GetRollups returns rollups for period matching query ordered by timestamp
+func (db *Postgres) GetRollups(ctx context.Context, period checks.RollupPeriod, query ResultQuery) ([]checks.StatusCheckRollup, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := rollupQuerySQL(period, query.scope(ctx), func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []checks.StatusCheckRollup
+	for rows.Next() {
+		var r checks.StatusCheckRollup
+		if err := rows.Scan(rollupScanDest(&r)...); err != nil {
+			return nil, err
+		}
+		r.Timestamp = r.Timestamp.UTC()
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// SaveWorker registers a worker or replaces its registration
+func (db *Postgres) SaveWorker(ctx context.Context, worker checks.Worker) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, workerUpsertSQL(func(n int) string { return "$" + strconv.Itoa(n) }), workerRow(worker)...)
+	return err
+}
+
+// ListWorkers returns every registered worker ordered by region and id
+func (db *Postgres) ListWorkers(ctx context.Context) ([]checks.Worker, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+strings.Join(workerColumns, ", ")+` FROM workers ORDER BY region, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workers []checks.Worker
+	for rows.Next() {
+		w, err := workerScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+// DeleteWorker removes the worker with id
+func (db *Postgres) DeleteWorker(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM workers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AcquireLease takes or renews the lease name for holder. Expiry uses the
+// server clock so controllers with skewed clocks agree.
+func (db *Postgres) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	var got string
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO leases (name, holder, expires) VALUES ($1, $2, now() + $3 * interval '1 microsecond')
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires <= now()
+		RETURNING holder`, name, holder, ttl.Microseconds()).Scan(&got)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReleaseLease deletes the lease name if holder has it
+func (db *Postgres) ReleaseLease(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
+
+// CreateToken inserts a new token
+func (db *Postgres) CreateToken(ctx context.Context, token auth.Token) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		token.Tenant = tenant
+	}
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO api_tokens (`+tokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`, tokenRow(token)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrExists
+	}
+	return err
+}
+
+// GetToken returns the token with id
+func (db *Postgres) GetToken(ctx context.Context, id string) (auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "id = $1", id)
+	token, err := tokenScan(db.Pool.QueryRow(ctx,
+		`SELECT `+tokenColumns+` FROM api_tokens WHERE `+where, args...).Scan)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return auth.Token{}, ErrNotFound
+	}
+	return token, err
+}
+
+// ListTokens returns every token ordered by id
+func (db *Postgres) ListTokens(ctx context.Context) ([]auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "true")
+	rows, err := db.Pool.Query(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []auth.Token
+	for rows.Next() {
+		t, err := tokenScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken removes the token with id
+func (db *Postgres) DeleteToken(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "id = $1", id)
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM api_tokens WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveTenant creates a tenant or replaces its quotas
+func (db *Postgres) SaveTenant(ctx context.Context, tenant checks.Tenant) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO tenants (name, max_checks, min_interval) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET max_checks = excluded.max_checks, min_interval = excluded.min_interval`,
+		tenant.Name, tenant.MaxChecks, tenant.MinInterval)
+	return err
+}
+
+// GetTenant returns the tenant with name
+func (db *Postgres) GetTenant(ctx context.Context, name string) (checks.Tenant, error) {
+	tenants, err := db.queryTenants(ctx, "name = $1", name)
+	if err != nil {
+		return checks.Tenant{}, err
+	}
+	if len(tenants) == 0 {
+		return checks.Tenant{}, ErrNotFound
+	}
+	return tenants[0], nil
+}
+
+// ListTenants returns every tenant ordered by name
+func (db *Postgres) ListTenants(ctx context.Context) ([]checks.Tenant, error) {
+	return db.queryTenants(ctx, "true")
+}
+
+// DeleteTenant removes the tenant with name
+func (db *Postgres) DeleteTenant(ctx context.Context, name string) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM tenants WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// queryTenants returns the tenants matching condition, a tenant context
+// only sees its own tenant
+func (db *Postgres) queryTenants(ctx context.Context, condition string, args ...interface{}) ([]checks.Tenant, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		args = append(args, tenant)
+		condition += " AND name = $" + strconv.Itoa(len(args))
+	}
+	rows, err := db.Pool.Query(ctx, `SELECT name, max_checks, min_interval FROM tenants WHERE `+condition+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []checks.Tenant
+	for rows.Next() {
+		var t checks.Tenant
+		if err := rows.Scan(&t.Name, &t.MaxChecks, &t.MinInterval); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// Disconnect from postgres
+func (db *Postgres) Disconnect(_ context.Context) error {
+	db.Pool.Close()
+	return nil
+}
+
+func (db *Postgres) queryStatusChecks(ctx context.Context, sql string, args ...interface{}) ([]checks.StatusCheck, error) {
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statusChecks []checks.StatusCheck
+	for rows.Next() {
+		var c checks.StatusCheck
+		var serial int64
+		if err := rows.Scan(&c.ID, &c.URL, &c.Interval, &c.HTTPTimeout, &c.Regions,
+			&c.Modified, &serial, &c.Active, &c.Name, &c.Group, &c.Headers, &c.Assertions, &c.Tags, &c.Tenant); err != nil {
+			return nil, err
+		}
+		c.Serial = uint64(serial)
+		normalizeStatusCheck(&c)
+		c.Modified = c.Modified.UTC()
+		statusChecks = append(statusChecks, c)
+	}
+	return statusChecks, rows.Err()
+}
+
+// copyInsert copies rows into a temporary table and then inserts them into
+// table, skipping rows that conflict with existing ones
+func (db *Postgres) copyInsert(ctx context.Context, table string, columns []string, rows [][]interface{}) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	incoming := table + "_incoming"
+	if _, err := tx.Exec(ctx, fmt.Sprintf(
+		`CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP`, incoming, table)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{incoming}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s
+		SELECT DISTINCT ON (response_id) * FROM %s
+		ON CONFLICT DO NOTHING`, table, incoming))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// SaveSecret creates a secret or replaces its value
+func (db *Postgres) SaveSecret(ctx context.Context, secret checks.Secret) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		secret.Tenant = tenant
+	}
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO secrets (`+secretColumns+`) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant, name) DO UPDATE SET value = excluded.value, modified = excluded.modified`,
+		secret.Tenant, secret.Name, secret.Value, secret.Modified.UTC())
+	return err
+}
+
+// GetSecret returns the secret of tenant with name
+func (db *Postgres) GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error) {
+	secrets, err := db.querySecrets(ctx, "tenant = $1 AND name = $2", tenant, name)
+	if err != nil {
+		return checks.Secret{}, err
+	}
+	if len(secrets) == 0 {
+		return checks.Secret{}, ErrNotFound
+	}
+	return secrets[0], nil
+}
+
+// ListSecrets returns every secret ordered by tenant and name
+func (db *Postgres) ListSecrets(ctx context.Context) ([]checks.Secret, error) {
+	return db.querySecrets(ctx, "true")
+}
+
+// DeleteSecret removes the secret of tenant with name
+func (db *Postgres) DeleteSecret(ctx context.Context, tenant string, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, "tenant = $1 AND name = $2", tenant, name)
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM secrets WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// querySecrets returns the secrets matching condition, a tenant context
+// only sees its own secrets
+func (db *Postgres) querySecrets(ctx context.Context, condition string, args ...interface{}) ([]checks.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := pgTenantWhere(ctx, condition, args...)
+	rows, err := db.Pool.Query(ctx, `SELECT `+secretColumns+` FROM secrets WHERE `+where+` ORDER BY tenant, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []checks.Secret
+	for rows.Next() {
+		s, err := secretScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, rows.Err()
+}
+
+// pgTenantWhere joins condition, which uses args, with the tenant
+// condition of ctx
+func pgTenantWhere(ctx context.Context, condition string, args ...interface{}) (string, []interface{}) {
+	tenant, args := tenantCondition(ctx, args, func(n int) string { return "$" + strconv.Itoa(n) })
+	if tenant == "" {
+		return condition, args
+	}
+	return condition + " AND " + tenant, args
+}
+
+// statusCheckArgs returns c as values matching statusCheckColumns, a check
+// written with a tenant context belongs to the tenant
+func statusCheckArgs(ctx context.Context, c checks.StatusCheck) []interface{} {
+	if tenant, ok := TenantFrom(ctx); ok {
+		c.Tenant = tenant
+	}
+	regions, headers, assertions, tags := c.Regions, c.Headers, c.Assertions, c.Tags
+	if regions == nil {
+		regions = []string{}
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if assertions == nil {
+		assertions = []checks.Assertion{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return []interface{}{c.ID, c.URL, c.Interval, c.HTTPTimeout, regions,
+		c.Modified, int64(c.Serial), c.Active, c.Name, c.Group, headers, assertions, tags, c.Tenant}
+}
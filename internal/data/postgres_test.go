@@ -0,0 +1,44 @@
+package data
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostgresMigrationsOrdered(t *testing.T) {
+	for i, m := range postgresMigrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %d has version %d, versions must be sequential", i, m.version)
+		}
+		if len(m.statements) == 0 {
+			t.Fatalf("migration %d has no statements", m.version)
+		}
+	}
+}
+
+func TestResultQuerySQL(t *testing.T) {
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, args := resultQuerySQL(ResultQuery{CheckID: "test-check-1", From: from, Limit: 10},
+		func(n int) string { return "$" + strconv.Itoa(n) })
+
+	want := "SELECT response_id, region, check_id, timestamp, response_code, firstbyte_ms, connect_ms, " +
+		"tls_ms, dns_ms, response_info, assertion_failed, tenant FROM check_results WHERE check_id = $1 AND timestamp >= $2 " +
+		"ORDER BY timestamp, response_id LIMIT $3"
+	if sql != want {
+		t.Fatalf("resultQuerySQL.\nWant: %s\nGot:  %s", want, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"test-check-1", from, 10}) {
+		t.Fatalf("resultQuerySQL args. Got: %v", args)
+	}
+	sql, args = resultQuerySQL(ResultQuery{After: &ResultCursor{Timestamp: from, ResponseID: "r1"}, Limit: 10},
+		func(n int) string { return "$" + strconv.Itoa(n) })
+	if !strings.HasSuffix(sql, "WHERE (timestamp, response_id) > ($1, $2) ORDER BY timestamp, response_id LIMIT $3") {
+		t.Fatalf("resultQuerySQL after. Got: %s", sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{from, "r1", 10}) {
+		t.Fatalf("resultQuerySQL after args. Got: %v", args)
+	}
+}
@@ -0,0 +1,363 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+)
+
+// Shared helpers for the sql backends, Postgres and SQLite.
+
+// statusCheckColumns are the status_checks columns in StatusCheck field order
+const statusCheckColumns = `id, url, interval_seconds, http_timeout_seconds, regions, modified, serial, active, name, group_name, ` +
+	`headers, assertions, tags, tenant`
+
+// normalizeStatusCheck sets empty headers, assertions and tags read from
+// the database to nil, matching checks that never had them
+func normalizeStatusCheck(c *checks.StatusCheck) {
+	if len(c.Headers) == 0 {
+		c.Headers = nil
+	}
+	if len(c.Assertions) == 0 {
+		c.Assertions = nil
+	}
+	if len(c.Tags) == 0 {
+		c.Tags = nil
+	}
+}
+
+// resultColumns are the check_results columns in StatusCheckResult field order
+var resultColumns = []string{
+	"response_id", "region", "check_id", "timestamp", "response_code",
+	"firstbyte_ms", "connect_ms", "tls_ms", "dns_ms", "response_info", "assertion_failed", "tenant",
+}
+
+// resultRow returns r as values matching resultColumns
+func resultRow(r checks.StatusCheckResult) []interface{} {
+	return []interface{}{
+		r.ResponseID, r.Metadata.Region, r.Metadata.CheckID, r.Timestamp.UTC(), r.ResponseCode,
+		r.TTFB, r.ConnectTiming, r.TLSTiming, r.DNSTiming, r.ResponseInfo, r.AssertionFailed, r.Metadata.Tenant,
+	}
+}
+
+// resultScanDest returns pointers into r matching resultColumns
+func resultScanDest(r *checks.StatusCheckResult) []interface{} {
+	return []interface{}{
+		&r.ResponseID, &r.Metadata.Region, &r.Metadata.CheckID, &r.Timestamp, &r.ResponseCode,
+		&r.TTFB, &r.ConnectTiming, &r.TLSTiming, &r.DNSTiming, &r.ResponseInfo, &r.AssertionFailed, &r.Metadata.Tenant,
+	}
+}
+
+// rollupColumns are the rollup table columns in StatusCheckRollup field order
+var rollupColumns = []string{
+	"region", "check_id", "timestamp", "count", "failures", "uptime_percent",
+	"firstbyte_p50_ms", "firstbyte_p95_ms", "firstbyte_p99_ms",
+	"connect_p50_ms", "connect_p95_ms", "connect_p99_ms", "tenant",
+}
+
+// rollupTable returns the table storing rollups for period
+func rollupTable(period checks.RollupPeriod) string {
+	return "check_rollups_" + string(period)
+}
+
+// rollupRow returns r as values matching rollupColumns
+func rollupRow(r checks.StatusCheckRollup) []interface{} {
+	return []interface{}{
+		r.Metadata.Region, r.Metadata.CheckID, r.Timestamp.UTC(), r.Count, r.Failures, r.UptimePercent,
+		r.TTFBP50, r.TTFBP95, r.TTFBP99, r.ConnectP50, r.ConnectP95, r.ConnectP99, r.Metadata.Tenant,
+	}
+}
+
+// rollupScanDest returns pointers into r matching rollupColumns
+func rollupScanDest(r *checks.StatusCheckRollup) []interface{} {
+	return []interface{}{
+		&r.Metadata.Region, &r.Metadata.CheckID, &r.Timestamp, &r.Count, &r.Failures, &r.UptimePercent,
+		&r.TTFBP50, &r.TTFBP95, &r.TTFBP99, &r.ConnectP50, &r.ConnectP95, &r.ConnectP99, &r.Metadata.Tenant,
+	}
+}
+
+// rollupUpsertSQL builds an INSERT for rollupColumns that replaces the
+// existing bucket on conflict. Postgres and sqlite share the syntax.
+func rollupUpsertSQL(table string, placeholder func(n int) string) string {
+	values := make([]string, len(rollupColumns))
+	var updates []string
+	for i, c := range rollupColumns {
+		values[i] = placeholder(i + 1)
+		if c != "tenant" && c != "region" && c != "check_id" && c != "timestamp" {
+			updates = append(updates, c+" = excluded."+c)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (tenant, check_id, region, timestamp) DO UPDATE SET %s",
+		table, strings.Join(rollupColumns, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+}
+
+// rollupQuerySQL builds a SELECT on the rollup table for period
+func rollupQuerySQL(period checks.RollupPeriod, query ResultQuery, placeholder func(n int) string) (string, []interface{}) {
+	return querySQL(rollupTable(period), rollupColumns, "timestamp, check_id, region", query, placeholder)
+}
+
+// resultQuerySQL builds a SELECT on check_results
+func resultQuerySQL(query ResultQuery, placeholder func(n int) string) (string, []interface{}) {
+	return querySQL("check_results", resultColumns, "timestamp, response_id", query, placeholder)
+}
+
+// querySQL builds a SELECT for query. placeholder returns the bind
+// parameter syntax for the nth argument, e.g. $1 or ?.
+func querySQL(table string, columns []string, orderBy string, query ResultQuery,
+	placeholder func(n int) string) (string, []interface{}) {
+	where, args := whereSQL(query, placeholder)
+	sql := "SELECT " + strings.Join(columns, ", ") + " FROM " + table + where + " ORDER BY " + orderBy
+	limit, args := limitSQL(query, args, placeholder)
+	return sql + limit, args
+}
+
+// summaryQuerySQL builds a SELECT aggregating check_results into buckets.
+// bucketExpr formats the bucket length in seconds into an expression
+// returning the bucket start of timestamp in unix seconds.
+func summaryQuerySQL(query ResultQuery, bucket time.Duration, bucketExpr string,
+	placeholder func(n int) string) (string, []interface{}) {
+	// only results that got a response have timings
+	timed := func(column string) string {
+		return "CASE WHEN response_code <> 0 THEN " + column + " END"
+	}
+	where, args := whereSQL(query, placeholder)
+	sql := "SELECT tenant, region, check_id, " + fmt.Sprintf(bucketExpr, int64(bucket.Seconds())) + " AS bucket, " +
+		"count(*), " +
+		"sum(CASE WHEN response_code >= 200 AND response_code < 400 AND NOT assertion_failed THEN 0 ELSE 1 END), " +
+		"CAST(coalesce(avg(" + timed("firstbyte_ms") + "), 0) AS DOUBLE PRECISION), " +
+		"coalesce(max(" + timed("firstbyte_ms") + "), 0), " +
+		"CAST(coalesce(avg(" + timed("connect_ms") + "), 0) AS DOUBLE PRECISION) " +
+		"FROM check_results" + where +
+		" GROUP BY tenant, region, check_id, bucket ORDER BY bucket, check_id, region"
+	limit, args := limitSQL(query, args, placeholder)
+	return sql + limit, args
+}
+
+// summaryScan scans a row of summaryQuerySQL
+func summaryScan(scan func(dest ...interface{}) error) (checks.StatusCheckSummary, error) {
+	var s checks.StatusCheckSummary
+	var bucket int64
+	var ttfbAvg, connectAvg float64
+	if err := scan(&s.Metadata.Tenant, &s.Metadata.Region, &s.Metadata.CheckID, &bucket, &s.Count, &s.Failures,
+		&ttfbAvg, &s.TTFBMax, &connectAvg); err != nil {
+		return s, err
+	}
+	s.Timestamp = time.Unix(bucket, 0).UTC()
+	s.UptimePercent = checks.UptimePercent(s.Count, s.Failures)
+	s.TTFBAvg = int64(math.Round(ttfbAvg))
+	s.ConnectAvg = int64(math.Round(connectAvg))
+	return s, nil
+}
+
+// whereSQL builds the WHERE clause for query
+func whereSQL(query ResultQuery, placeholder func(n int) string) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, placeholder(len(args))))
+	}
+	if query.CheckID != "" {
+		add("check_id = %s", query.CheckID)
+	}
+	if query.Region != "" {
+		add("region = %s", query.Region)
+	}
+	if !query.From.IsZero() {
+		add("timestamp >= %s", query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		add("timestamp < %s", query.To.UTC())
+	}
+	if query.tenant != nil {
+		add("tenant = %s", *query.tenant)
+	}
+	if query.After != nil {
+		// check_results only, the order of resultQuerySQL
+		args = append(args, query.After.Timestamp.UTC(), query.After.ResponseID)
+		where = append(where, fmt.Sprintf("(timestamp, response_id) > (%s, %s)",
+			placeholder(len(args)-1), placeholder(len(args))))
+	}
+	if len(where) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// limitSQL builds the LIMIT and OFFSET clauses for query, appending to args
+func limitSQL(query ResultQuery, args []interface{}, placeholder func(n int) string) (string, []interface{}) {
+	sql := ""
+	switch {
+	case query.Limit > 0:
+		args = append(args, query.Limit)
+		sql += " LIMIT " + placeholder(len(args))
+	case query.Offset > 0:
+		// sqlite only accepts OFFSET after a LIMIT
+		args = append(args, int64(math.MaxInt64))
+		sql += " LIMIT " + placeholder(len(args))
+	}
+	if query.Offset > 0 {
+		args = append(args, query.Offset)
+		sql += " OFFSET " + placeholder(len(args))
+	}
+	return sql, args
+}
+
+// rollupTableSQL returns the CREATE TABLE statement for a rollup table
+func rollupTableSQL(table string, floatType string, timeType string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		region           text NOT NULL,
+		check_id         text NOT NULL,
+		timestamp        %s NOT NULL,
+		count            bigint NOT NULL,
+		failures         bigint NOT NULL,
+		uptime_percent   %s NOT NULL,
+		firstbyte_p50_ms bigint NOT NULL,
+		firstbyte_p95_ms bigint NOT NULL,
+		firstbyte_p99_ms bigint NOT NULL,
+		connect_p50_ms   bigint NOT NULL,
+		connect_p95_ms   bigint NOT NULL,
+		connect_p99_ms   bigint NOT NULL,
+		PRIMARY KEY (check_id, region, timestamp)
+	)`, table, timeType, floatType)
+}
+
+// workerColumns are the workers columns in Worker field order
+var workerColumns = []string{
+	"id", "region", "version", "hostname", "capacity", "started", "last_seen",
+	"stopped", "checks", "goroutines", "heap_alloc",
+}
+
+// workerRow returns w as values matching workerColumns
+func workerRow(w checks.Worker) []interface{} {
+	return []interface{}{
+		w.ID, w.Region, w.Version, w.Hostname, w.Capacity, w.Started.UTC(), w.LastSeen.UTC(),
+		w.Stopped, w.Checks, w.Goroutines, int64(w.HeapAlloc),
+	}
+}
+
+// workerScan scans a row selected with workerColumns
+func workerScan(scan func(dest ...interface{}) error) (checks.Worker, error) {
+	var w checks.Worker
+	var heapAlloc int64
+	if err := scan(&w.ID, &w.Region, &w.Version, &w.Hostname, &w.Capacity, &w.Started, &w.LastSeen,
+		&w.Stopped, &w.Checks, &w.Goroutines, &heapAlloc); err != nil {
+		return w, err
+	}
+	w.HeapAlloc = uint64(heapAlloc)
+	w.Started, w.LastSeen = w.Started.UTC(), w.LastSeen.UTC()
+	return w, nil
+}
+
+// workerUpsertSQL builds an INSERT for workerColumns that replaces an
+// existing registration
+func workerUpsertSQL(placeholder func(n int) string) string {
+	values := make([]string, len(workerColumns))
+	var updates []string
+	for i, c := range workerColumns {
+		values[i] = placeholder(i + 1)
+		if c != "id" {
+			updates = append(updates, c+" = excluded."+c)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO workers (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s",
+		strings.Join(workerColumns, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+}
+
+// workerTableSQL returns the CREATE TABLE statement for the workers table
+func workerTableSQL(timeType string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS workers (
+		id         text PRIMARY KEY,
+		region     text NOT NULL,
+		version    text NOT NULL DEFAULT '',
+		hostname   text NOT NULL DEFAULT '',
+		capacity   integer NOT NULL DEFAULT 0,
+		started    %[1]s NOT NULL,
+		last_seen  %[1]s NOT NULL,
+		stopped    boolean NOT NULL DEFAULT false,
+		checks     integer NOT NULL DEFAULT 0,
+		goroutines integer NOT NULL DEFAULT 0,
+		heap_alloc bigint NOT NULL DEFAULT 0
+	)`, timeType)
+}
+
+// leaseTableSQL returns the CREATE TABLE statement for the leases table
+func leaseTableSQL(timeType string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS leases (
+		name    text PRIMARY KEY,
+		holder  text NOT NULL,
+		expires %s NOT NULL
+	)`, timeType)
+}
+
+// tokenColumns are the api_tokens columns in Token field order
+const tokenColumns = `id, name, hash, scopes, created, expires, tenant`
+
+// tokenRow returns t as values matching tokenColumns. Scopes are stored
+// space separated.
+func tokenRow(t auth.Token) []interface{} {
+	scopes := make([]string, len(t.Scopes))
+	for i, s := range t.Scopes {
+		scopes[i] = string(s)
+	}
+	return []interface{}{t.ID, t.Name, t.Hash, strings.Join(scopes, " "), t.Created.UTC(), t.Expires.UTC(), t.Tenant}
+}
+
+// tokenScan scans a row selected with tokenColumns
+func tokenScan(scan func(dest ...interface{}) error) (auth.Token, error) {
+	var t auth.Token
+	var scopes string
+	if err := scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Created, &t.Expires, &t.Tenant); err != nil {
+		return t, err
+	}
+	for _, s := range strings.Fields(scopes) {
+		t.Scopes = append(t.Scopes, auth.Scope(s))
+	}
+	t.Created, t.Expires = t.Created.UTC(), t.Expires.UTC()
+	return t, nil
+}
+
+// tokenTableSQL returns the CREATE TABLE statement for the api_tokens table
+func tokenTableSQL(timeType string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS api_tokens (
+		id      text PRIMARY KEY,
+		name    text NOT NULL DEFAULT '',
+		hash    text NOT NULL,
+		scopes  text NOT NULL DEFAULT '',
+		created %[1]s NOT NULL,
+		expires %[1]s NOT NULL
+	)`, timeType)
+}
+
+// tenantTableSQL is the CREATE TABLE statement for the tenants table
+const tenantTableSQL = `CREATE TABLE IF NOT EXISTS tenants (
+		name         text PRIMARY KEY,
+		max_checks   integer NOT NULL DEFAULT 0,
+		min_interval integer NOT NULL DEFAULT 0
+	)`
+
+// secretColumns are the columns of the secrets table in scan order
+const secretColumns = `tenant, name, value, modified`
+
+// secretScan scans a row selected with secretColumns
+func secretScan(scan func(dest ...interface{}) error) (checks.Secret, error) {
+	var s checks.Secret
+	err := scan(&s.Tenant, &s.Name, &s.Value, &s.Modified)
+	s.Modified = s.Modified.UTC()
+	return s, err
+}
+
+// secretTableSQL returns the CREATE TABLE statement for the secrets table
+func secretTableSQL(timeType string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS secrets (
+		tenant   text NOT NULL DEFAULT '',
+		name     text NOT NULL,
+		value    text NOT NULL,
+		modified %s NOT NULL,
+		PRIMARY KEY (tenant, name)
+	)`, timeType)
+}
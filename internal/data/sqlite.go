@@ -0,0 +1,879 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// pure go sqlite driver, registers as "sqlite"
+	_ "modernc.org/sqlite"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+)
+
+// SQLite struct implements the Database interface using a single sqlite
+// file. It is meant for small installs and local development.
+type SQLite struct {
+	DB      *sql.DB
+	Options Options
+
+	pruneMutex sync.Mutex
+	lastPrune  time.Time
+}
+
+// sqlitePruneInterval is how often SendResults deletes expired results
+const sqlitePruneInterval = time.Hour
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS status_checks (
+		id                   TEXT PRIMARY KEY,
+		url                  TEXT NOT NULL,
+		interval_seconds     INTEGER NOT NULL,
+		http_timeout_seconds INTEGER NOT NULL,
+		regions              TEXT NOT NULL DEFAULT '[]', -- json array
+		modified             TIMESTAMP NOT NULL,
+		serial               INTEGER NOT NULL DEFAULT 0,
+		active               BOOLEAN NOT NULL DEFAULT 1
+	)`,
+	`CREATE TABLE IF NOT EXISTS check_results (
+		response_id   TEXT PRIMARY KEY,
+		region        TEXT NOT NULL,
+		check_id      TEXT NOT NULL,
+		timestamp     TIMESTAMP NOT NULL,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		firstbyte_ms  INTEGER NOT NULL DEFAULT 0,
+		connect_ms    INTEGER NOT NULL DEFAULT 0,
+		tls_ms        INTEGER NOT NULL DEFAULT 0,
+		dns_ms        INTEGER NOT NULL DEFAULT 0,
+		response_info TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS ssl_check_results (
+		response_id    TEXT PRIMARY KEY,
+		check_id       TEXT NOT NULL,
+		ssl_expiration TIMESTAMP NOT NULL,
+		valid          BOOLEAN NOT NULL
+	)`,
+	rollupTableSQL("check_rollups_hourly", "REAL", "TIMESTAMP"),
+	rollupTableSQL("check_rollups_daily", "REAL", "TIMESTAMP"),
+	workerTableSQL("TIMESTAMP"),
+	leaseTableSQL("TIMESTAMP"),
+	tokenTableSQL("TIMESTAMP"),
+	tenantTableSQL,
+	secretTableSQL("TIMESTAMP"),
+	`CREATE INDEX IF NOT EXISTS check_results_check_id_idx ON check_results (check_id, timestamp)`,
+	`CREATE INDEX IF NOT EXISTS check_results_timestamp_idx ON check_results (timestamp)`,
+}
+
+// sqliteMigrations alter tables created by sqliteSchema. They run once
+// each, in order, and PRAGMA user_version records how many were applied.
+var sqliteMigrations = []string{
+	`ALTER TABLE status_checks ADD COLUMN name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE status_checks ADD COLUMN group_name TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE status_checks ADD COLUMN headers TEXT NOT NULL DEFAULT '{}'`,    // json object
+	`ALTER TABLE status_checks ADD COLUMN assertions TEXT NOT NULL DEFAULT '[]'`, // json array
+	`ALTER TABLE status_checks ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'`,       // json array
+	`ALTER TABLE check_results ADD COLUMN assertion_failed BOOLEAN NOT NULL DEFAULT 0`,
+	`ALTER TABLE status_checks ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE check_results ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE check_rollups_hourly ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE check_rollups_daily ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE api_tokens ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+}
+
+func init() {
+	// check ids are unique per tenant, sqlite can only change a primary
+	// key by copying the table
+	sqliteMigrations = append(sqliteMigrations, sqliteRebuild("status_checks", statusCheckColumns, `
+		id                   TEXT NOT NULL,
+		url                  TEXT NOT NULL,
+		interval_seconds     INTEGER NOT NULL,
+		http_timeout_seconds INTEGER NOT NULL,
+		regions              TEXT NOT NULL DEFAULT '[]',
+		modified             TIMESTAMP NOT NULL,
+		serial               INTEGER NOT NULL DEFAULT 0,
+		active               BOOLEAN NOT NULL DEFAULT 1,
+		name                 TEXT NOT NULL DEFAULT '',
+		group_name           TEXT NOT NULL DEFAULT '',
+		headers              TEXT NOT NULL DEFAULT '{}',
+		assertions           TEXT NOT NULL DEFAULT '[]',
+		tags                 TEXT NOT NULL DEFAULT '[]',
+		tenant               TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (tenant, id)`)...)
+	for _, period := range checks.RollupPeriods {
+		sqliteMigrations = append(sqliteMigrations, sqliteRebuild(rollupTable(period), strings.Join(rollupColumns, ", "), `
+		region           TEXT NOT NULL,
+		check_id         TEXT NOT NULL,
+		timestamp        TIMESTAMP NOT NULL,
+		count            INTEGER NOT NULL,
+		failures         INTEGER NOT NULL,
+		uptime_percent   REAL NOT NULL,
+		firstbyte_p50_ms INTEGER NOT NULL,
+		firstbyte_p95_ms INTEGER NOT NULL,
+		firstbyte_p99_ms INTEGER NOT NULL,
+		connect_p50_ms   INTEGER NOT NULL,
+		connect_p95_ms   INTEGER NOT NULL,
+		connect_p99_ms   INTEGER NOT NULL,
+		tenant           TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (tenant, check_id, region, timestamp)`)...)
+	}
+}
+
+// sqliteRebuild returns the statements that replace table with one
+// created from definition, keeping the rows of columns
+func sqliteRebuild(table string, columns string, definition string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE %s_rebuild (%s)`, table, definition),
+		fmt.Sprintf(`INSERT INTO %s_rebuild (%s) SELECT %s FROM %s`, table, columns, columns, table),
+		fmt.Sprintf(`DROP TABLE %s`, table),
+		fmt.Sprintf(`ALTER TABLE %s_rebuild RENAME TO %s`, table, table),
+	}
+}
+
+// Connect opens the sqlite file named in DB_CONNECTION_STRING, e.g.
+// sqlite://status.db, and creates the schema if needed
+func (db *SQLite) Connect(ctx context.Context) error {
+	connString, err := db.Options.connectionString()
+	if err != nil {
+		return err
+	}
+	path := strings.TrimPrefix(connString, "sqlite://")
+	if path == "" {
+		return errors.New("sqlite connection string has no file path")
+	}
+
+	db.DB, err = sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_time_format=sqlite")
+	if err != nil {
+		return err
+	}
+	// sqlite only supports a single writer
+	db.DB.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(ctx, db.Options.connectTimeout())
+	defer cancel()
+	if err := db.createSchema(ctx); err != nil {
+		db.DB.Close()
+		return err
+	}
+	return db.prune(ctx)
+}
+
+// Migrate creates the schema if needed and deletes expired results
+func (db *SQLite) Migrate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if err := db.createSchema(ctx); err != nil {
+		return err
+	}
+	db.pruneMutex.Lock()
+	db.lastPrune = time.Time{}
+	db.pruneMutex.Unlock()
+	return db.prune(ctx)
+}
+
+// createSchema creates missing tables and applies pending sqliteMigrations
+func (db *SQLite) createSchema(ctx context.Context) error {
+	for _, stmt := range sqliteSchema {
+		if _, err := db.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlite schema creation failed: %w", err)
+		}
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			return fmt.Errorf("sqlite migration %d failed: %w", i+1, err)
+		}
+	}
+	// PRAGMA does not take bind parameters
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRegionChecks returns all checks assigned to a region
+func (db *SQLite) GetRegionChecks(ctx context.Context, region string) (checks.Checks, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "EXISTS (SELECT 1 FROM json_each(status_checks.regions) WHERE value = ?1)", region)
+	statusChecks, err := db.queryStatusChecks(ctx, `
+		SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return checks.Checks{}, err
+	}
+	return checks.Checks{StatusChecks: statusChecks, Region: region}, nil
+}
+
+// ListStatusChecks returns every check
+func (db *SQLite) ListStatusChecks(ctx context.Context) ([]checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "1")
+	return db.queryStatusChecks(ctx, `SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY id`, args...)
+}
+
+// GetStatusCheck returns the check with id
+func (db *SQLite) GetStatusCheck(ctx context.Context, id string) (checks.StatusCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "id = ?1", id)
+	statusChecks, err := db.queryStatusChecks(ctx,
+		`SELECT `+statusCheckColumns+` FROM status_checks WHERE `+where+` ORDER BY tenant LIMIT 1`, args...)
+	if err != nil {
+		return checks.StatusCheck{}, err
+	}
+	if len(statusChecks) == 0 {
+		return checks.StatusCheck{}, ErrNotFound
+	}
+	return statusChecks[0], nil
+}
+
+// CreateStatusCheck inserts a new check
+func (db *SQLite) CreateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	args, err := sqliteStatusCheckArgs(ctx, check)
+	if err != nil {
+		return err
+	}
+	res, err := db.DB.ExecContext(ctx,
+		`INSERT OR IGNORE INTO status_checks (`+statusCheckColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+// UpdateStatusCheck replaces an existing check
+func (db *SQLite) UpdateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	args, err := sqliteStatusCheckArgs(ctx, check)
+	if err != nil {
+		return err
+	}
+	res, err := db.DB.ExecContext(ctx, `
+		UPDATE status_checks
+		SET url = ?2, interval_seconds = ?3, http_timeout_seconds = ?4, regions = ?5,
+		    modified = ?6, serial = ?7, active = ?8, name = ?9, group_name = ?10,
+		    headers = ?11, assertions = ?12, tags = ?13
+		WHERE id = ?1 AND tenant = ?14`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteStatusCheck deletes the check with id
+func (db *SQLite) DeleteStatusCheck(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "id = ?1", id)
+	res, err := db.DB.ExecContext(ctx, `
+		DELETE FROM status_checks
+		WHERE (tenant, id) = (SELECT tenant, id FROM status_checks WHERE `+where+` ORDER BY tenant LIMIT 1)`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SendStatusResults to sqlite. Results with a ResponseID that was already
+// written are skipped. Expired results are pruned at most once an hour.
+func (db *SQLite) SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error) {
+	rows := make([][]interface{}, len(results))
+	for i := range results {
+		rows[i] = resultRow(scopeResult(ctx, results[i]))
+	}
+	inserted, err := db.insertRows(ctx, "check_results", resultColumns, rows)
+	if err != nil {
+		return inserted, err
+	}
+
+	if err := db.prune(ctx); err != nil {
+		return inserted, fmt.Errorf("pruning expired results failed: %w", err)
+	}
+	return inserted, nil
+}
+
+// SendSSLResults to sqlite. Like SendStatusResults duplicates are skipped.
+func (db *SQLite) SendSSLResults(ctx context.Context, results []checks.SSLCheckResult) (int, error) {
+	rows := make([][]interface{}, len(results))
+	for i, r := range results {
+		rows[i] = []interface{}{r.ResponseID, r.ID, r.SSLExpiration.UTC(), r.Valid}
+	}
+	return db.insertRows(ctx, "ssl_check_results",
+		[]string{"response_id", "check_id", "ssl_expiration", "valid"}, rows)
+}
+
+// GetStatusResults returns results matching query ordered by timestamp
+func (db *SQLite) GetStatusResults(ctx context.Context, query ResultQuery) ([]checks.StatusCheckResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := resultQuerySQL(query.scope(ctx), func(int) string { return "?" })
+	rows, err := db.DB.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []checks.StatusCheckResult
+	for rows.Next() {
+		var r checks.StatusCheckResult
+		if err := rows.Scan(resultScanDest(&r)...); err != nil {
+			return nil, err
+		}
+		r.Timestamp = r.Timestamp.UTC()
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SummarizeStatusResults aggregates results matching query into buckets
+func (db *SQLite) SummarizeStatusResults(ctx context.Context, query ResultQuery, bucket time.Duration) ([]checks.StatusCheckSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := summaryQuerySQL(query.scope(ctx), bucket,
+		`(CAST(strftime('%%s', timestamp) AS INTEGER) / %[1]d) * %[1]d`,
+		func(int) string { return "?" })
+	rows, err := db.DB.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []checks.StatusCheckSummary
+	for rows.Next() {
+		s, err := summaryScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// SaveRollups upserts rollups for period and deletes expired buckets
+func (db *SQLite) SaveRollups(ctx context.Context, period checks.RollupPeriod, rollups []checks.StatusCheckRollup) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table := rollupTable(period)
+	stmt, err := tx.PrepareContext(ctx, rollupUpsertSQL(table, func(int) string { return "?" }))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rollups {
+		if tenant, ok := TenantFrom(ctx); ok {
+			r.Metadata.Tenant = tenant
+		}
+		if _, err := stmt.ExecContext(ctx, rollupRow(r)...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE timestamp < ?`,
+		time.Now().UTC().Add(-db.Options.rollupRetention(period))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRollups returns rollups for period matching query ordered by timestamp
+func (db *SQLite) GetRollups(ctx context.Context, period checks.RollupPeriod, query ResultQuery) ([]checks.StatusCheckRollup, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	sql, args := rollupQuerySQL(period, query.scope(ctx), func(int) string { return "?" })
+	rows, err := db.DB.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []checks.StatusCheckRollup
+	for rows.Next() {
+		var r checks.StatusCheckRollup
+		if err := rows.Scan(rollupScanDest(&r)...); err != nil {
+			return nil, err
+		}
+		r.Timestamp = r.Timestamp.UTC()
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// SaveWorker registers a worker or replaces its registration
+func (db *SQLite) SaveWorker(ctx context.Context, worker checks.Worker) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, workerUpsertSQL(func(int) string { return "?" }), workerRow(worker)...)
+	return err
+}
+
+// ListWorkers returns every registered worker ordered by region and id
+func (db *SQLite) ListWorkers(ctx context.Context) ([]checks.Worker, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+strings.Join(workerColumns, ", ")+` FROM workers ORDER BY region, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workers []checks.Worker
+	for rows.Next() {
+		w, err := workerScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+// DeleteWorker removes the worker with id
+func (db *SQLite) DeleteWorker(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	res, err := db.DB.ExecContext(ctx, `DELETE FROM workers WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AcquireLease takes or renews the lease name for holder
+func (db *SQLite) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	now := time.Now().UTC()
+	res, err := db.DB.ExecContext(ctx, `
+		INSERT INTO leases (name, holder, expires) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires <= ?`, name, holder, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ReleaseLease deletes the lease name if holder has it
+func (db *SQLite) ReleaseLease(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
+
+// CreateToken inserts a new token
+func (db *SQLite) CreateToken(ctx context.Context, token auth.Token) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		token.Tenant = tenant
+	}
+	res, err := db.DB.ExecContext(ctx,
+		`INSERT OR IGNORE INTO api_tokens (`+tokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`, tokenRow(token)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+// GetToken returns the token with id
+func (db *SQLite) GetToken(ctx context.Context, id string) (auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "id = ?1", id)
+	token, err := tokenScan(db.DB.QueryRowContext(ctx,
+		`SELECT `+tokenColumns+` FROM api_tokens WHERE `+where, args...).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Token{}, ErrNotFound
+	}
+	return token, err
+}
+
+// ListTokens returns every token ordered by id
+func (db *SQLite) ListTokens(ctx context.Context) ([]auth.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "1")
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []auth.Token
+	for rows.Next() {
+		t, err := tokenScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken removes the token with id
+func (db *SQLite) DeleteToken(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "id = ?1", id)
+	res, err := db.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveTenant creates a tenant or replaces its quotas
+func (db *SQLite) SaveTenant(ctx context.Context, tenant checks.Tenant) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO tenants (name, max_checks, min_interval) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET max_checks = excluded.max_checks, min_interval = excluded.min_interval`,
+		tenant.Name, tenant.MaxChecks, tenant.MinInterval)
+	return err
+}
+
+// GetTenant returns the tenant with name
+func (db *SQLite) GetTenant(ctx context.Context, name string) (checks.Tenant, error) {
+	tenants, err := db.queryTenants(ctx, "name = ?1", name)
+	if err != nil {
+		return checks.Tenant{}, err
+	}
+	if len(tenants) == 0 {
+		return checks.Tenant{}, ErrNotFound
+	}
+	return tenants[0], nil
+}
+
+// ListTenants returns every tenant ordered by name
+func (db *SQLite) ListTenants(ctx context.Context) ([]checks.Tenant, error) {
+	return db.queryTenants(ctx, "1")
+}
+
+// DeleteTenant removes the tenant with name
+func (db *SQLite) DeleteTenant(ctx context.Context, name string) error {
+	if _, ok := TenantFrom(ctx); ok {
+		return ErrTenantScope
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	res, err := db.DB.ExecContext(ctx, `DELETE FROM tenants WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// queryTenants returns the tenants matching condition, a tenant context
+// only sees its own tenant
+func (db *SQLite) queryTenants(ctx context.Context, condition string, args ...interface{}) ([]checks.Tenant, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		args = append(args, tenant)
+		condition += " AND name = ?" + strconv.Itoa(len(args))
+	}
+	rows, err := db.DB.QueryContext(ctx, `SELECT name, max_checks, min_interval FROM tenants WHERE `+condition+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []checks.Tenant
+	for rows.Next() {
+		var t checks.Tenant
+		if err := rows.Scan(&t.Name, &t.MaxChecks, &t.MinInterval); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// Disconnect from sqlite
+func (db *SQLite) Disconnect(_ context.Context) error {
+	return db.DB.Close()
+}
+
+func (db *SQLite) queryStatusChecks(ctx context.Context, query string, args ...interface{}) ([]checks.StatusCheck, error) {
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statusChecks []checks.StatusCheck
+	for rows.Next() {
+		var c checks.StatusCheck
+		var regions, headers, assertions, tags string
+		if err := rows.Scan(&c.ID, &c.URL, &c.Interval, &c.HTTPTimeout, &regions,
+			&c.Modified, &c.Serial, &c.Active, &c.Name, &c.Group, &headers, &assertions, &tags, &c.Tenant); err != nil {
+			return nil, err
+		}
+		for _, column := range []struct {
+			name string
+			json string
+			dest interface{}
+		}{
+			{"regions", regions, &c.Regions},
+			{"headers", headers, &c.Headers},
+			{"assertions", assertions, &c.Assertions},
+			{"tags", tags, &c.Tags},
+		} {
+			if err := json.Unmarshal([]byte(column.json), column.dest); err != nil {
+				return nil, fmt.Errorf("check %s has invalid %s: %w", c.ID, column.name, err)
+			}
+		}
+		normalizeStatusCheck(&c)
+		c.Modified = c.Modified.UTC()
+		statusChecks = append(statusChecks, c)
+	}
+	return statusChecks, rows.Err()
+}
+
+// insertRows inserts rows into table in one transaction, skipping rows
+// whose primary key already exists
+func (db *SQLite) insertRows(ctx context.Context, table string, columns []string, rows [][]interface{}) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		`INSERT OR IGNORE INTO %s (%s) VALUES (?%s)`,
+		table, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1)))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, row := range rows {
+		res, err := stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		inserted += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// prune deletes results older than Options.ResultRetention, at most once per sqlitePruneInterval
+func (db *SQLite) prune(ctx context.Context) error {
+	db.pruneMutex.Lock()
+	defer db.pruneMutex.Unlock()
+	if time.Since(db.lastPrune) < sqlitePruneInterval {
+		return nil
+	}
+	cutoff := time.Now().UTC().Add(-db.Options.resultRetention())
+	if _, err := db.DB.ExecContext(ctx, `DELETE FROM check_results WHERE timestamp < ?`, cutoff); err != nil {
+		return err
+	}
+	db.lastPrune = time.Now()
+	return nil
+}
+
+// SaveSecret creates a secret or replaces its value
+func (db *SQLite) SaveSecret(ctx context.Context, secret checks.Secret) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	if tenant, ok := TenantFrom(ctx); ok {
+		secret.Tenant = tenant
+	}
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO secrets (`+secretColumns+`) VALUES (?, ?, ?, ?)
+		ON CONFLICT (tenant, name) DO UPDATE SET value = excluded.value, modified = excluded.modified`,
+		secret.Tenant, secret.Name, secret.Value, secret.Modified.UTC())
+	return err
+}
+
+// GetSecret returns the secret of tenant with name
+func (db *SQLite) GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error) {
+	secrets, err := db.querySecrets(ctx, "tenant = ?1 AND name = ?2", tenant, name)
+	if err != nil {
+		return checks.Secret{}, err
+	}
+	if len(secrets) == 0 {
+		return checks.Secret{}, ErrNotFound
+	}
+	return secrets[0], nil
+}
+
+// ListSecrets returns every secret ordered by tenant and name
+func (db *SQLite) ListSecrets(ctx context.Context) ([]checks.Secret, error) {
+	return db.querySecrets(ctx, "1")
+}
+
+// DeleteSecret removes the secret of tenant with name
+func (db *SQLite) DeleteSecret(ctx context.Context, tenant string, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.writeTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, "tenant = ?1 AND name = ?2", tenant, name)
+	res, err := db.DB.ExecContext(ctx, `DELETE FROM secrets WHERE `+where, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// querySecrets returns the secrets matching condition, a tenant context
+// only sees its own secrets
+func (db *SQLite) querySecrets(ctx context.Context, condition string, args ...interface{}) ([]checks.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Options.queryTimeout())
+	defer cancel()
+
+	where, args := sqliteTenantWhere(ctx, condition, args...)
+	rows, err := db.DB.QueryContext(ctx, `SELECT `+secretColumns+` FROM secrets WHERE `+where+` ORDER BY tenant, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []checks.Secret
+	for rows.Next() {
+		s, err := secretScan(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, rows.Err()
+}
+
+// sqliteTenantWhere joins condition, which uses args, with the tenant
+// condition of ctx
+func sqliteTenantWhere(ctx context.Context, condition string, args ...interface{}) (string, []interface{}) {
+	tenant, args := tenantCondition(ctx, args, func(n int) string { return "?" + strconv.Itoa(n) })
+	if tenant == "" {
+		return condition, args
+	}
+	return condition + " AND " + tenant, args
+}
+
+// sqliteStatusCheckArgs returns c as values matching statusCheckColumns, a
+// check written with a tenant context belongs to the tenant
+func sqliteStatusCheckArgs(ctx context.Context, c checks.StatusCheck) ([]interface{}, error) {
+	if tenant, ok := TenantFrom(ctx); ok {
+		c.Tenant = tenant
+	}
+	regions := c.Regions
+	if regions == nil {
+		regions = []string{}
+	}
+	headers, assertions, tags := c.Headers, c.Assertions, c.Tags
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if assertions == nil {
+		assertions = []checks.Assertion{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	// regions, headers, assertions and tags are stored as json
+	var encoded [4]string
+	for i, v := range []interface{}{regions, headers, assertions, tags} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = string(b)
+	}
+	return []interface{}{c.ID, c.URL, c.Interval, c.HTTPTimeout, encoded[0],
+		c.Modified.UTC(), int64(c.Serial), c.Active, c.Name, c.Group, encoded[1], encoded[2], encoded[3], c.Tenant}, nil
+}
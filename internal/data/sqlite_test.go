@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+func TestSQLitePrune(t *testing.T) {
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+	db := &SQLite{}
+	ctx := context.Background()
+	if err := db.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Disconnect(ctx)
+
+	now := time.Now().UTC()
+	old := now.Add(-db.Options.resultRetention() - time.Hour)
+	results := []checks.StatusCheckResult{
+		{
+			Metadata:   checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "test-check-1"},
+			Timestamp:  now,
+			ResponseID: checks.NewResponseID("us-test-1", "test-check-1", now),
+		},
+		{
+			Metadata:   checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "test-check-1"},
+			Timestamp:  old,
+			ResponseID: checks.NewResponseID("us-test-1", "test-check-1", old),
+		},
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+	db.lastPrune = time.Time{}
+	if err := db.prune(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.DB.QueryRow(`SELECT count(*) FROM check_results`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("Want 1 result after pruning. Got: %d", count)
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+filepath.Join(t.TempDir(), "status.db"))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		db := &SQLite{}
+		if err := db.Connect(ctx); err != nil {
+			t.Fatalf("Connect %d: %v", i+1, err)
+		}
+		var version int
+		if err := db.DB.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(sqliteMigrations) {
+			t.Fatalf("user_version. Want: %d Got: %d", len(sqliteMigrations), version)
+		}
+		db.Disconnect(ctx)
+	}
+}
+
+// TestSQLiteTenantKeyMigration upgrades a database created while check ids
+// were unique across tenants
+func TestSQLiteTenantKeyMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.db")
+	t.Setenv("DB_CONNECTION_STRING", "sqlite://"+path)
+	ctx := context.Background()
+
+	old, err := sql.Open("sqlite", path+"?_time_format=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const tenantMigrations = 11
+	for _, stmt := range append(sqliteSchema, sqliteMigrations[:tenantMigrations]...) {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	ts := time.Now().UTC().Truncate(time.Hour)
+	for _, stmt := range []string{
+		fmt.Sprintf(`PRAGMA user_version = %d`, tenantMigrations),
+		`INSERT INTO status_checks (id, url, interval_seconds, http_timeout_seconds, modified, tenant)
+			VALUES ('api', 'https://api.example.com', 60, 5, '2024-01-01 00:00:00', 'team-a')`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := old.Exec(`INSERT INTO check_rollups_hourly (`+strings.Join(rollupColumns, ", ")+`)
+		VALUES ('us-test-1', 'api', ?, 1, 0, 100, 0, 0, 0, 0, 0, 0, 'team-a')`, ts); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	db := &SQLite{}
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer db.Disconnect(ctx)
+	if check, err := db.GetStatusCheck(WithTenant(ctx, "team-a"), "api"); err != nil || check.URL != "https://api.example.com" {
+		t.Fatalf("GetStatusCheck. Want: the existing check Got: %+v %v", check, err)
+	}
+	teamB := WithTenant(ctx, "team-b")
+	if err := db.CreateStatusCheck(teamB, checks.StatusCheck{ID: "api", URL: "https://b.example.com"}); err != nil {
+		t.Fatalf("CreateStatusCheck other tenant: %v", err)
+	}
+	rollup := checks.StatusCheckRollup{Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "api"},
+		Timestamp: ts, Count: 2}
+	if err := db.SaveRollups(teamB, checks.RollupHourly, []checks.StatusCheckRollup{rollup}); err != nil {
+		t.Fatalf("SaveRollups: %v", err)
+	}
+	if rollups, err := db.GetRollups(ctx, checks.RollupHourly, ResultQuery{CheckID: "api"}); err != nil || len(rollups) != 2 {
+		t.Fatalf("GetRollups. Want: a rollup of each tenant Got: %+v %v", rollups, err)
+	}
+}
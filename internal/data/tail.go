@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+// TailLag is how far back each TailStatusResults poll looks again. Workers
+// send results in batches, so a result can arrive after newer ones from
+// another region.
+const TailLag = 2 * time.Minute
+
+// TailStatusResults calls send for the results matching query, then polls
+// for new ones every poll interval until ctx is cancelled when follow is
+// set. Every result is sent once.
+//
+// The results are polled because mongo has no change streams on time
+// series collections and the sql backends have no equivalent.
+func TailStatusResults(ctx context.Context, db Database, query ResultQuery, follow bool, poll time.Duration,
+	send func(checks.StatusCheckResult) error) error {
+	start, latest := query.From, query.From
+	seen := make(map[string]time.Time)
+	for {
+		results, err := db.GetStatusResults(ctx, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, result := range results {
+			if _, ok := seen[result.ResponseID]; ok {
+				continue
+			}
+			seen[result.ResponseID] = result.Timestamp
+			if err := send(result); err != nil {
+				return err
+			}
+			if result.Timestamp.After(latest) {
+				latest = result.Timestamp
+			}
+		}
+		if !follow {
+			return nil
+		}
+
+		// look back TailLag for late results and forget older ones
+		query.From = latest.Add(-TailLag)
+		if query.From.Before(start) {
+			query.From = start
+		}
+		for id, timestamp := range seen {
+			if timestamp.Before(query.From) {
+				delete(seen, id)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package data_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/test"
+)
+
+func TestTailStatusResults(t *testing.T) {
+	db := &test.MockDB{}
+	start := time.Now().UTC().Add(-time.Hour)
+	send := func(region string, ts time.Time) {
+		db.SendStatusResults(context.Background(), []checks.StatusCheckResult{{
+			Metadata:   checks.StatusCheckMetadata{Region: region, CheckID: "api"},
+			Timestamp:  ts,
+			ResponseID: checks.NewResponseID(region, "api", ts),
+		}})
+	}
+	send("us-east-1", start.Add(-time.Minute)) // before --since
+	send("us-east-1", start.Add(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan checks.StatusCheckResult, 10)
+	done := make(chan error)
+	go func() {
+		done <- data.TailStatusResults(ctx, db, data.ResultQuery{From: start}, true, time.Millisecond, func(r checks.StatusCheckResult) error {
+			got <- r
+			return nil
+		})
+	}()
+
+	want := func(region string, ts time.Time) {
+		t.Helper()
+		select {
+		case r := <-got:
+			if r.Metadata.Region != region || !r.Timestamp.Equal(ts) {
+				t.Fatalf("result. Want: %s %v Got: %s %v", region, ts, r.Metadata.Region, r.Timestamp)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no result for %s %v", region, ts)
+		}
+	}
+	want("us-east-1", start.Add(time.Minute))
+	send("us-east-1", start.Add(3*time.Minute))
+	want("us-east-1", start.Add(3*time.Minute))
+	// a late result older than the newest one is still shown
+	send("eu-west-1", start.Add(2*time.Minute))
+	want("eu-west-1", start.Add(2*time.Minute))
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-got:
+		t.Fatalf("result written twice: %+v", r)
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"github.com/larntz/status/internal/checks"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context that restricts every Database call made with
+// it to tenant: checks, results, rollups, tokens and tenants of other
+// tenants are neither returned nor changed, and checks and tokens created
+// with it belong to tenant. Workers and leases are shared by all tenants.
+// Without WithTenant calls see every tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant ctx is restricted to by WithTenant
+func TenantFrom(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// ErrTenantScope is returned when a context restricted to a tenant changes
+// tenants, which only an operator can do
+var ErrTenantScope = errors.New("not allowed for a tenant")
+
+// scope restricts q to the tenant of ctx
+func (q ResultQuery) scope(ctx context.Context) ResultQuery {
+	if tenant, ok := TenantFrom(ctx); ok {
+		q.tenant = &tenant
+	}
+	return q
+}
+
+// scopeResult sets the tenant of r to the tenant of ctx, results written
+// with a tenant context belong to the tenant
+func scopeResult(ctx context.Context, r checks.StatusCheckResult) checks.StatusCheckResult {
+	if tenant, ok := TenantFrom(ctx); ok {
+		r.Metadata.Tenant = tenant
+	}
+	return r
+}
+
+// tenantCondition returns the sql condition restricting a query to the
+// tenant of ctx, appending its argument to args. It returns "" when ctx is
+// not restricted.
+func tenantCondition(ctx context.Context, args []interface{}, placeholder func(n int) string) (string, []interface{}) {
+	tenant, ok := TenantFrom(ctx)
+	if !ok {
+		return "", args
+	}
+	args = append(args, tenant)
+	return "tenant = " + placeholder(len(args)), args
+}
+
+// CheckQuota returns a *checks.QuotaError if saving check would exceed the
+// quota of its tenant. A tenant that was never saved has no quota.
+func CheckQuota(ctx context.Context, db Database, check checks.StatusCheck) error {
+	if tenant, ok := TenantFrom(ctx); ok {
+		check.Tenant = tenant
+	}
+	tenant, err := db.GetTenant(ctx, check.Tenant)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	existing, err := db.ListStatusChecks(WithTenant(ctx, check.Tenant))
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, c := range existing {
+		if c.ID != check.ID {
+			count++
+		}
+	}
+	return tenant.CheckQuota(check, count)
+}
@@ -0,0 +1,190 @@
+// Package export writes check results to files for auditors and for moving
+// data between database backends
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// Format is a result file format
+type Format string
+
+// Result formats
+const (
+	CSV       Format = "csv"
+	JSONLines Format = "jsonl"
+	Parquet   Format = "parquet"
+)
+
+// PageSize is how many results are read from the database at a time
+const PageSize = 5000
+
+// ParseFormat returns the format named s. An empty s picks the format from
+// the extension of path, falling back to CSV.
+func ParseFormat(s string, path string) (Format, error) {
+	if s == "" {
+		s = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if s == "" {
+			return CSV, nil
+		}
+	}
+	switch Format(s) {
+	case CSV, JSONLines, Parquet:
+		return Format(s), nil
+	case "json", "ndjson":
+		return JSONLines, nil
+	}
+	return "", fmt.Errorf("unknown result format %q, use csv, jsonl or parquet", s)
+}
+
+// ParseTime accepts RFC3339 or a date such as 2024-01-31 (midnight UTC)
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, use RFC3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// csvHeader is the header row of CSV results
+var csvHeader = []string{"timestamp", "region", "check_id", "response_id", "response_code", "up",
+	"assertion_failed", "firstbyte_ms", "connect_ms", "tls_ms", "dns_ms", "response_info"}
+
+// parquetResult is the Parquet schema of a result
+type parquetResult struct {
+	Timestamp       time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Region          string    `parquet:"region,dict"`
+	CheckID         string    `parquet:"check_id,dict"`
+	ResponseID      string    `parquet:"response_id"`
+	ResponseCode    int32     `parquet:"response_code"`
+	Up              bool      `parquet:"up"`
+	AssertionFailed bool      `parquet:"assertion_failed"`
+	TTFB            int64     `parquet:"firstbyte_ms"`
+	ConnectTiming   int64     `parquet:"connect_ms"`
+	TLSTiming       int64     `parquet:"tls_ms"`
+	DNSTiming       int64     `parquet:"dns_ms"`
+	ResponseInfo    string    `parquet:"response_info"`
+}
+
+// Results writes every result matching query to w in format and returns
+// how many were written. Results are read PageSize at a time, so
+// query.Limit, query.Offset and query.After are ignored.
+func Results(ctx context.Context, db data.Database, query data.ResultQuery, format Format, w io.Writer) (int, error) {
+	var write func([]checks.StatusCheckResult) error
+	var flush func() error
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(results []checks.StatusCheckResult) error {
+			for _, r := range results {
+				if err := writer.Write(csvRecord(r)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case JSONLines:
+		encoder := json.NewEncoder(w)
+		write = func(results []checks.StatusCheckResult) error {
+			for _, r := range results {
+				if err := encoder.Encode(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = func() error { return nil }
+	case Parquet:
+		writer := parquet.NewGenericWriter[parquetResult](w, parquet.Compression(&parquet.Snappy))
+		write = func(results []checks.StatusCheckResult) error {
+			rows := make([]parquetResult, len(results))
+			for i, r := range results {
+				rows[i] = parquetRow(r)
+			}
+			_, err := writer.Write(rows)
+			return err
+		}
+		flush = writer.Close
+	default:
+		return 0, fmt.Errorf("unknown result format %q", format)
+	}
+
+	// page by key, results written during the export do not shift the
+	// pages like they would with an offset
+	count := 0
+	query.Offset, query.After = 0, nil
+	query.Limit = PageSize
+	for {
+		results, err := db.GetStatusResults(ctx, query)
+		if err != nil {
+			return count, err
+		}
+		if err := write(results); err != nil {
+			return count, err
+		}
+		count += len(results)
+		if len(results) < PageSize {
+			break
+		}
+		last := results[len(results)-1]
+		query.After = &data.ResultCursor{Timestamp: last.Timestamp, ResponseID: last.ResponseID}
+	}
+	return count, flush()
+}
+
+func csvRecord(r checks.StatusCheckResult) []string {
+	return []string{
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		r.Metadata.Region,
+		r.Metadata.CheckID,
+		r.ResponseID,
+		strconv.Itoa(r.ResponseCode),
+		strconv.FormatBool(r.Up()),
+		strconv.FormatBool(r.AssertionFailed),
+		strconv.FormatInt(r.TTFB, 10),
+		strconv.FormatInt(r.ConnectTiming, 10),
+		strconv.FormatInt(r.TLSTiming, 10),
+		strconv.FormatInt(r.DNSTiming, 10),
+		r.ResponseInfo,
+	}
+}
+
+func parquetRow(r checks.StatusCheckResult) parquetResult {
+	return parquetResult{
+		Timestamp:       r.Timestamp.UTC(),
+		Region:          r.Metadata.Region,
+		CheckID:         r.Metadata.CheckID,
+		ResponseID:      r.ResponseID,
+		ResponseCode:    int32(r.ResponseCode),
+		Up:              r.Up(),
+		AssertionFailed: r.AssertionFailed,
+		TTFB:            r.TTFB,
+		ConnectTiming:   r.ConnectTiming,
+		TLSTiming:       r.TLSTiming,
+		DNSTiming:       r.DNSTiming,
+		ResponseInfo:    r.ResponseInfo,
+	}
+}
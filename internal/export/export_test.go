@@ -0,0 +1,177 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/test"
+)
+
+func testDB(t *testing.T, start time.Time, count int) *test.MockDB {
+	db := &test.MockDB{}
+	results := make([]checks.StatusCheckResult, count)
+	for i := range results {
+		ts := start.Add(time.Duration(i) * time.Second)
+		results[i] = checks.StatusCheckResult{
+			Metadata:     checks.StatusCheckMetadata{Region: "us-east-1", CheckID: "api"},
+			Timestamp:    ts,
+			ResponseID:   checks.NewResponseID("us-east-1", "api", ts),
+			ResponseCode: 200,
+			TTFB:         int64(i % 100),
+			ResponseInfo: "200 OK",
+		}
+	}
+	results[1].ResponseCode = 503
+	if _, err := db.SendStatusResults(context.Background(), results); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestResults(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// more than one page
+	count := PageSize + 10
+	db := testDB(t, start, count)
+	query := data.ResultQuery{From: start, To: start.Add(24 * time.Hour)}
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Results(context.Background(), db, query, CSV, &buf)
+		if err != nil || n != count {
+			t.Fatalf("Results. Want: %d Got: %d %v", count, n, err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != count+1 {
+			t.Fatalf("rows. Want: %d Got: %d", count+1, len(records))
+		}
+		if records[2][1] != "us-east-1" || records[2][4] != "503" || records[2][5] != "false" {
+			t.Fatalf("second result. Got: %v", records[2])
+		}
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := Results(context.Background(), db, query, JSONLines, &buf); err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(&buf)
+		lines := 0
+		for scanner.Scan() {
+			var r checks.StatusCheckResult
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				t.Fatal(err)
+			}
+			if lines == 0 && (!r.Timestamp.Equal(start) || r.ResponseID != checks.NewResponseID("us-east-1", "api", start)) {
+				t.Fatalf("first result. Got: %+v", r)
+			}
+			lines++
+		}
+		if lines != count {
+			t.Fatalf("lines. Want: %d Got: %d", count, lines)
+		}
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		var buf bytes.Buffer
+		query := query
+		query.To = start.Add(3 * time.Second)
+		if _, err := Results(context.Background(), db, query, Parquet, &buf); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := parquet.Read[parquetResult](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || rows[1].Up || rows[1].ResponseCode != 503 || !rows[2].Timestamp.Equal(start.Add(2*time.Second)) {
+			t.Fatalf("rows. Got: %+v", rows)
+		}
+	})
+}
+
+// writeFunc calls fn before every write to w
+type writeFunc struct {
+	w  *bytes.Buffer
+	fn func()
+}
+
+func (w writeFunc) Write(p []byte) (int, error) {
+	w.fn()
+	return w.w.Write(p)
+}
+
+// TestResultsWhileWriting writes a result that sorts before the next page
+// during the export, every result is still exported once
+func TestResultsWhileWriting(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	count := PageSize + 10
+	db := testDB(t, start, count)
+	query := data.ResultQuery{From: start, To: start.Add(24 * time.Hour)}
+
+	late := checks.StatusCheckResult{
+		Metadata:   checks.StatusCheckMetadata{Region: "us-west-1", CheckID: "api"},
+		Timestamp:  start.Add(time.Second / 2),
+		ResponseID: checks.NewResponseID("us-west-1", "api", start),
+	}
+	var buf bytes.Buffer
+	sent := false
+	w := writeFunc{w: &buf, fn: func() {
+		if !sent {
+			sent = true
+			if _, err := db.SendStatusResults(context.Background(), []checks.StatusCheckResult{late}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}}
+	if _, err := Results(context.Background(), db, query, JSONLines, w); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r checks.StatusCheckResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if seen[r.ResponseID] {
+			t.Fatalf("result %s exported twice", r.ResponseID)
+		}
+		seen[r.ResponseID] = true
+	}
+	if len(seen) != count {
+		t.Fatalf("results. Want: %d Got: %d", count, len(seen))
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		format, path string
+		want         Format
+	}{
+		{"", "", CSV},
+		{"", "audit.parquet", Parquet},
+		{"", "results.JSONL", JSONLines},
+		{"json", "", JSONLines},
+		{"csv", "results.parquet", CSV},
+	}
+	for _, tt := range tests {
+		if got, err := ParseFormat(tt.format, tt.path); err != nil || got != tt.want {
+			t.Fatalf("ParseFormat(%q, %q). Want: %s Got: %s %v", tt.format, tt.path, tt.want, got, err)
+		}
+	}
+	if _, err := ParseFormat("xml", ""); err == nil {
+		t.Fatal("want error for xml")
+	}
+}
@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// staleLock is how old a lock file can be before it is treated as left
+// behind by a process that crashed while holding it
+const staleLock = 10 * time.Second
+
+// FileStore keeps each lease in a JSON file in Dir, so processes on one
+// host can share leases. A lock file guards each update.
+type FileStore struct {
+	Dir string
+}
+
+// AcquireLease takes or renews the lease name for holder
+func (s *FileStore) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	acquired := false
+	err := s.locked(ctx, name, func() error {
+		l, err := s.read(name)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !l.available(holder, now) {
+			return nil
+		}
+		acquired = true
+		return s.write(name, lease{Holder: holder, Expires: now.Add(ttl)})
+	})
+	return acquired, err
+}
+
+// ReleaseLease removes the lease name if holder has it
+func (s *FileStore) ReleaseLease(ctx context.Context, name string, holder string) error {
+	return s.locked(ctx, name, func() error {
+		l, err := s.read(name)
+		if err != nil || l.Holder != holder {
+			return err
+		}
+		return os.Remove(s.path(name, ".lease"))
+	})
+}
+
+// locked runs fn holding the lock file of the lease name
+func (s *FileStore) locked(ctx context.Context, name string, fn func() error) error {
+	lock := s.path(name, ".lock")
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			defer os.Remove(lock)
+			return fn()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// read returns the lease name, the zero lease when there is none
+func (s *FileStore) read(name string) (lease, error) {
+	var l lease
+	b, err := os.ReadFile(s.path(name, ".lease"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	return l, json.Unmarshal(b, &l)
+}
+
+// write replaces the lease name, the rename means readers never see a
+// partial file
+func (s *FileStore) write(name string, l lease) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(name, ".tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(name, ".lease"))
+}
+
+func (s *FileStore) path(name string, ext string) string {
+	return filepath.Join(s.Dir, name+ext)
+}
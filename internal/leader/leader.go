@@ -0,0 +1,98 @@
+// Package leader elects one controller to run singleton duties such as
+// rollups while every replica serves the api
+package leader
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Store holds leases. Every data.Database is a Store, MemoryStore and
+// FileStore are for tests and single host setups.
+type Store interface {
+	// AcquireLease takes the lease name for holder, or renews it, until
+	// ttl from now. It returns false when another holder has a lease that
+	// has not expired.
+	AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease if holder has it so another holder
+	// can take it without waiting for it to expire
+	ReleaseLease(ctx context.Context, name string, holder string) error
+}
+
+// Elector runs a duty while it holds the lease Name
+type Elector struct {
+	Store Store
+	Name  string
+	// ID identifies this replica, it must be unique
+	ID string
+	// TTL is how long the lease lasts without being renewed, it is renewed
+	// three times per TTL
+	TTL time.Duration
+	Log *zap.Logger
+}
+
+// Run runs duty whenever the elector holds the lease, until ctx is
+// cancelled. duty's context is cancelled when the lease is lost and Run
+// waits for duty to return before another attempt to take the lease. The
+// lease is released when ctx is cancelled.
+func (e *Elector) Run(ctx context.Context, duty func(ctx context.Context)) {
+	ticker := time.NewTicker(e.TTL / 3)
+	defer ticker.Stop()
+	log := e.Log.With(zap.String("lease", e.Name), zap.String("holder", e.ID))
+
+	var stop context.CancelFunc
+	var done chan struct{}
+	var renewed time.Time
+	stepDown := func() {
+		stop()
+		<-done
+		stop, done = nil, nil
+	}
+	for {
+		attempt := time.Now()
+		acquired, err := e.Store.AcquireLease(ctx, e.Name, e.ID, e.TTL)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			log.Error("AcquireLease failed.", zap.String("error", err.Error()))
+			// another replica can take the lease once it expires, stop
+			// before then
+			if stop != nil && time.Since(renewed) > e.TTL/2 {
+				log.Warn("Lost leadership, the lease could not be renewed")
+				stepDown()
+			}
+		case acquired && stop == nil:
+			log.Info("Became leader")
+			var dutyCtx context.Context
+			dutyCtx, stop = context.WithCancel(ctx)
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				duty(dutyCtx)
+			}()
+			renewed = attempt
+		case acquired:
+			renewed = attempt
+		case stop != nil:
+			log.Warn("Lost leadership, the lease is held by another replica")
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stepDown()
+				release, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.Store.ReleaseLease(release, e.Name, e.ID); err != nil {
+					log.Error("ReleaseLease failed.", zap.String("error", err.Error()))
+				}
+				cancel()
+				log.Info("Released leadership")
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
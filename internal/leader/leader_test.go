@@ -0,0 +1,114 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestStores(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	memory := &MemoryStore{Now: func() time.Time { return now }}
+	dir := t.TempDir()
+	stores := map[string][2]Store{
+		// two processes sharing a directory
+		"file":   {&FileStore{Dir: dir}, &FileStore{Dir: dir}},
+		"memory": {memory, memory},
+	}
+	for name, s := range stores {
+		ctx := context.Background()
+		acquire := func(store Store, holder string, ttl time.Duration, want bool) {
+			t.Helper()
+			got, err := store.AcquireLease(ctx, "rollups", holder, ttl)
+			if err != nil || got != want {
+				t.Fatalf("%s: AcquireLease for %s. Want: %t Got: %t %v", name, holder, want, got, err)
+			}
+		}
+		acquire(s[0], "a", time.Minute, true)
+		acquire(s[1], "b", time.Minute, false)
+		acquire(s[0], "a", time.Minute, true)
+		s[1].ReleaseLease(ctx, "rollups", "b")
+		acquire(s[1], "b", time.Minute, false)
+		s[0].ReleaseLease(ctx, "rollups", "a")
+		acquire(s[1], "b", time.Millisecond, true)
+		if name == "memory" {
+			now = now.Add(time.Second)
+		} else {
+			time.Sleep(5 * time.Millisecond)
+		}
+		acquire(s[0], "a", time.Minute, true)
+	}
+}
+
+func TestElector(t *testing.T) {
+	store := &MemoryStore{}
+	var mu sync.Mutex
+	leading := make(map[string]bool)
+	maxLeaders, runs := 0, 0
+	duty := func(id string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			mu.Lock()
+			leading[id] = true
+			runs++
+			maxLeaders = max(maxLeaders, len(leading))
+			mu.Unlock()
+			<-ctx.Done()
+			mu.Lock()
+			delete(leading, id)
+			mu.Unlock()
+		}
+	}
+	current := func() (string, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for id := range leading {
+			return id, runs
+		}
+		return "", runs
+	}
+
+	cancels := make(map[string]context.CancelFunc)
+	done := make(map[string]chan struct{})
+	for _, id := range []string{"a", "b", "c"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancels[id], done[id] = cancel, make(chan struct{})
+		e := &Elector{Store: store, Name: "rollups", ID: id, TTL: 30 * time.Millisecond, Log: zap.NewNop()}
+		go func(id string) {
+			e.Run(ctx, duty(id))
+			close(done[id])
+		}(id)
+	}
+
+	waitForLeader := func(runs int) string {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(time.Millisecond) {
+			if id, n := current(); id != "" && n == runs {
+				return id
+			}
+		}
+		t.Fatalf("no leader after %d runs", runs)
+		return ""
+	}
+	first := waitForLeader(1)
+	time.Sleep(100 * time.Millisecond)
+	if id, _ := current(); id != first {
+		t.Fatalf("leader changed while renewing. Want: %s Got: %s", first, id)
+	}
+
+	// the leader releases the lease when it stops and another takes over
+	cancels[first]()
+	<-done[first]
+	second := waitForLeader(2)
+	if second == first {
+		t.Fatalf("stopped replica %s is still leading", first)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxLeaders != 1 {
+		t.Fatalf("leaders at once. Want: 1 Got: %d", maxLeaders)
+	}
+}
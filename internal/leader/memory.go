@@ -0,0 +1,60 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lease is held by holder until expires
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// available reports whether holder can take l at now
+func (l lease) available(holder string, now time.Time) bool {
+	return l.Holder == "" || l.Holder == holder || !now.Before(l.Expires)
+}
+
+// MemoryStore keeps leases in memory, it is shared by electors in one
+// process
+type MemoryStore struct {
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]lease
+}
+
+// AcquireLease takes or renews the lease name for holder
+func (s *MemoryStore) AcquireLease(_ context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !s.leases[name].available(holder, now) {
+		return false, nil
+	}
+	if s.leases == nil {
+		s.leases = make(map[string]lease)
+	}
+	s.leases[name] = lease{Holder: holder, Expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease removes the lease name if holder has it
+func (s *MemoryStore) ReleaseLease(_ context.Context, name string, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leases[name].Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+func (s *MemoryStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
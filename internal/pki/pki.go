@@ -0,0 +1,218 @@
+// Package pki issues the certificates workers and the controller use for
+// mutual TLS. Worker certificates carry the worker's region so the
+// controller only serves a worker its own region's checks.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// regionURN prefixes the URI SAN holding a worker's region, e.g.
+// urn:status:region:us-east-1
+const regionURN = "urn:status:region:"
+
+// CA signs worker and controller certificates
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewCA returns a self-signed CA valid from now for validity
+func NewCA(name string, now time.Time, validity time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newTemplate(name, now, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// LoadCA reads a CA written by WriteFiles
+func LoadCA(certFile string, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// IssueWorker returns a client certificate for a worker in region
+func (ca *CA) IssueWorker(name string, region string, now time.Time, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	if region == "" || strings.ContainsAny(region, " /?#") {
+		return nil, nil, fmt.Errorf("invalid region %q", region)
+	}
+	u, err := url.Parse(regionURN + region)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca.issue(name, now, validity, func(t *x509.Certificate) {
+		t.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		t.URIs = []*url.URL{u}
+	})
+}
+
+// IssueServer returns a server certificate for the controller reachable at
+// hosts, which are dns names or ip addresses
+func (ca *CA) IssueServer(hosts []string, now time.Time, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("at least one host is required")
+	}
+	return ca.issue(hosts[0], now, validity, func(t *x509.Certificate) {
+		t.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				t.IPAddresses = append(t.IPAddresses, ip)
+			} else {
+				t.DNSNames = append(t.DNSNames, h)
+			}
+		}
+	})
+}
+
+func (ca *CA) issue(name string, now time.Time, validity time.Duration, setup func(t *x509.Certificate)) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(name, now, validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	setup(template)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// newTemplate returns a certificate template with a random serial number,
+// backdated a minute for clock skew
+func newTemplate(name string, now time.Time, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"status"}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+// WorkerRegion returns the region of a worker certificate
+func WorkerRegion(cert *x509.Certificate) (string, bool) {
+	for _, u := range cert.URIs {
+		if region, ok := strings.CutPrefix(u.String(), regionURN); ok && region != "" {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// WriteFiles writes cert and key PEM encoded, the key readable only by
+// the owner
+func WriteFiles(cert *x509.Certificate, key crypto.Signer, certFile string, keyFile string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644)
+}
+
+// ServerConfig returns the controller's TLS config. When clientCAFile is
+// set, client certificates signed by it are verified and available to
+// handlers. Clients without one, such as browsers on the status page, can
+// still connect.
+func ServerConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		if cfg.ClientCAs, err = loadPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// ClientConfig returns the worker's TLS config for the controller. caFile
+// replaces the system roots when set, certFile and keyFile are the
+// worker's client certificate when set.
+func ClientConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,57 @@
+package pki
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	now := time.Now()
+	ca, err := NewCA("test CA", now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := WriteFiles(ca.Cert, ca.Key, filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")); err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	worker, _, err := ca.IssueWorker("worker-1", "us-east-1", now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worker.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("worker certificate: %v", err)
+	}
+	if region, ok := WorkerRegion(worker); !ok || region != "us-east-1" {
+		t.Fatalf("WorkerRegion. Want: us-east-1 Got: %q %t", region, ok)
+	}
+	if _, _, err := ca.IssueWorker("worker-2", "us east", now, time.Hour); err == nil {
+		t.Fatal("IssueWorker accepted an invalid region")
+	}
+
+	server, _, err := ca.IssueServer([]string{"status.example.com", "10.0.0.5"}, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Verify(x509.VerifyOptions{Roots: roots, DNSName: "10.0.0.5"}); err != nil {
+		t.Fatalf("server certificate: %v", err)
+	}
+	if _, ok := WorkerRegion(server); ok {
+		t.Fatal("server certificate has a region")
+	}
+
+	// a worker certificate from another CA is not trusted
+	other, _ := NewCA("other CA", now, time.Hour)
+	forged, _, _ := other.IssueWorker("worker-1", "us-east-1", now, time.Hour)
+	if _, err := forged.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err == nil {
+		t.Fatal("certificate from another CA verified")
+	}
+}
@@ -0,0 +1,191 @@
+// Package rollup aggregates raw check results into hourly and daily buckets
+// so uptime history outlives the raw result retention
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// bucketKey groups results into a rollup
+type bucketKey struct {
+	checks.StatusCheckMetadata
+	timestamp time.Time
+}
+
+// Compute aggregates results into period buckets per check and region.
+// Rollups are ordered by timestamp, check and region.
+func Compute(results []checks.StatusCheckResult, period checks.RollupPeriod) []checks.StatusCheckRollup {
+	buckets := make(map[bucketKey][]checks.StatusCheckResult)
+	for _, r := range results {
+		key := bucketKey{r.Metadata, r.Timestamp.UTC().Truncate(period.Duration())}
+		buckets[key] = append(buckets[key], r)
+	}
+
+	rollups := make([]checks.StatusCheckRollup, 0, len(buckets))
+	for key, bucket := range buckets {
+		rollups = append(rollups, aggregate(key, bucket))
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Metadata.CheckID != b.Metadata.CheckID {
+			return a.Metadata.CheckID < b.Metadata.CheckID
+		}
+		return a.Metadata.Region < b.Metadata.Region
+	})
+	return rollups
+}
+
+func aggregate(key bucketKey, results []checks.StatusCheckResult) checks.StatusCheckRollup {
+	rollup := checks.StatusCheckRollup{
+		Metadata:  key.StatusCheckMetadata,
+		Timestamp: key.timestamp,
+		Count:     int64(len(results)),
+	}
+	var ttfb, connect []int64
+	for _, r := range results {
+		if !r.Up() {
+			rollup.Failures++
+		}
+		// only results that got a response have timings
+		if r.ResponseCode != 0 {
+			ttfb = append(ttfb, r.TTFB)
+			connect = append(connect, r.ConnectTiming)
+		}
+	}
+	rollup.UptimePercent = checks.UptimePercent(rollup.Count, rollup.Failures)
+
+	sort.Slice(ttfb, func(i, j int) bool { return ttfb[i] < ttfb[j] })
+	sort.Slice(connect, func(i, j int) bool { return connect[i] < connect[j] })
+	rollup.TTFBP50, rollup.TTFBP95, rollup.TTFBP99 = percentile(ttfb, 50), percentile(ttfb, 95), percentile(ttfb, 99)
+	rollup.ConnectP50, rollup.ConnectP95, rollup.ConnectP99 = percentile(connect, 50), percentile(connect, 95), percentile(connect, 99)
+	return rollup
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Run computes the hourly and daily rollups of every check for the buckets
+// between lookback before now and now, and saves them. The window is
+// widened to the start of the first day so daily buckets are complete.
+// Buckets are recomputed from raw results so it is safe to repeat.
+func Run(ctx context.Context, db data.Database, now time.Time, lookback time.Duration, log *zap.Logger) error {
+	now = now.UTC()
+	from := now.Add(-lookback).Truncate(checks.RollupDaily.Duration())
+
+	statusChecks, err := db.ListStatusChecks(ctx)
+	if err != nil {
+		return fmt.Errorf("ListStatusChecks failed: %w", err)
+	}
+
+	var errs []error
+	saved := 0
+	for _, c := range statusChecks {
+		results, err := db.GetStatusResults(ctx, data.ResultQuery{CheckID: c.ID, From: from, To: now})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("GetStatusResults for %s failed: %w", c.ID, err))
+			continue
+		}
+		for _, period := range checks.RollupPeriods {
+			rollups := Compute(results, period)
+			if err := db.SaveRollups(ctx, period, rollups); err != nil {
+				errs = append(errs, fmt.Errorf("SaveRollups %s for %s failed: %w", period, c.ID, err))
+				continue
+			}
+			saved += len(rollups)
+		}
+	}
+	log.Info("rollup", zap.Int("check_count", len(statusChecks)), zap.Int("saved_rollups", saved),
+		zap.Time("from", from), zap.Time("to", now), zap.Int("errors", len(errs)))
+	return errors.Join(errs...)
+}
+
+// Schedule runs Run every interval until ctx is cancelled
+func Schedule(ctx context.Context, db data.Database, interval time.Duration, lookback time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := Run(ctx, db, time.Now(), lookback, log); err != nil {
+			log.Error("rollup failed", zap.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Uptime returns the uptime of query.CheckID between query.From and
+// query.To, optionally limited to query.Region. Completed hourly rollups,
+// or daily rollups for windows longer than a month, cover history beyond
+// the raw result retention. The latest rollup may have been computed
+// before its bucket ended so raw results are counted from its start.
+func Uptime(ctx context.Context, db data.Database, query data.ResultQuery) (checks.Uptime, error) {
+	uptime := checks.Uptime{CheckID: query.CheckID, Region: query.Region, From: query.From, To: query.To}
+	period := checks.RollupHourly
+	if query.To.Sub(query.From) > 31*24*time.Hour {
+		period = checks.RollupDaily
+	}
+
+	rollups, err := db.GetRollups(ctx, period, data.ResultQuery{
+		CheckID: query.CheckID,
+		Region:  query.Region,
+		From:    query.From.UTC().Truncate(period.Duration()),
+		To:      query.To,
+	})
+	if err != nil {
+		return uptime, fmt.Errorf("GetRollups failed: %w", err)
+	}
+	// every region's rollup of the latest bucket is replaced by the raw
+	// results from its start
+	rawFrom := query.From
+	for _, r := range rollups {
+		if r.Timestamp.After(rawFrom) {
+			rawFrom = r.Timestamp
+		}
+	}
+	for _, r := range rollups {
+		if r.Timestamp.Before(rawFrom) {
+			uptime.Count += r.Count
+			uptime.Failures += r.Failures
+		}
+	}
+
+	summaries, err := db.SummarizeStatusResults(ctx, data.ResultQuery{
+		CheckID: query.CheckID,
+		Region:  query.Region,
+		From:    rawFrom,
+		To:      query.To,
+	}, period.Duration())
+	if err != nil {
+		return uptime, fmt.Errorf("SummarizeStatusResults failed: %w", err)
+	}
+	for _, s := range summaries {
+		uptime.Count += s.Count
+		uptime.Failures += s.Failures
+	}
+	uptime.UptimePercent = checks.UptimePercent(uptime.Count, uptime.Failures)
+	return uptime, nil
+}
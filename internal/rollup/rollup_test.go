@@ -0,0 +1,180 @@
+package rollup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/test"
+)
+
+func testResult(checkID string, region string, ts time.Time, code int, ttfb int64) checks.StatusCheckResult {
+	return checks.StatusCheckResult{
+		Metadata:      checks.StatusCheckMetadata{Region: region, CheckID: checkID},
+		Timestamp:     ts,
+		ResponseID:    checks.NewResponseID(region, checkID, ts),
+		ResponseCode:  code,
+		TTFB:          ttfb,
+		ConnectTiming: ttfb / 10,
+	}
+}
+
+func TestCompute(t *testing.T) {
+	start := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	var results []checks.StatusCheckResult
+	// 100 results in the first hour, ttfb 1..100ms, two failures
+	for i := 1; i <= 100; i++ {
+		code := 200
+		switch i {
+		case 50:
+			code = 503
+		case 51:
+			code = 0 // connection error, no timings
+		}
+		results = append(results, testResult("test-check-1", "us-test-1", start.Add(time.Duration(i)*time.Second), code, int64(i)))
+	}
+	// one result in the next hour and one in another region
+	results = append(results,
+		testResult("test-check-1", "us-test-1", start.Add(time.Hour), 200, 5),
+		testResult("test-check-1", "us-test-2", start, 200, 5))
+
+	hourly := Compute(results, checks.RollupHourly)
+	if len(hourly) != 3 {
+		t.Fatalf("hourly rollups. Want: 3 Got: %d", len(hourly))
+	}
+	r := hourly[0]
+	if r.Metadata.Region != "us-test-1" || !r.Timestamp.Equal(start) {
+		t.Fatalf("first rollup. Want: us-test-1 at %v Got: %+v", start, r)
+	}
+	if r.Count != 100 || r.Failures != 2 || r.UptimePercent != 98 {
+		t.Fatalf("counts. Want: 100, 2, 98%% Got: %d, %d, %v%%", r.Count, r.Failures, r.UptimePercent)
+	}
+	// 99 timed results: 1..50 and 52..100
+	if r.TTFBP50 != 50 || r.TTFBP95 != 96 || r.TTFBP99 != 100 {
+		t.Fatalf("ttfb percentiles. Want: 50, 96, 100 Got: %d, %d, %d", r.TTFBP50, r.TTFBP95, r.TTFBP99)
+	}
+
+	daily := Compute(results, checks.RollupDaily)
+	if len(daily) != 2 {
+		t.Fatalf("daily rollups. Want: 2 Got: %d", len(daily))
+	}
+	if daily[0].Count != 101 || !daily[0].Timestamp.Equal(start.Truncate(24*time.Hour)) {
+		t.Fatalf("daily rollup. Want: 101 results at %v Got: %+v", start.Truncate(24*time.Hour), daily[0])
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db := &test.MockDB{}
+	now := time.Date(2023, 3, 2, 0, 30, 0, 0, time.UTC)
+	if err := db.CreateStatusCheck(ctx, checks.StatusCheck{ID: "test-check-1", Regions: []string{"us-test-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	var results []checks.StatusCheckResult
+	for i := 0; i < 4; i++ {
+		results = append(results, testResult("test-check-1", "us-test-1", now.Add(-time.Duration(i)*time.Hour-time.Minute), 200, 10))
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+
+	// an hour of lookback still covers all of the previous day
+	if err := Run(ctx, db, now, time.Hour, zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+	hourly, _ := db.GetRollups(ctx, checks.RollupHourly, data.ResultQuery{})
+	if len(hourly) != 4 {
+		t.Fatalf("hourly rollups. Want: 4 Got: %d", len(hourly))
+	}
+	daily, _ := db.GetRollups(ctx, checks.RollupDaily, data.ResultQuery{})
+	if len(daily) != 2 || daily[0].Count != 3 || daily[1].Count != 1 {
+		t.Fatalf("daily rollups. Want: 3 then 1 results Got: %+v", daily)
+	}
+}
+
+func TestUptime(t *testing.T) {
+	ctx := context.Background()
+	db := &test.MockDB{}
+	now := time.Date(2023, 3, 2, 12, 30, 0, 0, time.UTC)
+
+	// a day of hourly rollups with one failure each, the latest partial
+	var rollups []checks.StatusCheckRollup
+	for i := 1; i <= 24; i++ {
+		rollups = append(rollups, checks.StatusCheckRollup{
+			Metadata:  checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "test-check-1"},
+			Timestamp: now.Truncate(time.Hour).Add(-time.Duration(24-i) * time.Hour),
+			Count:     10,
+			Failures:  1,
+		})
+	}
+	if err := db.SaveRollups(ctx, checks.RollupHourly, rollups); err != nil {
+		t.Fatal(err)
+	}
+	// raw results for the latest hour replace its partial rollup
+	results := []checks.StatusCheckResult{
+		testResult("test-check-1", "us-test-1", now.Truncate(time.Hour), 200, 10),
+		testResult("test-check-1", "us-test-1", now.Add(-time.Minute), 500, 10),
+		testResult("test-check-1", "us-test-1", now.Add(-2*time.Hour), 500, 10),
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Uptime(ctx, db, data.ResultQuery{CheckID: "test-check-1", From: now.Add(-7 * 24 * time.Hour), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 232 || got.Failures != 24 {
+		t.Fatalf("Uptime. Want: 232 results, 24 failures Got: %d, %d", got.Count, got.Failures)
+	}
+
+	got, err = Uptime(ctx, db, data.ResultQuery{CheckID: "test-check-2", From: now.Add(-time.Hour), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 0 || got.UptimePercent != 0 {
+		t.Fatalf("Uptime without results. Want: 0 Got: %+v", got)
+	}
+}
+
+func TestUptimeRegions(t *testing.T) {
+	ctx := context.Background()
+	db := &test.MockDB{}
+	now := time.Date(2023, 3, 2, 12, 30, 0, 0, time.UTC)
+
+	// both regions have a partial rollup of the latest hour and a complete
+	// one of the hour before
+	var rollups []checks.StatusCheckRollup
+	for _, region := range []string{"us-test-1", "us-test-2"} {
+		for _, ts := range []time.Time{now.Truncate(time.Hour).Add(-time.Hour), now.Truncate(time.Hour)} {
+			rollups = append(rollups, checks.StatusCheckRollup{
+				Metadata:  checks.StatusCheckMetadata{Region: region, CheckID: "test-check-1"},
+				Timestamp: ts,
+				Count:     10,
+				Failures:  1,
+			})
+		}
+	}
+	if err := db.SaveRollups(ctx, checks.RollupHourly, rollups); err != nil {
+		t.Fatal(err)
+	}
+	results := []checks.StatusCheckResult{
+		testResult("test-check-1", "us-test-1", now.Add(-time.Minute), 200, 10),
+		testResult("test-check-1", "us-test-2", now.Add(-time.Minute), 500, 10),
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Uptime(ctx, db, data.ResultQuery{CheckID: "test-check-1", From: now.Add(-24 * time.Hour), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 22 || got.Failures != 3 {
+		t.Fatalf("Uptime. Want: 22 results, 3 failures Got: %d, %d", got.Count, got.Failures)
+	}
+}
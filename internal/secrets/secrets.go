@@ -0,0 +1,213 @@
+// Package secrets seals the secrets stored in the database and resolves
+// the ${secret:name} references of checks on the worker. A secret comes
+// from a STATUS_SECRET_<NAME> environment variable, a file in the secrets
+// directory or the database, where its value is encrypted with a key only
+// the workers and the operator have.
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// KeySize is the length of a key, it is an AES-256 key
+const KeySize = 32
+
+// EnvPrefix prefixes the environment variables holding secrets, the
+// secret api-key is STATUS_SECRET_API_KEY
+const EnvPrefix = "STATUS_SECRET_"
+
+// ErrNotFound is returned when no source has a referenced secret
+var ErrNotFound = errors.New("secret not found")
+
+// NewKey returns a random key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WriteKey writes key base64 encoded to a new file only the owner can read
+func WriteKey(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadKey reads a key written by WriteKey
+func LoadKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("%s is not a secret key", path)
+	}
+	return key, nil
+}
+
+// Seal encrypts value as secret.Value. The tenant and name are
+// authenticated so a sealed value can not be copied to another secret.
+func Seal(key []byte, secret checks.Secret, value string) (checks.Secret, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return secret, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return secret, err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), additionalData(secret))
+	secret.Value = base64.StdEncoding.EncodeToString(sealed)
+	return secret, nil
+}
+
+// Open decrypts the value of a secret sealed with key
+func Open(key []byte, secret checks.Secret) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(secret.Value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is not sealed", secret.Name)
+	}
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData(secret))
+	if err != nil {
+		return "", fmt.Errorf("secret %s can not be opened with this key", secret.Name)
+	}
+	return string(value), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(secret checks.Secret) []byte {
+	return []byte(secret.Tenant + "/" + secret.Name)
+}
+
+// EnvName returns the environment variable of the secret name
+func EnvName(name string) string {
+	return EnvPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Store looks up sealed secrets, a data.Database or the controller for
+// workers without a database connection
+type Store interface {
+	// GetSecret returns data.ErrNotFound if tenant has no secret with name
+	GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error)
+}
+
+// Resolver resolves the secret references of checks. Environment
+// variables and Dir belong to the operator, only checks of the default
+// tenant can use them. A tenant's checks only use the tenant's secrets in
+// DB.
+type Resolver struct {
+	// Dir holds a file named after each secret, "" for none
+	Dir string
+	// DB and Key look up secrets saved with status secret set, DB is not
+	// used when Key is nil
+	DB  Store
+	Key []byte
+	// LookupEnv looks up environment variables, os.LookupEnv when nil
+	LookupEnv func(string) (string, bool)
+}
+
+// Resolve returns a copy of check with the secret references of its url
+// and header values replaced. Errors do not contain secret values.
+func (r *Resolver) Resolve(ctx context.Context, check checks.StatusCheck) (checks.StatusCheck, error) {
+	if !check.HasSecrets() {
+		return check, nil
+	}
+	lookup := func(name string) (string, error) {
+		value, err := r.lookup(ctx, check.Tenant, name)
+		if err != nil {
+			return "", fmt.Errorf("check %s: %w", check.ID, err)
+		}
+		return value, nil
+	}
+	var err error
+	if check.URL, err = checks.ExpandSecrets(check.URL, lookup); err != nil {
+		return check, err
+	}
+	if _, err := url.Parse(check.URL); err != nil {
+		return check, fmt.Errorf("check %s: url is invalid after resolving its secrets", check.ID)
+	}
+	headers := make(map[string]string, len(check.Headers))
+	for name, value := range check.Headers {
+		if headers[name], err = checks.ExpandSecrets(value, lookup); err != nil {
+			return check, err
+		}
+	}
+	check.Headers = headers
+	return check, nil
+}
+
+// lookup returns the value of tenant's secret name
+func (r *Resolver) lookup(ctx context.Context, tenant string, name string) (string, error) {
+	if err := checks.ValidSecretName(name); err != nil {
+		return "", err
+	}
+	if tenant == "" {
+		lookupEnv := r.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+		if value, ok := lookupEnv(EnvName(name)); ok {
+			return value, nil
+		}
+		if r.Dir != "" {
+			b, err := os.ReadFile(filepath.Join(r.Dir, name))
+			if err == nil {
+				return strings.TrimRight(string(b), "\r\n"), nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("secret %s: %w", name, err)
+			}
+		}
+	}
+	if r.DB != nil && r.Key != nil {
+		secret, err := r.DB.GetSecret(ctx, tenant, name)
+		if err == nil {
+			return Open(r.Key, secret)
+		}
+		if !errors.Is(err, data.ErrNotFound) {
+			return "", fmt.Errorf("secret %s: %w", name, err)
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
@@ -0,0 +1,89 @@
+// Package sse reads and writes server-sent events
+package sse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLine is the longest line Read accepts
+const MaxLine = 1 << 20
+
+// Event is a server-sent event
+type Event struct {
+	Type string // the event field, "" is a message event
+	ID   string
+	Data string
+	// Retry is how long the client waits before reconnecting, 0 when the
+	// server did not set it
+	Retry time.Duration
+}
+
+// Write writes e, Data must not contain newlines
+func Write(w io.Writer, e Event) error {
+	var b strings.Builder
+	if e.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Type)
+	}
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", e.Data)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteComment writes a comment, servers send them to keep idle
+// connections open
+func WriteComment(w io.Writer, comment string) error {
+	_, err := fmt.Fprintf(w, ": %s\n\n", comment)
+	return err
+}
+
+// Read calls handle for every event in r until r ends or handle returns an
+// error. Comments are skipped.
+func Read(r io.Reader, handle func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLine)
+	var e Event
+	var data []string
+	pending := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if pending {
+				e.Data = strings.Join(data, "\n")
+				if err := handle(e); err != nil {
+					return err
+				}
+			}
+			e, data, pending = Event{}, nil, false
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			continue // comment
+		case "event":
+			e.Type = value
+		case "id":
+			e.ID = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				e.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+		pending = true
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,35 @@
+package sse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadWrite(t *testing.T) {
+	var b strings.Builder
+	events := []Event{
+		{Type: "result", ID: "1", Data: `{"a": 1}`},
+		{Data: "message", Retry: 1500 * time.Millisecond},
+	}
+	for _, e := range events {
+		if err := Write(&b, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	WriteComment(&b, "keep-alive")
+	b.WriteString("data: two\ndata:lines\n\n")
+
+	var got []Event
+	if err := Read(strings.NewReader(b.String()), func(e Event) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := append(events, Event{Data: "two\nlines"})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events.\nWant: %+v\nGot:  %+v", want, got)
+	}
+}
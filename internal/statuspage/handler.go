@@ -0,0 +1,86 @@
+package statuspage
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/data"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+var pageTemplate = template.Must(template.New("status.html").ParseFS(templateFS, "templates/status.html"))
+
+// DefaultTitle is the page title when Handler.Title is empty
+const DefaultTitle = "status-check"
+
+// Handler serves the status page. The page is rebuilt at most once per
+// CacheTTL, and the previous page is served if a rebuild fails.
+type Handler struct {
+	DB       data.Database
+	Log      *zap.Logger
+	Title    string
+	CacheTTL time.Duration
+	// WorkerTimeout is how long a worker can miss heartbeats before its
+	// region is offline
+	WorkerTimeout time.Duration
+
+	mutex sync.Mutex
+	page  []byte
+	built time.Time
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, err := h.render(r)
+	if err != nil {
+		h.Log.Error("status page failed.", zap.String("error", err.Error()))
+		if page == nil {
+			http.Error(w, "status page unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// render returns the cached page or builds a new one. On error the
+// previous page, if any, is returned with the error.
+func (h *Handler) render(r *http.Request) ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.page != nil && time.Since(h.built) < h.CacheTTL {
+		return h.page, nil
+	}
+
+	page, err := Build(r.Context(), h.DB, time.Now(), h.WorkerTimeout)
+	if err != nil {
+		return h.page, err
+	}
+	page.Title = h.Title
+	if page.Title == "" {
+		page.Title = DefaultTitle
+	}
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, page); err != nil {
+		return h.page, err
+	}
+	h.page, h.built = buf.Bytes(), time.Now()
+	return h.page, nil
+}
+
+// Static serves the embedded stylesheet and images, mount it on /static/
+func Static() http.Handler {
+	sub, _ := fs.Sub(staticFS, "static")
+	return http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+}
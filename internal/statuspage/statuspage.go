@@ -0,0 +1,266 @@
+// Package statuspage builds the public status page served by the controller
+package statuspage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// Days is the number of daily uptime bars shown per check
+const Days = 90
+
+// State is the current state of a check
+type State string
+
+// Check states
+const (
+	StateUp       State = "up"
+	StateDegraded State = "degraded" // failing in some regions
+	StateDown     State = "down"     // failing in every region
+	StateUnknown  State = "unknown"  // no recent results
+)
+
+// CheckState is the current state of a check from the latest result of
+// each region
+type CheckState struct {
+	State State
+	// Failing lists the regions whose latest result failed
+	Failing []string
+	// Since is when the current failure started, zero when up
+	Since time.Time
+	// Offline lists the check's regions that have no live worker, their
+	// results are ignored
+	Offline []string
+}
+
+// Day is the uptime of a check on one day, summed over every region
+type Day struct {
+	Date          time.Time
+	Count         int64
+	Failures      int64
+	UptimePercent float64
+}
+
+// Class returns the css class of the day's uptime bar
+func (d Day) Class() string {
+	switch {
+	case d.Count == 0:
+		return "none"
+	case d.UptimePercent >= 99.9:
+		return "up"
+	case d.UptimePercent >= 95:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+// Label describes the day for the uptime bar tooltip
+func (d Day) Label() string {
+	if d.Count == 0 {
+		return d.Date.Format("Jan 2, 2006") + ": no data"
+	}
+	return fmt.Sprintf("%s: %.2f%% uptime", d.Date.Format("Jan 2, 2006"), d.UptimePercent)
+}
+
+// Check is one check on the status page
+type Check struct {
+	ID    string
+	Name  string
+	State CheckState
+	Days  []Day
+	// UptimePercent over Days, only meaningful when HasData is set
+	UptimePercent float64
+	// HasData is set when Days have any results, a check that was down
+	// for all of them has 0% uptime
+	HasData bool
+}
+
+// Group is a user defined group of checks, Name is empty for checks
+// without a group
+type Group struct {
+	Name   string
+	Checks []Check
+}
+
+// Incident is a check that is currently failing
+type Incident struct {
+	CheckID string
+	Name    string
+	CheckState
+}
+
+// Page is everything shown on the status page
+type Page struct {
+	Title     string
+	Groups    []Group
+	Incidents []Incident
+	Generated time.Time
+}
+
+// Build reads the active checks, their current state and daily uptime
+// from db. Daily uptime comes from the daily rollups. Workers that have
+// not sent a heartbeat within workerTimeout are not live.
+func Build(ctx context.Context, db data.Database, now time.Time, workerTimeout time.Duration) (Page, error) {
+	now = now.UTC()
+	page := Page{Generated: now}
+	statusChecks, err := db.ListStatusChecks(ctx)
+	if err != nil {
+		return page, fmt.Errorf("ListStatusChecks failed: %w", err)
+	}
+	offline, err := OfflineRegions(ctx, db, now, workerTimeout)
+	if err != nil {
+		return page, err
+	}
+
+	first := now.Truncate(24*time.Hour).AddDate(0, 0, -(Days - 1))
+	rollups, err := db.GetRollups(ctx, checks.RollupDaily, data.ResultQuery{From: first, To: now})
+	if err != nil {
+		return page, fmt.Errorf("GetRollups failed: %w", err)
+	}
+	// check id -> day index -> regions summed
+	days := make(map[string][]Day)
+	for _, r := range rollups {
+		i := int(r.Timestamp.Sub(first) / (24 * time.Hour))
+		if i < 0 || i >= Days {
+			continue
+		}
+		if days[r.Metadata.CheckID] == nil {
+			days[r.Metadata.CheckID] = make([]Day, Days)
+		}
+		days[r.Metadata.CheckID][i].Count += r.Count
+		days[r.Metadata.CheckID][i].Failures += r.Failures
+	}
+
+	groups := make(map[string]*Group)
+	for _, c := range statusChecks {
+		if !c.Active {
+			continue
+		}
+		state, err := CurrentState(ctx, db, c, now, offline)
+		if err != nil {
+			return page, err
+		}
+		check := Check{ID: c.ID, Name: c.Name, State: state, Days: days[c.ID]}
+		if check.Name == "" {
+			check.Name = c.ID
+		}
+		if check.Days == nil {
+			check.Days = make([]Day, Days)
+		}
+		var count, failures int64
+		for i := range check.Days {
+			d := &check.Days[i]
+			d.Date = first.AddDate(0, 0, i)
+			d.UptimePercent = checks.UptimePercent(d.Count, d.Failures)
+			count += d.Count
+			failures += d.Failures
+		}
+		check.UptimePercent = checks.UptimePercent(count, failures)
+		check.HasData = count > 0
+
+		if groups[c.Group] == nil {
+			groups[c.Group] = &Group{Name: c.Group}
+		}
+		groups[c.Group].Checks = append(groups[c.Group].Checks, check)
+		if state.State == StateDegraded || state.State == StateDown {
+			page.Incidents = append(page.Incidents, Incident{CheckID: c.ID, Name: check.Name, CheckState: state})
+		}
+	}
+
+	for _, g := range groups {
+		sort.Slice(g.Checks, func(i, j int) bool { return g.Checks[i].Name < g.Checks[j].Name })
+		page.Groups = append(page.Groups, *g)
+	}
+	// checks without a group go last
+	sort.Slice(page.Groups, func(i, j int) bool {
+		a, b := page.Groups[i].Name, page.Groups[j].Name
+		if a == "" || b == "" {
+			return b == ""
+		}
+		return a < b
+	})
+	sort.Slice(page.Incidents, func(i, j int) bool { return page.Incidents[i].Since.Before(page.Incidents[j].Since) })
+	return page, nil
+}
+
+// OfflineRegions returns the regions whose registered workers have all
+// stopped or missed their heartbeats, see checks.OfflineRegions
+func OfflineRegions(ctx context.Context, db data.Database, now time.Time, workerTimeout time.Duration) (map[string]bool, error) {
+	workers, err := db.ListWorkers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListWorkers failed: %w", err)
+	}
+	return checks.OfflineRegions(workers, now, workerTimeout), nil
+}
+
+// CurrentState returns the state of check from the latest result of each
+// of its regions. Results older than three intervals, or five minutes for
+// short intervals, are ignored, as are results from offline regions so a
+// check that is only run by stopped workers is unknown rather than stale.
+func CurrentState(ctx context.Context, db data.Database, check checks.StatusCheck, now time.Time,
+	offline map[string]bool) (CheckState, error) {
+	stale := 3 * time.Duration(check.Interval) * time.Second
+	if stale < 5*time.Minute {
+		stale = 5 * time.Minute
+	}
+	// look back further than stale to find when a failure started
+	lookback := stale
+	if lookback < time.Hour {
+		lookback = time.Hour
+	}
+	results, err := db.GetStatusResults(ctx, data.ResultQuery{CheckID: check.ID, From: now.Add(-lookback), To: now})
+	if err != nil {
+		return CheckState{State: StateUnknown}, fmt.Errorf("GetStatusResults for %s failed: %w", check.ID, err)
+	}
+
+	// results are ordered by timestamp so the last one per region is the latest
+	byRegion := make(map[string][]checks.StatusCheckResult)
+	for _, r := range results {
+		byRegion[r.Metadata.Region] = append(byRegion[r.Metadata.Region], r)
+	}
+	state := CheckState{}
+	for _, region := range check.Regions {
+		if offline[region] {
+			state.Offline = append(state.Offline, region)
+		}
+	}
+	sort.Strings(state.Offline)
+	reporting := 0
+	for region, regionResults := range byRegion {
+		latest := regionResults[len(regionResults)-1]
+		if latest.Timestamp.Before(now.Add(-stale)) || offline[region] {
+			continue
+		}
+		reporting++
+		if latest.Up() {
+			continue
+		}
+		state.Failing = append(state.Failing, region)
+		since := latest.Timestamp
+		for i := len(regionResults) - 1; i >= 0 && !regionResults[i].Up(); i-- {
+			since = regionResults[i].Timestamp
+		}
+		if state.Since.IsZero() || since.Before(state.Since) {
+			state.Since = since
+		}
+	}
+	sort.Strings(state.Failing)
+
+	switch {
+	case reporting == 0:
+		state.State = StateUnknown
+	case len(state.Failing) == 0:
+		state.State = StateUp
+	case len(state.Failing) == reporting:
+		state.State = StateDown
+	default:
+		state.State = StateDegraded
+	}
+	return state, nil
+}
@@ -0,0 +1,188 @@
+package statuspage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/test"
+)
+
+func testResult(checkID string, region string, ts time.Time, code int) checks.StatusCheckResult {
+	return checks.StatusCheckResult{
+		Metadata:     checks.StatusCheckMetadata{Region: region, CheckID: checkID},
+		Timestamp:    ts,
+		ResponseID:   checks.NewResponseID(region, checkID, ts),
+		ResponseCode: code,
+	}
+}
+
+func TestCurrentState(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)
+	db := &test.MockDB{}
+	check := checks.StatusCheck{ID: "test-check-1", Interval: 60, Regions: []string{"us-test-1", "us-test-2", "us-test-3"}}
+	results := []checks.StatusCheckResult{
+		// us-test-1 recovered
+		testResult("test-check-1", "us-test-1", now.Add(-3*time.Minute), 500),
+		testResult("test-check-1", "us-test-1", now.Add(-time.Minute), 200),
+		// us-test-2 failing for two minutes
+		testResult("test-check-1", "us-test-2", now.Add(-4*time.Minute), 200),
+		testResult("test-check-1", "us-test-2", now.Add(-3*time.Minute), 503),
+		testResult("test-check-1", "us-test-2", now.Add(-time.Minute), 0),
+		// us-test-3 stopped reporting
+		testResult("test-check-1", "us-test-3", now.Add(-30*time.Minute), 500),
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		offline map[string]bool
+		want    State
+		failing int
+		since   time.Time
+	}{
+		{"degraded", now, nil, StateDegraded, 1, now.Add(-3 * time.Minute)},
+		{"down", now.Add(-2 * time.Minute), nil, StateDown, 2, now.Add(-3 * time.Minute)},
+		{"up", now.Add(-3*time.Minute - time.Second), nil, StateUp, 0, time.Time{}},
+		{"unknown", now.Add(time.Hour), nil, StateUnknown, 0, time.Time{}},
+		{"failing region offline", now, map[string]bool{"us-test-2": true}, StateUp, 0, time.Time{}},
+		{"every region offline", now, map[string]bool{"us-test-1": true, "us-test-2": true, "us-test-3": true}, StateUnknown, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := CurrentState(ctx, db, check, tt.at, tt.offline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.State != tt.want || len(got.Failing) != tt.failing || !got.Since.Equal(tt.since) || len(got.Offline) != len(tt.offline) {
+			t.Fatalf("%s. Want: %s, %d failing since %v Got: %+v", tt.name, tt.want, tt.failing, tt.since, got)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	db := &test.MockDB{}
+	db.AddCheck(checks.StatusCheck{ID: "api", Name: "API", Group: "Backend", Interval: 60, Active: true})
+	db.AddCheck(checks.StatusCheck{ID: "db", Group: "Backend", Interval: 60, Active: true})
+	db.AddCheck(checks.StatusCheck{ID: "www", Name: "Website", Interval: 60, Active: true})
+	db.AddCheck(checks.StatusCheck{ID: "old", Name: "Retired", Group: "Backend", Interval: 60})
+	db.AddCheck(checks.StatusCheck{ID: "edge", Interval: 60, Active: true, Regions: []string{"eu-test-1"}})
+
+	today := now.Truncate(24 * time.Hour)
+	rollups := []checks.StatusCheckRollup{
+		{Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "api"}, Timestamp: today, Count: 100, Failures: 10},
+		{Metadata: checks.StatusCheckMetadata{Region: "us-test-2", CheckID: "api"}, Timestamp: today, Count: 100},
+		{Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "api"}, Timestamp: today.AddDate(0, 0, -1), Count: 100},
+		// too old to show
+		{Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "api"}, Timestamp: today.AddDate(0, 0, -Days), Count: 100},
+	}
+	if err := db.SaveRollups(ctx, checks.RollupDaily, rollups); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SendStatusResults(ctx, []checks.StatusCheckResult{
+		testResult("api", "us-test-1", now.Add(-time.Minute), 500),
+		testResult("db", "us-test-1", now.Add(-time.Minute), 200),
+		testResult("edge", "eu-test-1", now.Add(-time.Minute), 200),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// eu-test-1's only worker stopped sending heartbeats, us-test-1 has a
+	// live one
+	for _, w := range []checks.Worker{
+		{ID: "eu-1", Region: "eu-test-1", LastSeen: now.Add(-5 * time.Minute)},
+		{ID: "us-1", Region: "us-test-1", LastSeen: now.Add(-10 * time.Minute)},
+		{ID: "us-2", Region: "us-test-1", LastSeen: now},
+	} {
+		db.SaveWorker(ctx, w)
+	}
+
+	page, err := Build(ctx, db, now, 3*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Groups) != 2 || page.Groups[0].Name != "Backend" || page.Groups[1].Name != "" {
+		t.Fatalf("groups. Want: Backend then ungrouped Got: %+v", page.Groups)
+	}
+	backend := page.Groups[0].Checks
+	if len(backend) != 2 || backend[0].Name != "API" || backend[1].Name != "db" {
+		t.Fatalf("Backend checks. Want: API, db Got: %+v", backend)
+	}
+	api := backend[0]
+	if len(api.Days) != Days || api.Days[Days-1].Count != 200 || api.Days[Days-1].Class() != "degraded" ||
+		api.Days[Days-2].Class() != "up" || api.Days[0].Class() != "none" {
+		t.Fatalf("api days. Got today: %+v yesterday: %+v", api.Days[Days-1], api.Days[Days-2])
+	}
+	if api.UptimePercent < 96.6 || api.UptimePercent > 96.7 {
+		t.Fatalf("api uptime. Want: 96.67 Got: %v", api.UptimePercent)
+	}
+	if len(page.Incidents) != 1 || page.Incidents[0].CheckID != "api" || page.Incidents[0].State != StateDown {
+		t.Fatalf("incidents. Want: api down Got: %+v", page.Incidents)
+	}
+	if state := page.Groups[1].Checks[0].State.State; state != StateUnknown {
+		t.Fatalf("www state. Want: unknown Got: %s", state)
+	}
+	if state := page.Groups[1].Checks[1].State; state.State != StateUnknown || len(state.Offline) != 1 {
+		t.Fatalf("edge state. Want: unknown, eu-test-1 offline Got: %+v", state)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	db := &test.MockDB{}
+	db.AddCheck(checks.StatusCheck{ID: "www", Name: "Website <main>", URL: "https://internal.example.com", Active: true})
+	h := &Handler{DB: db, Log: zap.NewNop(), CacheTTL: time.Minute}
+	if _, err := db.SendStatusResults(context.Background(), []checks.StatusCheckResult{
+		testResult("www", "us-test-1", time.Now().UTC().Add(-time.Minute), 503),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status page. Want: 200 Got: %d", rec.Code)
+	}
+	if !strings.Contains(body, "<title>"+DefaultTitle+"</title>") || !strings.Contains(body, "Website &lt;main&gt;") ||
+		!strings.Contains(body, "is down") {
+		t.Fatalf("status page missing title, check or incident:\n%s", body)
+	}
+	// no check urls and no external assets
+	if strings.Contains(body, "http://") || strings.Contains(body, "https://") {
+		t.Fatalf("status page links outside the controller:\n%s", body)
+	}
+	if n := strings.Count(body, `class="bar none"`); n != Days {
+		t.Fatalf("uptime bars. Want: %d Got: %d", Days, n)
+	}
+
+	rec = httptest.NewRecorder()
+	Static().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/status.css", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ".bar") {
+		t.Fatalf("status.css. Want: 200 Got: %d", rec.Code)
+	}
+}
+
+func TestTemplateUptime(t *testing.T) {
+	page := Page{Title: DefaultTitle, Groups: []Group{{Checks: []Check{
+		{ID: "down", Name: "Down all window", HasData: true, UptimePercent: 0},
+		{ID: "new", Name: "No results yet"},
+	}}}}
+	var b strings.Builder
+	if err := pageTemplate.Execute(&b, page); err != nil {
+		t.Fatal(err)
+	}
+	body := b.String()
+	if !strings.Contains(body, "0.00% uptime") || strings.Count(body, "no data") != 1 {
+		t.Fatalf("uptime. Want: 0.00%% uptime and one no data Got:\n%s", body)
+	}
+}
@@ -0,0 +1,896 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/larntz/status/internal/auth"
+	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+)
+
+// DatabaseConformance runs the tests every data.Database implementation
+// must pass. newDB must return a connected, empty database.
+func DatabaseConformance(t *testing.T, newDB func(t *testing.T) data.Database) {
+	t.Run("Migrate", func(t *testing.T) { conformanceMigrate(t, newDB(t)) })
+	t.Run("StatusCheckCRUD", func(t *testing.T) { conformanceStatusCheckCRUD(t, newDB(t)) })
+	t.Run("GetRegionChecks", func(t *testing.T) { conformanceGetRegionChecks(t, newDB(t)) })
+	t.Run("SendStatusResults", func(t *testing.T) { conformanceSendStatusResults(t, newDB(t)) })
+	t.Run("ResendAfterMigrate", func(t *testing.T) { conformanceResendAfterMigrate(t, newDB(t)) })
+	t.Run("SendSSLResults", func(t *testing.T) { conformanceSendSSLResults(t, newDB(t)) })
+	t.Run("GetStatusResults", func(t *testing.T) { conformanceGetStatusResults(t, newDB(t)) })
+	t.Run("SummarizeStatusResults", func(t *testing.T) { conformanceSummarizeStatusResults(t, newDB(t)) })
+	t.Run("Rollups", func(t *testing.T) { conformanceRollups(t, newDB(t)) })
+	t.Run("Workers", func(t *testing.T) { conformanceWorkers(t, newDB(t)) })
+	t.Run("Leases", func(t *testing.T) { conformanceLeases(t, newDB(t)) })
+	t.Run("Tokens", func(t *testing.T) { conformanceTokens(t, newDB(t)) })
+	t.Run("Tenants", func(t *testing.T) { conformanceTenants(t, newDB(t)) })
+	t.Run("TenantIsolation", func(t *testing.T) { conformanceTenantIsolation(t, newDB(t)) })
+	t.Run("TenantCheckIDs", func(t *testing.T) { conformanceTenantCheckIDs(t, newDB(t)) })
+	t.Run("Secrets", func(t *testing.T) { conformanceSecrets(t, newDB(t)) })
+}
+
+func conformanceCheck(id string, regions ...string) checks.StatusCheck {
+	return checks.StatusCheck{
+		ID:          id,
+		URL:         "https://" + id + ".example.com",
+		Interval:    60,
+		HTTPTimeout: 5,
+		Regions:     regions,
+		Modified:    time.Now().UTC().Truncate(time.Millisecond),
+		Serial:      1,
+		Active:      true,
+		Name:        "Check " + id,
+		Group:       "Conformance",
+		Headers:     map[string]string{"Accept": "application/json"},
+		Assertions: []checks.Assertion{
+			{Type: checks.AssertStatusCode, Operator: checks.OpEqual, Value: "200"},
+			{Type: checks.AssertHeader, Target: "Content-Type", Operator: checks.OpContains, Value: "json"},
+		},
+		Tags: []string{"conformance"},
+	}
+}
+
+func conformanceResult(checkID string, region string, ts time.Time) checks.StatusCheckResult {
+	return checks.StatusCheckResult{
+		Metadata:      checks.StatusCheckMetadata{Region: region, CheckID: checkID},
+		Timestamp:     ts,
+		ResponseID:    checks.NewResponseID(region, checkID, ts),
+		ResponseCode:  200,
+		TTFB:          5,
+		ConnectTiming: 10,
+		TLSTiming:     15,
+		DNSTiming:     20,
+		ResponseInfo:  "200 OK",
+	}
+}
+
+func conformanceMigrate(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := db.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate run %d: %v", i+1, err)
+		}
+	}
+	if err := db.CreateStatusCheck(ctx, conformanceCheck("migrate-check", "us-test-1")); err != nil {
+		t.Fatalf("CreateStatusCheck after Migrate: %v", err)
+	}
+}
+
+func conformanceStatusCheckCRUD(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	check := conformanceCheck("crud-check", "us-test-1", "us-test-2")
+
+	if _, err := db.GetStatusCheck(ctx, check.ID); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetStatusCheck on missing check. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.CreateStatusCheck(ctx, check); err != nil {
+		t.Fatalf("CreateStatusCheck: %v", err)
+	}
+	if err := db.CreateStatusCheck(ctx, check); !errors.Is(err, data.ErrExists) {
+		t.Fatalf("CreateStatusCheck duplicate. Want: ErrExists Got: %v", err)
+	}
+
+	got, err := db.GetStatusCheck(ctx, check.ID)
+	if err != nil {
+		t.Fatalf("GetStatusCheck: %v", err)
+	}
+	assertCheckEqual(t, check, got)
+
+	check.URL = "https://updated.example.com"
+	check.Active = false
+	check.Group = "Conformance Updated"
+	check.Tags = nil
+	check.Headers["Accept"] = "text/html"
+	check.Serial++
+	if err := db.UpdateStatusCheck(ctx, check); err != nil {
+		t.Fatalf("UpdateStatusCheck: %v", err)
+	}
+	got, err = db.GetStatusCheck(ctx, check.ID)
+	if err != nil {
+		t.Fatalf("GetStatusCheck after update: %v", err)
+	}
+	assertCheckEqual(t, check, got)
+
+	if err := db.UpdateStatusCheck(ctx, conformanceCheck("missing-check")); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("UpdateStatusCheck on missing check. Want: ErrNotFound Got: %v", err)
+	}
+
+	list, err := db.ListStatusChecks(ctx)
+	if err != nil {
+		t.Fatalf("ListStatusChecks: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("ListStatusChecks. Want: 1 check Got: %d", len(list))
+	}
+
+	if err := db.DeleteStatusCheck(ctx, check.ID); err != nil {
+		t.Fatalf("DeleteStatusCheck: %v", err)
+	}
+	if err := db.DeleteStatusCheck(ctx, check.ID); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteStatusCheck on missing check. Want: ErrNotFound Got: %v", err)
+	}
+}
+
+func conformanceGetRegionChecks(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	for _, c := range []checks.StatusCheck{
+		conformanceCheck("region-check-1", "us-test-1"),
+		conformanceCheck("region-check-2", "us-test-1", "us-test-2"),
+		conformanceCheck("region-check-3", "us-test-2"),
+	} {
+		if err := db.CreateStatusCheck(ctx, c); err != nil {
+			t.Fatalf("CreateStatusCheck: %v", err)
+		}
+	}
+
+	regionChecks, err := db.GetRegionChecks(ctx, "us-test-1")
+	if err != nil {
+		t.Fatalf("GetRegionChecks: %v", err)
+	}
+	var ids []string
+	for _, c := range regionChecks.StatusChecks {
+		ids = append(ids, c.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"region-check-1", "region-check-2"}) {
+		t.Fatalf("GetRegionChecks. Want: [region-check-1 region-check-2] Got: %v", ids)
+	}
+
+	regionChecks, err = db.GetRegionChecks(ctx, "us-test-3")
+	if err != nil {
+		t.Fatalf("GetRegionChecks: %v", err)
+	}
+	if len(regionChecks.StatusChecks) != 0 {
+		t.Fatalf("GetRegionChecks on empty region. Want: 0 Got: %d", len(regionChecks.StatusChecks))
+	}
+}
+
+func conformanceSendStatusResults(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	results := []checks.StatusCheckResult{
+		conformanceResult("results-check", "us-test-1", ts),
+		conformanceResult("results-check", "us-test-1", ts.Add(time.Second)),
+	}
+
+	inserted, err := db.SendStatusResults(ctx, results)
+	if err != nil {
+		t.Fatalf("SendStatusResults: %v", err)
+	}
+	if inserted != 2 {
+		t.Fatalf("SendStatusResults. Want: 2 inserted Got: %d", inserted)
+	}
+
+	// resending is a no-op
+	inserted, err = db.SendStatusResults(ctx, append(results, conformanceResult("results-check", "us-test-1", ts.Add(2*time.Second))))
+	if err != nil {
+		t.Fatalf("SendStatusResults resend: %v", err)
+	}
+	if inserted != 1 {
+		t.Fatalf("SendStatusResults resend. Want: 1 inserted Got: %d", inserted)
+	}
+
+	got, err := db.GetStatusResults(ctx, data.ResultQuery{CheckID: "results-check"})
+	if err != nil {
+		t.Fatalf("GetStatusResults: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("GetStatusResults. Want: 3 results Got: %d", len(got))
+	}
+
+	if inserted, err := db.SendStatusResults(ctx, nil); err != nil || inserted != 0 {
+		t.Fatalf("SendStatusResults with no results. Want: 0, nil Got: %d, %v", inserted, err)
+	}
+}
+
+// conformanceResendAfterMigrate resends a batch to the result storage
+// Migrate creates, e.g. a mongo time series collection
+func conformanceResendAfterMigrate(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	results := []checks.StatusCheckResult{
+		conformanceResult("resend-check", "us-test-1", ts),
+		conformanceResult("resend-check", "us-test-2", ts),
+		conformanceResult("resend-check", "us-test-1", ts.Add(time.Second)),
+	}
+	if inserted, err := db.SendStatusResults(ctx, results); err != nil || inserted != 3 {
+		t.Fatalf("SendStatusResults. Want: 3 inserted Got: %d %v", inserted, err)
+	}
+	if inserted, err := db.SendStatusResults(ctx, results); err != nil || inserted != 0 {
+		t.Fatalf("SendStatusResults resend. Want: 0 inserted Got: %d %v", inserted, err)
+	}
+	got, err := db.GetStatusResults(ctx, data.ResultQuery{CheckID: "resend-check"})
+	if err != nil || len(got) != 3 {
+		t.Fatalf("GetStatusResults after resend. Want: 3 results Got: %d %v", len(got), err)
+	}
+}
+
+func conformanceSendSSLResults(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	results := []checks.SSLCheckResult{
+		{ID: "ssl-check", ResponseID: "ssl-response-1", SSLExpiration: time.Now().UTC().Add(24 * time.Hour), Valid: true},
+	}
+	inserted, err := db.SendSSLResults(ctx, results)
+	if err != nil {
+		t.Fatalf("SendSSLResults: %v", err)
+	}
+	if inserted != 1 {
+		t.Fatalf("SendSSLResults. Want: 1 inserted Got: %d", inserted)
+	}
+	inserted, err = db.SendSSLResults(ctx, results)
+	if err != nil {
+		t.Fatalf("SendSSLResults resend: %v", err)
+	}
+	if inserted != 0 {
+		t.Fatalf("SendSSLResults resend. Want: 0 inserted Got: %d", inserted)
+	}
+}
+
+func conformanceGetStatusResults(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Second)
+	var results []checks.StatusCheckResult
+	for i := 0; i < 5; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		results = append(results,
+			conformanceResult("query-check-1", "us-test-1", ts),
+			conformanceResult("query-check-1", "us-test-2", ts),
+			conformanceResult("query-check-2", "us-test-1", ts))
+	}
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatalf("SendStatusResults: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query data.ResultQuery
+		want  int
+	}{
+		{"all", data.ResultQuery{}, 15},
+		{"check", data.ResultQuery{CheckID: "query-check-1"}, 10},
+		{"check and region", data.ResultQuery{CheckID: "query-check-1", Region: "us-test-2"}, 5},
+		{"time range", data.ResultQuery{CheckID: "query-check-1", Region: "us-test-1",
+			From: start.Add(time.Minute), To: start.Add(3 * time.Minute)}, 2},
+		{"limit", data.ResultQuery{CheckID: "query-check-2", Limit: 3}, 3},
+		{"offset", data.ResultQuery{CheckID: "query-check-2", Offset: 3}, 2},
+		{"limit and offset", data.ResultQuery{CheckID: "query-check-2", Limit: 2, Offset: 4}, 1},
+	}
+	for _, tt := range tests {
+		got, err := db.GetStatusResults(ctx, tt.query)
+		if err != nil {
+			t.Fatalf("%s: GetStatusResults: %v", tt.name, err)
+		}
+		if len(got) != tt.want {
+			t.Fatalf("%s: GetStatusResults. Want: %d results Got: %d", tt.name, tt.want, len(got))
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].Timestamp.Before(got[i-1].Timestamp) {
+				t.Fatalf("%s: GetStatusResults not ordered by timestamp", tt.name)
+			}
+		}
+	}
+
+	// paging by key visits every result once, results share timestamps
+	all, err := db.GetStatusResults(ctx, data.ResultQuery{})
+	if err != nil {
+		t.Fatalf("GetStatusResults: %v", err)
+	}
+	var paged []string
+	query := data.ResultQuery{Limit: 4}
+	for {
+		page, err := db.GetStatusResults(ctx, query)
+		if err != nil {
+			t.Fatalf("GetStatusResults after %+v: %v", query.After, err)
+		}
+		for _, r := range page {
+			paged = append(paged, r.ResponseID)
+		}
+		if len(page) < query.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		query.After = &data.ResultCursor{Timestamp: last.Timestamp, ResponseID: last.ResponseID}
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("GetStatusResults pages. Want: %d results Got: %d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i] != all[i].ResponseID {
+			t.Fatalf("GetStatusResults pages %d. Want: %s Got: %s", i, all[i].ResponseID, paged[i])
+		}
+	}
+
+	got, err := db.GetStatusResults(ctx, data.ResultQuery{CheckID: "query-check-2", Limit: 1})
+	if err != nil {
+		t.Fatalf("GetStatusResults: %v", err)
+	}
+	want := results[2]
+	if got[0].ResponseID != want.ResponseID || !got[0].Timestamp.Equal(want.Timestamp) ||
+		got[0].ResponseCode != want.ResponseCode || got[0].TTFB != want.TTFB ||
+		got[0].ResponseInfo != want.ResponseInfo || got[0].Metadata != want.Metadata {
+		t.Fatalf("GetStatusResults round trip.\nWant: %+v\nGot:  %+v", want, got[0])
+	}
+}
+
+func conformanceSummarizeStatusResults(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	var results []checks.StatusCheckResult
+	// two minutes of results every 20 seconds in us-test-1, one failure
+	for i := 0; i < 6; i++ {
+		r := conformanceResult("summary-check", "us-test-1", start.Add(time.Duration(i)*20*time.Second))
+		r.TTFB = int64(10 * (i + 1))
+		if i == 4 {
+			r.ResponseCode = 0
+			r.TTFB, r.ConnectTiming = 0, 0
+		}
+		if i == 0 {
+			r.AssertionFailed = true
+		}
+		results = append(results, r)
+	}
+	results = append(results, conformanceResult("summary-check", "us-test-2", start))
+	if _, err := db.SendStatusResults(ctx, results); err != nil {
+		t.Fatalf("SendStatusResults: %v", err)
+	}
+
+	query := data.ResultQuery{CheckID: "summary-check", From: start, To: start.Add(time.Hour)}
+	got, err := db.SummarizeStatusResults(ctx, query, time.Minute)
+	if err != nil {
+		t.Fatalf("SummarizeStatusResults: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("SummarizeStatusResults. Want: 3 buckets Got: %d %+v", len(got), got)
+	}
+	want := checks.StatusCheckSummary{
+		Metadata:      checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "summary-check"},
+		Timestamp:     start.Add(time.Minute),
+		Count:         3,
+		Failures:      1,
+		UptimePercent: checks.UptimePercent(3, 1),
+		TTFBAvg:       50,
+		TTFBMax:       60,
+		ConnectAvg:    10,
+	}
+	if !got[2].Timestamp.Equal(want.Timestamp) {
+		t.Fatalf("SummarizeStatusResults timestamp. Want: %v Got: %v", want.Timestamp, got[2].Timestamp)
+	}
+	got[2].Timestamp = want.Timestamp
+	if !reflect.DeepEqual(got[2], want) {
+		t.Fatalf("SummarizeStatusResults.\nWant: %+v\nGot:  %+v", want, got[2])
+	}
+	if got[0].Metadata.Region != "us-test-1" || got[1].Metadata.Region != "us-test-2" {
+		t.Fatalf("SummarizeStatusResults not ordered by timestamp then region: %+v", got)
+	}
+
+	query.Region = "us-test-1"
+	got, err = db.SummarizeStatusResults(ctx, query, time.Hour)
+	if err != nil {
+		t.Fatalf("SummarizeStatusResults hourly: %v", err)
+	}
+	if len(got) != 1 || got[0].Count != 6 || got[0].Failures != 2 || !got[0].Timestamp.Equal(start) {
+		t.Fatalf("SummarizeStatusResults hourly. Want: 6 results at %v Got: %+v", start, got)
+	}
+
+	query.Limit, query.Offset = 1, 1
+	got, err = db.SummarizeStatusResults(ctx, query, time.Minute)
+	if err != nil {
+		t.Fatalf("SummarizeStatusResults paged: %v", err)
+	}
+	if len(got) != 1 || !got[0].Timestamp.Equal(start.Add(time.Minute)) {
+		t.Fatalf("SummarizeStatusResults paged. Want: bucket at %v Got: %+v", start.Add(time.Minute), got)
+	}
+}
+
+func conformanceRollups(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Hour)
+	var rollups []checks.StatusCheckRollup
+	for i := 0; i < 3; i++ {
+		rollups = append(rollups, checks.StatusCheckRollup{
+			Metadata:      checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "rollup-check"},
+			Timestamp:     start.Add(time.Duration(i-3) * time.Hour),
+			Count:         60,
+			Failures:      int64(i),
+			UptimePercent: float64(60-i) / 60 * 100,
+			TTFBP50:       10,
+			TTFBP95:       20,
+			TTFBP99:       30,
+			ConnectP50:    1,
+			ConnectP95:    2,
+			ConnectP99:    3,
+		})
+	}
+	if err := db.SaveRollups(ctx, checks.RollupHourly, rollups); err != nil {
+		t.Fatalf("SaveRollups: %v", err)
+	}
+
+	// saving the same bucket again replaces it
+	rollups[2].Count = 30
+	if err := db.SaveRollups(ctx, checks.RollupHourly, rollups[2:]); err != nil {
+		t.Fatalf("SaveRollups replace: %v", err)
+	}
+
+	got, err := db.GetRollups(ctx, checks.RollupHourly, data.ResultQuery{CheckID: "rollup-check"})
+	if err != nil {
+		t.Fatalf("GetRollups: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("GetRollups. Want: 3 rollups Got: %d", len(got))
+	}
+	for i := range got {
+		if !got[i].Timestamp.Equal(rollups[i].Timestamp) {
+			t.Fatalf("GetRollups timestamp %d. Want: %v Got: %v", i, rollups[i].Timestamp, got[i].Timestamp)
+		}
+		got[i].Timestamp = rollups[i].Timestamp
+		if !reflect.DeepEqual(got[i], rollups[i]) {
+			t.Fatalf("GetRollups %d.\nWant: %+v\nGot:  %+v", i, rollups[i], got[i])
+		}
+	}
+
+	got, err = db.GetRollups(ctx, checks.RollupDaily, data.ResultQuery{CheckID: "rollup-check"})
+	if err != nil {
+		t.Fatalf("GetRollups daily: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("GetRollups daily. Want: 0 rollups Got: %d", len(got))
+	}
+}
+
+func conformanceWorkers(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	workers := []checks.Worker{
+		{ID: "worker-b", Region: "us-test-1", Version: "v1.2.0", Hostname: "host-b", Capacity: 50,
+			Started: now.Add(-time.Hour), LastSeen: now, Checks: 3, Goroutines: 12, HeapAlloc: 1 << 20},
+		{ID: "worker-a", Region: "us-test-1", Version: "v1.2.0", Hostname: "host-a",
+			Started: now.Add(-time.Hour), LastSeen: now},
+		{ID: "worker-c", Region: "eu-test-1", Version: "v1.1.0", Hostname: "host-c",
+			Started: now.Add(-2 * time.Hour), LastSeen: now.Add(-time.Hour), Stopped: true},
+	}
+	for _, w := range workers {
+		if err := db.SaveWorker(ctx, w); err != nil {
+			t.Fatalf("SaveWorker %s: %v", w.ID, err)
+		}
+	}
+
+	// saving again replaces the registration
+	workers[1].LastSeen, workers[1].Checks = now.Add(time.Minute), 7
+	if err := db.SaveWorker(ctx, workers[1]); err != nil {
+		t.Fatalf("SaveWorker replace: %v", err)
+	}
+
+	got, err := db.ListWorkers(ctx)
+	if err != nil {
+		t.Fatalf("ListWorkers: %v", err)
+	}
+	want := []checks.Worker{workers[2], workers[1], workers[0]}
+	if len(got) != len(want) {
+		t.Fatalf("ListWorkers. Want: %d workers Got: %d", len(want), len(got))
+	}
+	for i := range want {
+		if !got[i].LastSeen.Equal(want[i].LastSeen) || !got[i].Started.Equal(want[i].Started) {
+			t.Fatalf("ListWorkers times %d. Want: %v %v Got: %v %v", i,
+				want[i].Started, want[i].LastSeen, got[i].Started, got[i].LastSeen)
+		}
+		got[i].Started, got[i].LastSeen = want[i].Started, want[i].LastSeen
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("ListWorkers %d.\nWant: %+v\nGot:  %+v", i, want[i], got[i])
+		}
+	}
+
+	if err := db.DeleteWorker(ctx, "worker-c"); err != nil {
+		t.Fatalf("DeleteWorker: %v", err)
+	}
+	if err := db.DeleteWorker(ctx, "worker-c"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteWorker missing. Want: ErrNotFound Got: %v", err)
+	}
+	if got, err := db.ListWorkers(ctx); err != nil || len(got) != 2 {
+		t.Fatalf("ListWorkers after delete. Want: 2 workers Got: %d %v", len(got), err)
+	}
+}
+
+func conformanceLeases(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	acquire := func(name string, holder string, ttl time.Duration, want bool) {
+		t.Helper()
+		got, err := db.AcquireLease(ctx, name, holder, ttl)
+		if err != nil || got != want {
+			t.Fatalf("AcquireLease %s for %s. Want: %t Got: %t %v", name, holder, want, got, err)
+		}
+	}
+	acquire("rollups", "a", time.Minute, true)
+	acquire("rollups", "b", time.Minute, false)
+	acquire("rollups", "a", time.Minute, true)
+	acquire("alerts", "b", time.Minute, true)
+
+	// only the holder can release a lease
+	if err := db.ReleaseLease(ctx, "rollups", "b"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	acquire("rollups", "b", time.Minute, false)
+	if err := db.ReleaseLease(ctx, "rollups", "a"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	acquire("rollups", "b", time.Minute, true)
+
+	// an expired lease can be taken
+	acquire("expiring", "a", 50*time.Millisecond, true)
+	acquire("expiring", "b", time.Minute, false)
+	time.Sleep(100 * time.Millisecond)
+	acquire("expiring", "b", time.Minute, true)
+	acquire("expiring", "a", time.Minute, false)
+}
+
+func conformanceTokens(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	tokens := []auth.Token{
+		{ID: "token-b", Name: "worker us-test-1", Hash: "b0b0", Scopes: []auth.Scope{auth.ScopeWorker},
+			Created: now, Expires: now.Add(24 * time.Hour)},
+		{ID: "token-a", Name: "dashboard", Hash: "a0a0",
+			Scopes: []auth.Scope{auth.ScopeChecksRead, auth.ScopeResultsRead}, Created: now.Add(-time.Hour)},
+	}
+	for _, tok := range tokens {
+		if err := db.CreateToken(ctx, tok); err != nil {
+			t.Fatalf("CreateToken %s: %v", tok.ID, err)
+		}
+	}
+	if err := db.CreateToken(ctx, tokens[0]); !errors.Is(err, data.ErrExists) {
+		t.Fatalf("CreateToken duplicate. Want: ErrExists Got: %v", err)
+	}
+
+	assertToken := func(want auth.Token, got auth.Token) {
+		t.Helper()
+		if !got.Created.Equal(want.Created) || !got.Expires.Equal(want.Expires) {
+			t.Fatalf("token %s times. Want: %v %v Got: %v %v", want.ID,
+				want.Created, want.Expires, got.Created, got.Expires)
+		}
+		got.Created, got.Expires = want.Created, want.Expires
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("token mismatch.\nWant: %+v\nGot:  %+v", want, got)
+		}
+	}
+	got, err := db.GetToken(ctx, "token-b")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	assertToken(tokens[0], got)
+	if _, err := db.GetToken(ctx, "missing"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetToken missing. Want: ErrNotFound Got: %v", err)
+	}
+
+	list, err := db.ListTokens(ctx)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListTokens. Want: 2 tokens Got: %d %v", len(list), err)
+	}
+	// a zero Expires reads back as zero
+	assertToken(tokens[1], list[0])
+	assertToken(tokens[0], list[1])
+
+	if err := db.DeleteToken(ctx, "token-a"); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+	if err := db.DeleteToken(ctx, "token-a"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteToken missing. Want: ErrNotFound Got: %v", err)
+	}
+}
+
+func conformanceTenants(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	for _, tenant := range []checks.Tenant{
+		{Name: "team-b", MaxChecks: 10},
+		{Name: "team-a", MaxChecks: 5, MinInterval: 60},
+		{Name: "team-b", MaxChecks: 20, MinInterval: 30},
+	} {
+		if err := db.SaveTenant(ctx, tenant); err != nil {
+			t.Fatalf("SaveTenant %s: %v", tenant.Name, err)
+		}
+	}
+	got, err := db.GetTenant(ctx, "team-b")
+	if want := (checks.Tenant{Name: "team-b", MaxChecks: 20, MinInterval: 30}); err != nil || got != want {
+		t.Fatalf("GetTenant. Want: %+v Got: %+v %v", want, got, err)
+	}
+	if _, err := db.GetTenant(ctx, "missing"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetTenant missing. Want: ErrNotFound Got: %v", err)
+	}
+	list, err := db.ListTenants(ctx)
+	if err != nil || len(list) != 2 || list[0].Name != "team-a" || list[1].Name != "team-b" {
+		t.Fatalf("ListTenants. Want: team-a team-b Got: %+v %v", list, err)
+	}
+
+	// a tenant only sees itself and can not change tenants
+	scoped := data.WithTenant(ctx, "team-a")
+	if list, err := db.ListTenants(scoped); err != nil || len(list) != 1 || list[0].Name != "team-a" {
+		t.Fatalf("ListTenants scoped. Want: team-a Got: %+v %v", list, err)
+	}
+	if _, err := db.GetTenant(scoped, "team-b"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetTenant other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.SaveTenant(scoped, checks.Tenant{Name: "team-a"}); !errors.Is(err, data.ErrTenantScope) {
+		t.Fatalf("SaveTenant scoped. Want: ErrTenantScope Got: %v", err)
+	}
+	if err := db.DeleteTenant(scoped, "team-a"); !errors.Is(err, data.ErrTenantScope) {
+		t.Fatalf("DeleteTenant scoped. Want: ErrTenantScope Got: %v", err)
+	}
+
+	if err := db.DeleteTenant(ctx, "team-a"); err != nil {
+		t.Fatalf("DeleteTenant: %v", err)
+	}
+	if err := db.DeleteTenant(ctx, "team-a"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteTenant missing. Want: ErrNotFound Got: %v", err)
+	}
+}
+
+func conformanceTenantIsolation(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	teamA, teamB := data.WithTenant(ctx, "team-a"), data.WithTenant(ctx, "team-b")
+	ts := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	// checks and results written with a tenant context belong to the tenant
+	for _, c := range []struct {
+		ctx context.Context
+		id  string
+	}{{ctx, "default-check"}, {teamA, "a-check"}, {teamB, "b-check"}} {
+		if err := db.CreateStatusCheck(c.ctx, conformanceCheck(c.id, "us-test-1")); err != nil {
+			t.Fatalf("CreateStatusCheck %s: %v", c.id, err)
+		}
+		if _, err := db.SendStatusResults(c.ctx, []checks.StatusCheckResult{conformanceResult(c.id, "us-test-1", ts)}); err != nil {
+			t.Fatalf("SendStatusResults %s: %v", c.id, err)
+		}
+		rollup := checks.StatusCheckRollup{
+			Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: c.id}, Timestamp: ts, Count: 1}
+		if err := db.SaveRollups(c.ctx, checks.RollupHourly, []checks.StatusCheckRollup{rollup}); err != nil {
+			t.Fatalf("SaveRollups %s: %v", c.id, err)
+		}
+	}
+
+	ids := func(name string, n int, id func(i int) string, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out := make([]string, n)
+		for i := range out {
+			out[i] = id(i)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{"unscoped", ctx, []string{"a-check", "b-check", "default-check"}},
+		{"default tenant", data.WithTenant(ctx, ""), []string{"default-check"}},
+		{"team-a", teamA, []string{"a-check"}},
+	} {
+		list, err := db.ListStatusChecks(tc.ctx)
+		if got := ids("ListStatusChecks", len(list), func(i int) string { return list[i].ID }, err); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s ListStatusChecks. Want: %v Got: %v", tc.name, tc.want, got)
+		}
+		region, err := db.GetRegionChecks(tc.ctx, "us-test-1")
+		got := ids("GetRegionChecks", len(region.StatusChecks), func(i int) string { return region.StatusChecks[i].ID }, err)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s GetRegionChecks. Want: %v Got: %v", tc.name, tc.want, got)
+		}
+		results, err := db.GetStatusResults(tc.ctx, data.ResultQuery{})
+		got = ids("GetStatusResults", len(results), func(i int) string { return results[i].Metadata.CheckID }, err)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s GetStatusResults. Want: %v Got: %v", tc.name, tc.want, got)
+		}
+		summaries, err := db.SummarizeStatusResults(tc.ctx, data.ResultQuery{}, time.Hour)
+		got = ids("SummarizeStatusResults", len(summaries), func(i int) string { return summaries[i].Metadata.CheckID }, err)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s SummarizeStatusResults. Want: %v Got: %v", tc.name, tc.want, got)
+		}
+		rollups, err := db.GetRollups(tc.ctx, checks.RollupHourly, data.ResultQuery{})
+		got = ids("GetRollups", len(rollups), func(i int) string { return rollups[i].Metadata.CheckID }, err)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s GetRollups. Want: %v Got: %v", tc.name, tc.want, got)
+		}
+	}
+	results, err := db.GetStatusResults(teamA, data.ResultQuery{})
+	if err != nil || len(results) != 1 || results[0].Metadata.Tenant != "team-a" {
+		t.Fatalf("GetStatusResults tenant. Want: team-a Got: %+v %v", results, err)
+	}
+
+	// other tenants' checks can not be read or changed
+	if _, err := db.GetStatusCheck(teamA, "b-check"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetStatusCheck other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.UpdateStatusCheck(teamA, conformanceCheck("b-check", "us-test-2")); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("UpdateStatusCheck other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.DeleteStatusCheck(teamA, "b-check"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteStatusCheck other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	check, err := db.GetStatusCheck(ctx, "b-check")
+	if err != nil || check.Tenant != "team-b" || check.Regions[0] != "us-test-1" {
+		t.Fatalf("GetStatusCheck. Want: b-check of team-b unchanged Got: %+v %v", check, err)
+	}
+	// an update keeps the tenant of the context
+	if err := db.UpdateStatusCheck(teamA, conformanceCheck("a-check", "us-test-2")); err != nil {
+		t.Fatalf("UpdateStatusCheck: %v", err)
+	}
+	if check, err := db.GetStatusCheck(teamA, "a-check"); err != nil || check.Tenant != "team-a" {
+		t.Fatalf("GetStatusCheck. Want: a-check of team-a Got: %+v %v", check, err)
+	}
+
+	// tokens
+	if err := db.CreateToken(teamA, auth.Token{ID: "a-token", Name: "team-a", Hash: "a0a0"}); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if err := db.CreateToken(ctx, auth.Token{ID: "admin-token", Name: "admin", Hash: "b0b0"}); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if token, err := db.GetToken(ctx, "a-token"); err != nil || token.Tenant != "team-a" {
+		t.Fatalf("GetToken. Want: a-token of team-a Got: %+v %v", token, err)
+	}
+	if tokens, err := db.ListTokens(teamA); err != nil || len(tokens) != 1 || tokens[0].ID != "a-token" {
+		t.Fatalf("ListTokens team-a. Want: a-token Got: %+v %v", tokens, err)
+	}
+	if _, err := db.GetToken(teamB, "a-token"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetToken other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.DeleteToken(teamA, "admin-token"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteToken other tenant. Want: ErrNotFound Got: %v", err)
+	}
+}
+
+// conformanceTenantCheckIDs covers two tenants with a check of the same id,
+// check ids are unique per tenant
+func conformanceTenantCheckIDs(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	teamA, teamB := data.WithTenant(ctx, "team-a"), data.WithTenant(ctx, "team-b")
+	ts := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+
+	for i, tenantCtx := range []context.Context{teamA, teamB} {
+		if err := db.CreateStatusCheck(tenantCtx, conformanceCheck("api", fmt.Sprintf("us-test-%d", i+1))); err != nil {
+			t.Fatalf("CreateStatusCheck %d: %v", i, err)
+		}
+		rollup := checks.StatusCheckRollup{
+			Metadata: checks.StatusCheckMetadata{Region: "us-test-1", CheckID: "api"}, Timestamp: ts, Count: int64(i + 1)}
+		if err := db.SaveRollups(tenantCtx, checks.RollupHourly, []checks.StatusCheckRollup{rollup}); err != nil {
+			t.Fatalf("SaveRollups %d: %v", i, err)
+		}
+	}
+	if err := db.CreateStatusCheck(teamA, conformanceCheck("api", "us-test-1")); !errors.Is(err, data.ErrExists) {
+		t.Fatalf("CreateStatusCheck same tenant. Want: ErrExists Got: %v", err)
+	}
+	if list, err := db.ListStatusChecks(ctx); err != nil || len(list) != 2 {
+		t.Fatalf("ListStatusChecks. Want: 2 checks Got: %+v %v", list, err)
+	}
+
+	// each tenant reads and changes its own check
+	if err := db.UpdateStatusCheck(teamB, conformanceCheck("api", "us-test-3")); err != nil {
+		t.Fatalf("UpdateStatusCheck: %v", err)
+	}
+	for _, tc := range []struct {
+		ctx    context.Context
+		tenant string
+		region string
+		count  int64
+	}{{teamA, "team-a", "us-test-1", 1}, {teamB, "team-b", "us-test-3", 2}} {
+		check, err := db.GetStatusCheck(tc.ctx, "api")
+		if err != nil || check.Tenant != tc.tenant || check.Regions[0] != tc.region {
+			t.Fatalf("GetStatusCheck %s. Want: api in %s Got: %+v %v", tc.tenant, tc.region, check, err)
+		}
+		rollups, err := db.GetRollups(tc.ctx, checks.RollupHourly, data.ResultQuery{CheckID: "api"})
+		if err != nil || len(rollups) != 1 || rollups[0].Count != tc.count || rollups[0].Metadata.Tenant != tc.tenant {
+			t.Fatalf("GetRollups %s. Want: 1 rollup with count %d Got: %+v %v", tc.tenant, tc.count, rollups, err)
+		}
+	}
+	// the same check is updated without a tenant context by its tenant
+	unscoped := conformanceCheck("api", "us-test-4")
+	unscoped.Tenant = "team-a"
+	if err := db.UpdateStatusCheck(ctx, unscoped); err != nil {
+		t.Fatalf("UpdateStatusCheck unscoped: %v", err)
+	}
+	if check, err := db.GetStatusCheck(teamB, "api"); err != nil || check.Regions[0] != "us-test-3" {
+		t.Fatalf("GetStatusCheck team-b. Want: api in us-test-3 Got: %+v %v", check, err)
+	}
+
+	if err := db.DeleteStatusCheck(teamA, "api"); err != nil {
+		t.Fatalf("DeleteStatusCheck: %v", err)
+	}
+	if _, err := db.GetStatusCheck(teamA, "api"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetStatusCheck deleted. Want: ErrNotFound Got: %v", err)
+	}
+	if check, err := db.GetStatusCheck(ctx, "api"); err != nil || check.Tenant != "team-b" {
+		t.Fatalf("GetStatusCheck. Want: api of team-b Got: %+v %v", check, err)
+	}
+}
+
+func conformanceSecrets(t *testing.T, db data.Database) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, s := range []checks.Secret{
+		{Name: "api-key", Value: "old", Modified: now.Add(-time.Hour)},
+		{Name: "api-key", Value: "sealed", Modified: now},
+		{Name: "api-key", Tenant: "team-a", Value: "team-a sealed", Modified: now},
+		{Name: "db.password", Value: "sealed 2", Modified: now},
+	} {
+		if err := db.SaveSecret(ctx, s); err != nil {
+			t.Fatalf("SaveSecret %s: %v", s.Name, err)
+		}
+	}
+
+	got, err := db.GetSecret(ctx, "", "api-key")
+	if err != nil || got.Value != "sealed" || !got.Modified.Equal(now) {
+		t.Fatalf("GetSecret. Want: sealed %v Got: %+v %v", now, got, err)
+	}
+	if got, err := db.GetSecret(ctx, "team-a", "api-key"); err != nil || got.Value != "team-a sealed" || got.Tenant != "team-a" {
+		t.Fatalf("GetSecret team-a. Want: team-a sealed Got: %+v %v", got, err)
+	}
+	if _, err := db.GetSecret(ctx, "", "missing"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetSecret missing. Want: ErrNotFound Got: %v", err)
+	}
+	list, err := db.ListSecrets(ctx)
+	if err != nil || len(list) != 3 || list[0].Name != "api-key" || list[1].Name != "db.password" || list[2].Tenant != "team-a" {
+		t.Fatalf("ListSecrets. Want: api-key db.password team-a/api-key Got: %+v %v", list, err)
+	}
+
+	// a tenant only sees and changes its own secrets
+	teamA := data.WithTenant(ctx, "team-a")
+	if _, err := db.GetSecret(teamA, "", "api-key"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("GetSecret other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if list, err := db.ListSecrets(teamA); err != nil || len(list) != 1 || list[0].Tenant != "team-a" {
+		t.Fatalf("ListSecrets team-a. Want: team-a/api-key Got: %+v %v", list, err)
+	}
+	if err := db.DeleteSecret(teamA, "", "db.password"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteSecret other tenant. Want: ErrNotFound Got: %v", err)
+	}
+	if err := db.SaveSecret(teamA, checks.Secret{Name: "token", Value: "v", Modified: now}); err != nil {
+		t.Fatalf("SaveSecret team-a: %v", err)
+	}
+	if _, err := db.GetSecret(ctx, "team-a", "token"); err != nil {
+		t.Fatalf("GetSecret saved by team-a: %v", err)
+	}
+
+	if err := db.DeleteSecret(teamA, "team-a", "api-key"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if err := db.DeleteSecret(ctx, "team-a", "api-key"); !errors.Is(err, data.ErrNotFound) {
+		t.Fatalf("DeleteSecret missing. Want: ErrNotFound Got: %v", err)
+	}
+}
+
+func assertCheckEqual(t *testing.T, want checks.StatusCheck, got checks.StatusCheck) {
+	t.Helper()
+	if !got.Modified.Equal(want.Modified) {
+		t.Fatalf("check Modified. Want: %v Got: %v", want.Modified, got.Modified)
+	}
+	got.Modified = want.Modified
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("check mismatch.\nWant: %+v\nGot:  %+v", want, got)
+	}
+}
@@ -2,52 +2,617 @@
 package test
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"math"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/larntz/status/internal/auth"
 	"github.com/larntz/status/internal/checks"
+	"github.com/larntz/status/internal/data"
+	"github.com/larntz/status/internal/leader"
 )
 
 // MockDB is a mock database used for testing
 type MockDB struct {
 	Checks            checks.Checks
 	StatusResult      []checks.StatusCheckResult
+	SSLResult         []checks.SSLCheckResult
+	Rollups           map[checks.RollupPeriod]map[string]checks.StatusCheckRollup
+	Workers           map[string]checks.Worker
+	Leases            leader.MemoryStore
+	Tokens            map[string]auth.Token
+	Tenants           map[string]checks.Tenant
+	Secrets           map[[2]string]checks.Secret // keyed on tenant and name
 	StatusResultMutex sync.Mutex
+	// FailResponseIDs are results SendStatusResults refuses to write, used
+	// to simulate partial write failures.
+	FailResponseIDs map[string]bool
+	written         map[string]bool
 }
 
 // Connect to the MockDB
-func (db *MockDB) Connect() error {
+func (db *MockDB) Connect(_ context.Context) error {
+	return nil
+}
+
+// Disconnect from the MockDB to satisfy interface
+func (db *MockDB) Disconnect(_ context.Context) error {
+	return nil
+}
+
+// Migrate the MockDB to satisfy interface
+func (db *MockDB) Migrate(_ context.Context) error {
 	return nil
 }
 
 // GetRegionChecks gets mock region checks
-func (db *MockDB) GetRegionChecks(_ string) (checks.Checks, error) {
-	return db.Checks, nil
+func (db *MockDB) GetRegionChecks(ctx context.Context, region string) (checks.Checks, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	regionChecks := checks.Checks{Region: region}
+	for _, c := range db.Checks.StatusChecks {
+		if !visible(ctx, c.Tenant) {
+			continue
+		}
+		for _, r := range c.Regions {
+			if r == region {
+				regionChecks.StatusChecks = append(regionChecks.StatusChecks, c)
+				break
+			}
+		}
+	}
+	return regionChecks, nil
+}
+
+// ListStatusChecks returns every mock check
+func (db *MockDB) ListStatusChecks(ctx context.Context) ([]checks.StatusCheck, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var statusChecks []checks.StatusCheck
+	for _, c := range db.Checks.StatusChecks {
+		if visible(ctx, c.Tenant) {
+			statusChecks = append(statusChecks, c)
+		}
+	}
+	sort.Slice(statusChecks, func(i, j int) bool { return statusChecks[i].ID < statusChecks[j].ID })
+	return statusChecks, nil
+}
+
+// GetStatusCheck returns the mock check with id
+func (db *MockDB) GetStatusCheck(ctx context.Context, id string) (checks.StatusCheck, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	i := db.checkIndex(ctx, id)
+	if i < 0 {
+		return checks.StatusCheck{}, data.ErrNotFound
+	}
+	return db.Checks.StatusChecks[i], nil
+}
+
+// CreateStatusCheck adds a mock check
+func (db *MockDB) CreateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if tenant, ok := data.TenantFrom(ctx); ok {
+		check.Tenant = tenant
+	}
+	if db.checkIndex(data.WithTenant(ctx, check.Tenant), check.ID) >= 0 {
+		return data.ErrExists
+	}
+	db.Checks.StatusChecks = append(db.Checks.StatusChecks, check)
+	return nil
+}
+
+// UpdateStatusCheck replaces a mock check
+func (db *MockDB) UpdateStatusCheck(ctx context.Context, check checks.StatusCheck) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if tenant, ok := data.TenantFrom(ctx); ok {
+		check.Tenant = tenant
+	}
+	i := db.checkIndex(data.WithTenant(ctx, check.Tenant), check.ID)
+	if i < 0 {
+		return data.ErrNotFound
+	}
+	db.Checks.StatusChecks[i] = check
+	return nil
+}
+
+// DeleteStatusCheck removes a mock check
+func (db *MockDB) DeleteStatusCheck(ctx context.Context, id string) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	i := db.checkIndex(ctx, id)
+	if i < 0 {
+		return data.ErrNotFound
+	}
+	db.Checks.StatusChecks = append(db.Checks.StatusChecks[:i], db.Checks.StatusChecks[i+1:]...)
+	return nil
 }
 
-// SendResults to the MockDB
-func (db *MockDB) SendResults(results []interface{}) (string, error) {
+// SendStatusResults to the MockDB. Like the real database, results with a
+// ResponseID that was already written are skipped.
+func (db *MockDB) SendStatusResults(ctx context.Context, results []checks.StatusCheckResult) (int, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+	if db.written == nil {
+		db.written = make(map[string]bool)
+	}
+
 	added := 0
-	for i := range results {
-		r, ok := results[i].(checks.StatusCheckResult)
-		if ok {
-			db.StatusResultMutex.Lock()
-			defer db.StatusResultMutex.Unlock()
-			db.StatusResult = append(db.StatusResult, r)
-			added++
-		} else {
-			return "", errors.New("SendResults failed")
+	var failed []int
+	for i, r := range results {
+		if db.FailResponseIDs[r.ResponseID] {
+			failed = append(failed, i)
+			continue
+		}
+		if db.written[r.ResponseID] {
+			continue
+		}
+		db.written[r.ResponseID] = true
+		if tenant, ok := data.TenantFrom(ctx); ok {
+			r.Metadata.Tenant = tenant
 		}
+		db.StatusResult = append(db.StatusResult, r)
+		added++
 	}
-	summary := fmt.Sprintf("successfully inserted %d items", added)
-	return summary, nil
+	if len(failed) > 0 {
+		return added, &data.PartialWriteError{Failed: failed, Err: errors.New("mock write failure")}
+	}
+	return added, nil
 }
 
-// Disconnect from the MockDB to satisfy interface
-func (db *MockDB) Disconnect() {}
+// SendSSLResults to the MockDB, skipping duplicates
+func (db *MockDB) SendSSLResults(_ context.Context, results []checks.SSLCheckResult) (int, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+	if db.written == nil {
+		db.written = make(map[string]bool)
+	}
+
+	added := 0
+	for _, r := range results {
+		if db.written["ssl:"+r.ResponseID] {
+			continue
+		}
+		db.written["ssl:"+r.ResponseID] = true
+		db.SSLResult = append(db.SSLResult, r)
+		added++
+	}
+	return added, nil
+}
+
+// GetStatusResults returns mock results matching query ordered by timestamp
+func (db *MockDB) GetStatusResults(ctx context.Context, query data.ResultQuery) ([]checks.StatusCheckResult, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	results := db.matchingResults(ctx, query)
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Timestamp.Equal(results[j].Timestamp) {
+			return results[i].ResponseID < results[j].ResponseID
+		}
+		return results[i].Timestamp.Before(results[j].Timestamp)
+	})
+	if after := query.After; after != nil {
+		results = slices.DeleteFunc(results, func(r checks.StatusCheckResult) bool {
+			return r.Timestamp.Before(after.Timestamp) ||
+				(r.Timestamp.Equal(after.Timestamp) && r.ResponseID <= after.ResponseID)
+		})
+	}
+	return page(results, query), nil
+}
+
+// SummarizeStatusResults aggregates mock results matching query into buckets
+func (db *MockDB) SummarizeStatusResults(ctx context.Context, query data.ResultQuery, bucket time.Duration) ([]checks.StatusCheckSummary, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	type key struct {
+		checks.StatusCheckMetadata
+		timestamp int64
+	}
+	type sums struct {
+		summary               checks.StatusCheckSummary
+		timed, ttfb, connects int64
+	}
+	buckets := make(map[key]*sums)
+	for _, r := range db.matchingResults(ctx, query) {
+		ts := r.Timestamp.Unix() - r.Timestamp.Unix()%int64(bucket.Seconds())
+		k := key{r.Metadata, ts}
+		if buckets[k] == nil {
+			buckets[k] = &sums{summary: checks.StatusCheckSummary{Metadata: r.Metadata, Timestamp: time.Unix(ts, 0).UTC()}}
+		}
+		b := buckets[k]
+		b.summary.Count++
+		if !r.Up() {
+			b.summary.Failures++
+		}
+		if r.ResponseCode != 0 {
+			b.timed++
+			b.ttfb += r.TTFB
+			b.connects += r.ConnectTiming
+			if r.TTFB > b.summary.TTFBMax {
+				b.summary.TTFBMax = r.TTFB
+			}
+		}
+	}
+
+	summaries := make([]checks.StatusCheckSummary, 0, len(buckets))
+	for _, b := range buckets {
+		s := b.summary
+		s.UptimePercent = checks.UptimePercent(s.Count, s.Failures)
+		if b.timed > 0 {
+			s.TTFBAvg = int64(math.Round(float64(b.ttfb) / float64(b.timed)))
+			s.ConnectAvg = int64(math.Round(float64(b.connects) / float64(b.timed)))
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Metadata.CheckID != b.Metadata.CheckID {
+			return a.Metadata.CheckID < b.Metadata.CheckID
+		}
+		return a.Metadata.Region < b.Metadata.Region
+	})
+	return page(summaries, query), nil
+}
+
+// SaveRollups upserts mock rollups keyed on check, region and timestamp
+func (db *MockDB) SaveRollups(ctx context.Context, period checks.RollupPeriod, rollups []checks.StatusCheckRollup) error {
+	if err := period.Validate(); err != nil {
+		return err
+	}
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+	if db.Rollups == nil {
+		db.Rollups = make(map[checks.RollupPeriod]map[string]checks.StatusCheckRollup)
+	}
+	if db.Rollups[period] == nil {
+		db.Rollups[period] = make(map[string]checks.StatusCheckRollup)
+	}
+	for _, r := range rollups {
+		if tenant, ok := data.TenantFrom(ctx); ok {
+			r.Metadata.Tenant = tenant
+		}
+		db.Rollups[period][checks.RollupID(r.Metadata.Tenant, r.Metadata.Region, r.Metadata.CheckID, r.Timestamp)] = r
+	}
+	return nil
+}
+
+// GetRollups returns mock rollups matching query ordered by timestamp
+func (db *MockDB) GetRollups(ctx context.Context, period checks.RollupPeriod, query data.ResultQuery) ([]checks.StatusCheckRollup, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var rollups []checks.StatusCheckRollup
+	for _, r := range db.Rollups[period] {
+		if !visible(ctx, r.Metadata.Tenant) {
+			continue
+		}
+		if query.CheckID != "" && r.Metadata.CheckID != query.CheckID {
+			continue
+		}
+		if query.Region != "" && r.Metadata.Region != query.Region {
+			continue
+		}
+		if !query.From.IsZero() && r.Timestamp.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !r.Timestamp.Before(query.To) {
+			continue
+		}
+		rollups = append(rollups, r)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Metadata.CheckID != b.Metadata.CheckID {
+			return a.Metadata.CheckID < b.Metadata.CheckID
+		}
+		return a.Metadata.Region < b.Metadata.Region
+	})
+	return page(rollups, query), nil
+}
+
+// SaveWorker registers a mock worker or replaces its registration
+func (db *MockDB) SaveWorker(_ context.Context, worker checks.Worker) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if db.Workers == nil {
+		db.Workers = make(map[string]checks.Worker)
+	}
+	db.Workers[worker.ID] = worker
+	return nil
+}
+
+// ListWorkers returns the mock workers ordered by region and id
+func (db *MockDB) ListWorkers(_ context.Context) ([]checks.Worker, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var workers []checks.Worker
+	for _, w := range db.Workers {
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].Region != workers[j].Region {
+			return workers[i].Region < workers[j].Region
+		}
+		return workers[i].ID < workers[j].ID
+	})
+	return workers, nil
+}
+
+// DeleteWorker removes the mock worker with id
+func (db *MockDB) DeleteWorker(_ context.Context, id string) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if _, ok := db.Workers[id]; !ok {
+		return data.ErrNotFound
+	}
+	delete(db.Workers, id)
+	return nil
+}
+
+// AcquireLease takes or renews a mock lease
+func (db *MockDB) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	return db.Leases.AcquireLease(ctx, name, holder, ttl)
+}
+
+// ReleaseLease deletes a mock lease if holder has it
+func (db *MockDB) ReleaseLease(ctx context.Context, name string, holder string) error {
+	return db.Leases.ReleaseLease(ctx, name, holder)
+}
+
+// CreateToken adds a mock token
+func (db *MockDB) CreateToken(ctx context.Context, token auth.Token) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if _, ok := db.Tokens[token.ID]; ok {
+		return data.ErrExists
+	}
+	if tenant, ok := data.TenantFrom(ctx); ok {
+		token.Tenant = tenant
+	}
+	if db.Tokens == nil {
+		db.Tokens = make(map[string]auth.Token)
+	}
+	db.Tokens[token.ID] = token
+	return nil
+}
+
+// GetToken returns the mock token with id
+func (db *MockDB) GetToken(ctx context.Context, id string) (auth.Token, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	token, ok := db.Tokens[id]
+	if !ok || !visible(ctx, token.Tenant) {
+		return auth.Token{}, data.ErrNotFound
+	}
+	return token, nil
+}
+
+// ListTokens returns the mock tokens ordered by id
+func (db *MockDB) ListTokens(ctx context.Context) ([]auth.Token, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var tokens []auth.Token
+	for _, t := range db.Tokens {
+		if visible(ctx, t.Tenant) {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// DeleteToken removes the mock token with id
+func (db *MockDB) DeleteToken(ctx context.Context, id string) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if token, ok := db.Tokens[id]; !ok || !visible(ctx, token.Tenant) {
+		return data.ErrNotFound
+	}
+	delete(db.Tokens, id)
+	return nil
+}
+
+// SaveTenant creates a mock tenant or replaces its quotas
+func (db *MockDB) SaveTenant(ctx context.Context, tenant checks.Tenant) error {
+	if _, ok := data.TenantFrom(ctx); ok {
+		return data.ErrTenantScope
+	}
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if db.Tenants == nil {
+		db.Tenants = make(map[string]checks.Tenant)
+	}
+	db.Tenants[tenant.Name] = tenant
+	return nil
+}
+
+// GetTenant returns the mock tenant with name
+func (db *MockDB) GetTenant(ctx context.Context, name string) (checks.Tenant, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	tenant, ok := db.Tenants[name]
+	if !ok || !visible(ctx, name) {
+		return checks.Tenant{}, data.ErrNotFound
+	}
+	return tenant, nil
+}
+
+// ListTenants returns the mock tenants ordered by name
+func (db *MockDB) ListTenants(ctx context.Context) ([]checks.Tenant, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var tenants []checks.Tenant
+	for _, t := range db.Tenants {
+		if visible(ctx, t.Name) {
+			tenants = append(tenants, t)
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+// DeleteTenant removes the mock tenant with name
+func (db *MockDB) DeleteTenant(ctx context.Context, name string) error {
+	if _, ok := data.TenantFrom(ctx); ok {
+		return data.ErrTenantScope
+	}
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if _, ok := db.Tenants[name]; !ok {
+		return data.ErrNotFound
+	}
+	delete(db.Tenants, name)
+	return nil
+}
+
+// SaveSecret creates a mock secret or replaces its value
+func (db *MockDB) SaveSecret(ctx context.Context, secret checks.Secret) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	if tenant, ok := data.TenantFrom(ctx); ok {
+		secret.Tenant = tenant
+	}
+	if db.Secrets == nil {
+		db.Secrets = make(map[[2]string]checks.Secret)
+	}
+	db.Secrets[[2]string{secret.Tenant, secret.Name}] = secret
+	return nil
+}
+
+// GetSecret returns the mock secret of tenant with name
+func (db *MockDB) GetSecret(ctx context.Context, tenant string, name string) (checks.Secret, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	secret, ok := db.Secrets[[2]string{tenant, name}]
+	if !ok || !visible(ctx, tenant) {
+		return checks.Secret{}, data.ErrNotFound
+	}
+	return secret, nil
+}
+
+// ListSecrets returns the mock secrets ordered by tenant and name
+func (db *MockDB) ListSecrets(ctx context.Context) ([]checks.Secret, error) {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	var secrets []checks.Secret
+	for _, s := range db.Secrets {
+		if visible(ctx, s.Tenant) {
+			secrets = append(secrets, s)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if secrets[i].Tenant != secrets[j].Tenant {
+			return secrets[i].Tenant < secrets[j].Tenant
+		}
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// DeleteSecret removes the mock secret of tenant with name
+func (db *MockDB) DeleteSecret(ctx context.Context, tenant string, name string) error {
+	db.StatusResultMutex.Lock()
+	defer db.StatusResultMutex.Unlock()
+
+	key := [2]string{tenant, name}
+	if _, ok := db.Secrets[key]; !ok || !visible(ctx, tenant) {
+		return data.ErrNotFound
+	}
+	delete(db.Secrets, key)
+	return nil
+}
 
 // AddCheck to MockDB
 func (db *MockDB) AddCheck(check checks.StatusCheck) {
 	db.Checks.StatusChecks = append(db.Checks.StatusChecks, check)
 }
+
+// matchingResults returns the results matching query's filters
+func (db *MockDB) matchingResults(ctx context.Context, query data.ResultQuery) []checks.StatusCheckResult {
+	var results []checks.StatusCheckResult
+	for _, r := range db.StatusResult {
+		if !visible(ctx, r.Metadata.Tenant) {
+			continue
+		}
+		if query.CheckID != "" && r.Metadata.CheckID != query.CheckID {
+			continue
+		}
+		if query.Region != "" && r.Metadata.Region != query.Region {
+			continue
+		}
+		if !query.From.IsZero() && r.Timestamp.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !r.Timestamp.Before(query.To) {
+			continue
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// page applies query's Offset and Limit to items
+func page[T any](items []T, query data.ResultQuery) []T {
+	if query.Offset >= len(items) {
+		return nil
+	}
+	items = items[query.Offset:]
+	if query.Limit > 0 && len(items) > query.Limit {
+		items = items[:query.Limit]
+	}
+	return items
+}
+
+// visible reports whether ctx can see data of tenant
+func visible(ctx context.Context, tenant string) bool {
+	scope, ok := data.TenantFrom(ctx)
+	return !ok || scope == tenant
+}
+
+// checkIndex returns the index of the check GetStatusCheck returns, or -1
+func (db *MockDB) checkIndex(ctx context.Context, id string) int {
+	index := -1
+	for i, c := range db.Checks.StatusChecks {
+		if c.ID == id && visible(ctx, c.Tenant) && (index < 0 || c.Tenant < db.Checks.StatusChecks[index].Tenant) {
+			index = i
+		}
+	}
+	return index
+}
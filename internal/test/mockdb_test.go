@@ -0,0 +1,11 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/larntz/status/internal/data"
+)
+
+func TestMockDBConformance(t *testing.T) {
+	DatabaseConformance(t, func(t *testing.T) data.Database { return &MockDB{} })
+}